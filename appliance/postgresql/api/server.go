@@ -5,6 +5,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/go-martini/martini"
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/martini-contrib/render"
@@ -42,6 +44,7 @@ func main() {
 	m.Map(db)
 
 	r.Post("/databases", createDatabase)
+	r.Delete("/databases", dropDatabase)
 	r.Get("/ping", ping)
 
 	port := os.Getenv("PORT")
@@ -91,6 +94,35 @@ func createDatabase(db *postgres.DB, r render.Render) {
 	})
 }
 
+var identPattern = regexp.MustCompile(`^[0-9a-f]+$`)
+
+func dropDatabase(db *postgres.DB, req *http.Request, r render.Render) {
+	id := strings.SplitN(strings.TrimPrefix(req.FormValue("id"), "/databases/"), ":", 2)
+	if len(id) != 2 || !identPattern.MatchString(id[0]) || !identPattern.MatchString(id[1]) {
+		r.JSON(400, struct{}{})
+		return
+	}
+	username, database := id[0], id[1]
+
+	// the database can't be dropped while clients are connected to it
+	if err := db.Exec("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1", database); err != nil {
+		log.Println(err)
+		r.JSON(500, struct{}{})
+		return
+	}
+	if err := db.Exec(fmt.Sprintf(`DROP DATABASE IF EXISTS "%s"`, database)); err != nil {
+		log.Println(err)
+		r.JSON(500, struct{}{})
+		return
+	}
+	if err := db.Exec(fmt.Sprintf(`DROP USER IF EXISTS "%s"`, username)); err != nil {
+		log.Println(err)
+		r.JSON(500, struct{}{})
+		return
+	}
+	r.JSON(200, struct{}{})
+}
+
 func ping(db *postgres.DB, w http.ResponseWriter) {
 	if err := db.Exec("SELECT 1"); err != nil {
 		log.Println(err)
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+func init() {
+	register("drain", runDrain, `
+usage: flynn drain
+       flynn drain add <url>
+       flynn drain remove <id>
+
+Manage syslog drains which the logs of an app are forwarded to.
+
+Log lines are sent as RFC 5424 syslog messages with the app, process type and
+job ID in the structured data. Lines are buffered and retried while a drain is
+unavailable.
+
+Commands:
+	With no arguments, shows a list of drains.
+
+	add     adds a drain, syslog://host:port for TCP or syslog+tls://host:port for TLS
+	remove  removes a drain
+
+Examples:
+
+	$ flynn drain add syslog+tls://logs.example.com:6514
+	Created drain 1b1ef6ae-a8a6-4b62-a9ab-b6e0bd4a2e1b.
+
+	$ flynn drain
+	ID                                    URL
+	1b1ef6ae-a8a6-4b62-a9ab-b6e0bd4a2e1b  syslog+tls://logs.example.com:6514
+`)
+}
+
+func runDrain(args *docopt.Args, client *controller.Client) error {
+	if args.Bool["add"] {
+		return runDrainAdd(args, client)
+	} else if args.Bool["remove"] {
+		return runDrainRemove(args, client)
+	}
+
+	drains, err := client.DrainList(mustApp())
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "ID", "URL")
+	for _, d := range drains {
+		listRec(w, d.ID, d.URL)
+	}
+	return nil
+}
+
+func runDrainAdd(args *docopt.Args, client *controller.Client) error {
+	drain := &ct.Drain{URL: args.String["<url>"]}
+	if err := client.CreateDrain(mustApp(), drain); err != nil {
+		return err
+	}
+	fmt.Printf("Created drain %s.\n", drain.ID)
+	return nil
+}
+
+func runDrainRemove(args *docopt.Args, client *controller.Client) error {
+	drainID := args.String["<id>"]
+
+	if err := client.DeleteDrain(mustApp(), drainID); err != nil {
+		return err
+	}
+	fmt.Printf("Drain %s removed.\n", drainID)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/term"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/cluster"
+)
+
+func init() {
+	cmd := register("exec", runExec, `
+usage: flynn exec <job> <command> [<argument>...]
+
+Run a command with a TTY inside a running job.
+
+The command runs in the job's container alongside the job's own process, with
+the same filesystem, network and environment, which makes it useful for
+debugging a misbehaving job. The job keeps running once the command exits.
+
+Examples:
+
+	$ flynn exec flynn-bb97c7dac2fa455dad73459056fabac2 ps aux
+	USER       PID %CPU %MEM    VSZ   RSS TTY      STAT START   TIME COMMAND
+	root         1  0.0  0.0  17700  6416 ?        Ssl  12:01   0:00 /.containerinit
+	root        12  0.1  0.9 142104 38216 ?        Ssl  12:01   0:04 /runner/init start web
+	root        58  0.0  0.0  15572  2088 pts/1    Rs+  12:43   0:00 ps aux
+
+	$ flynn exec flynn-bb97c7dac2fa455dad73459056fabac2 bash
+`)
+	cmd.optsFirst = true
+}
+
+func runExec(args *docopt.Args, client *controller.Client) error {
+	req := &ct.NewExec{
+		Cmd: append([]string{args.String["<command>"]}, args.All["<argument>"].([]string)...),
+		Env: make(map[string]string),
+	}
+	tty := term.IsTerminal(os.Stdin.Fd()) && term.IsTerminal(os.Stdout.Fd())
+	if tty {
+		ws, err := term.GetWinsize(os.Stdin.Fd())
+		if err != nil {
+			return err
+		}
+		req.Columns = int(ws.Width)
+		req.Lines = int(ws.Height)
+		req.Env["COLUMNS"] = strconv.Itoa(int(ws.Width))
+		req.Env["LINES"] = strconv.Itoa(int(ws.Height))
+		// only override the job's TERM when there is one to pass on
+		if t := os.Getenv("TERM"); t != "" {
+			req.Env["TERM"] = t
+		}
+	}
+
+	rwc, err := client.ExecJob(mustApp(), args.String["<job>"], req)
+	if err != nil {
+		return err
+	}
+	defer rwc.Close()
+	return runAttached(cluster.NewAttachClient(rwc), tty)
+}
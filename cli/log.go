@@ -1,35 +1,51 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"strconv"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
 	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
 	"github.com/flynn/flynn/pkg/cluster"
 )
 
 func init() {
 	register("log", runLog, `
-usage: flynn log [options] <job>
+usage: flynn log [options] [<job>]
 
-Stream log for a specific job.
+Stream log for an app or a specific job.
+
+Without a job, the aggregated log of all of the app's jobs is printed, with
+each line prefixed by the time it was received, its process type and job.
 
 Options:
-	-s, --split-stderr  send stderr lines to stderr
-	-f, --follow        stream new lines after printing log buffer
+	-s, --split-stderr     send stderr lines to stderr
+	-f, --follow           stream new lines after printing log buffer
+	-t, --type=<type>      only print lines from jobs of the given process type
+	-n, --lines=<lines>    only print the last <lines> lines of the log buffer
+
+Examples:
+
+	$ flynn log --follow --type web
 `)
 }
 
 func runLog(args *docopt.Args, client *controller.Client) error {
-	rc, err := client.GetJobLog(mustApp(), args.String["<job>"], args.Bool["--follow"])
-	if err != nil {
-		return err
-	}
 	var stderr io.Writer = os.Stdout
 	if args.Bool["--split-stderr"] {
 		stderr = os.Stderr
 	}
+	if args.String["<job>"] == "" {
+		return runAppLog(args, client, stderr)
+	}
+
+	rc, err := client.GetJobLog(mustApp(), args.String["<job>"], args.Bool["--follow"])
+	if err != nil {
+		return err
+	}
 	attachClient := cluster.NewAttachClient(struct {
 		io.Writer
 		io.ReadCloser
@@ -37,3 +53,37 @@ func runLog(args *docopt.Args, client *controller.Client) error {
 	attachClient.Receive(os.Stdout, stderr)
 	return nil
 }
+
+func runAppLog(args *docopt.Args, client *controller.Client, stderr io.Writer) error {
+	opts := &ct.LogOpts{
+		Follow:      args.Bool["--follow"],
+		ProcessType: args.String["--type"],
+	}
+	if s := args.String["--lines"]; s != "" {
+		lines, err := strconv.Atoi(s)
+		if err != nil || lines < 0 {
+			return fmt.Errorf("invalid number of lines: %q", s)
+		}
+		opts.Lines = lines
+	}
+
+	msgs := make(chan *ct.LogMessage)
+	stream, err := client.StreamAppLog(mustApp(), opts, msgs)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	for msg := range msgs {
+		w := io.Writer(os.Stdout)
+		if msg.Stream == "stderr" {
+			w = stderr
+		}
+		typ := msg.ProcessType
+		if typ == "" {
+			typ = "run"
+		}
+		fmt.Fprintf(w, "%s %s[%s]: %s\n", msg.Timestamp.Format("2006-01-02T15:04:05.000000Z07:00"), typ, msg.JobID, msg.Message)
+	}
+	return stream.Err()
+}
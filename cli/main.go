@@ -50,6 +50,7 @@ Commands:
 	run       run a job
 	env       manage env variables
 	route     manage routes
+	drain     manage syslog log drains
 	provider  manage resource providers
 	resource  provision a new resource
 	key       manage SSH public keys
@@ -2,7 +2,9 @@ package main
 
 import (
 	"sort"
+	"time"
 
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/units"
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
 	"github.com/flynn/flynn/controller/client"
 	ct "github.com/flynn/flynn/controller/types"
@@ -10,17 +12,26 @@ import (
 
 func init() {
 	register("ps", runPs, `
-usage: flynn ps
+usage: flynn ps [--stats]
 
 List flynn jobs.
 
-Example:
+Options:
+	-s, --stats  show the memory usage, CPU time and process count of each job
+
+Examples:
 
 	$ flynn ps
 	ID                                      TYPE
 	flynn-bb97c7dac2fa455dad73459056fabac2  web
 	flynn-c59e02b3e6ad49809424848809d4749a  web
 	flynn-46f0d715a9684e4c822e248e84a5a418  web
+
+	$ flynn ps --stats
+	ID                                      TYPE  MEMORY    CPU TIME  PROCESSES
+	flynn-bb97c7dac2fa455dad73459056fabac2  web   38.2 MiB  1m3.27s   4
+	flynn-c59e02b3e6ad49809424848809d4749a  web   37.9 MiB  58.91s    4
+	flynn-46f0d715a9684e4c822e248e84a5a418  web   41.5 MiB  1m8.05s   5
 `)
 }
 
@@ -34,7 +45,12 @@ func runPs(args *docopt.Args, client *controller.Client) error {
 	w := tabWriter()
 	defer w.Flush()
 
-	listRec(w, "ID", "TYPE")
+	stats := args.Bool["--stats"]
+	if stats {
+		listRec(w, "ID", "TYPE", "MEMORY", "CPU TIME", "PROCESSES")
+	} else {
+		listRec(w, "ID", "TYPE")
+	}
 	for _, j := range jobs {
 		if j.Type == "" {
 			j.Type = "run"
@@ -42,7 +58,18 @@ func runPs(args *docopt.Args, client *controller.Client) error {
 		if j.State != "up" {
 			continue
 		}
-		listRec(w, j.ID, j.Type)
+		if !stats {
+			listRec(w, j.ID, j.Type)
+			continue
+		}
+		s, err := client.GetJobStats(mustApp(), j.ID)
+		if err != nil {
+			// the job may have stopped since it was listed
+			listRec(w, j.ID, j.Type)
+			continue
+		}
+		cpuTime := s.CPUTime - s.CPUTime%(10*time.Millisecond)
+		listRec(w, j.ID, j.Type, units.BytesSize(float64(s.MemoryUsage)), cpuTime, s.Processes)
 	}
 
 	return nil
@@ -14,6 +14,8 @@ import (
 func init() {
 	register("release", runRelease, `
 usage: flynn release add [-t <type>] [-f <file>] <uri>
+       flynn release list
+       flynn release rollback [<id>]
 
 Manage app releases.
 
@@ -31,6 +33,13 @@ Commands:
 		release environment and processes (similar to a Procfile). It can take any
 		of the arguments the controller Release type can take.
 
+	list  list releases which have been deployed for the app, most recent first
+
+	rollback  deploy a previously deployed release
+
+		If no release ID is given, the release deployed before the current
+		release is used.
+
 Examples:
 
 	Release an echo server using the flynn/slugbuilder image as a base, running socat.
@@ -49,6 +58,14 @@ Examples:
 	}
 	$ flynn release add -f config.json https://registry.hub.docker.com/flynn/slugbuilder?id=15d72b7f573b
 	Created release f55fde802170.
+
+	$ flynn release list
+	ID                                DEPLOYED
+	f55fde802170439ba6c5b1d1e8a5e4b0  2015-03-20 16:18:35 +0000 UTC
+	b8d2e8d3e2254d28a03a45e0c29b9f3e  2015-03-19 11:02:12 +0000 UTC
+
+	$ flynn release rollback
+	Rolled back to release b8d2e8d3e2254d28a03a45e0c29b9f3e.
 `)
 }
 
@@ -59,6 +76,10 @@ func runRelease(args *docopt.Args, client *controller.Client) error {
 		} else {
 			return fmt.Errorf("Release type %s not supported.", args.String["-t"])
 		}
+	} else if args.Bool["list"] {
+		return runReleaseList(client)
+	} else if args.Bool["rollback"] {
+		return runReleaseRollback(args, client)
 	}
 	return fmt.Errorf("Top-level command not implemented.")
 }
@@ -96,3 +117,32 @@ func runReleaseAddDocker(args *docopt.Args, client *controller.Client) error {
 
 	return nil
 }
+
+func runReleaseList(client *controller.Client) error {
+	releases, err := client.AppReleaseList(mustApp())
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "ID", "DEPLOYED")
+	for _, r := range releases {
+		var deployed string
+		if r.DeployedAt != nil {
+			deployed = r.DeployedAt.String()
+		}
+		listRec(w, r.ID, deployed)
+	}
+	return nil
+}
+
+func runReleaseRollback(args *docopt.Args, client *controller.Client) error {
+	releaseID, err := client.RollbackAppRelease(mustApp(), args.String["<id>"])
+	if err != nil {
+		return err
+	}
+	log.Printf("Rolled back to release %s.", releaseID)
+	return nil
+}
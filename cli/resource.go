@@ -12,17 +12,22 @@ import (
 func init() {
 	register("resource", runResource, `
 usage: flynn resource add <provider>
+       flynn resource remove <provider> <resource>
 
 Manage resources for the app.
 
 Commands:
-	add  provisions a new resource for the app using <provider>.
+	add     provisions a new resource for the app using <provider>.
+	remove  deprovisions <resource> from <provider>, removing its
+	        environment variables from the app.
 `)
 }
 
 func runResource(args *docopt.Args, client *controller.Client) error {
 	if args.Bool["add"] {
 		return runResourceAdd(args, client)
+	} else if args.Bool["remove"] {
+		return runResourceRemove(args, client)
 	}
 	return fmt.Errorf("Top-level command not implemented.")
 }
@@ -50,3 +55,55 @@ func runResourceAdd(args *docopt.Args, client *controller.Client) error {
 
 	return nil
 }
+
+func runResourceRemove(args *docopt.Args, client *controller.Client) error {
+	provider := args.String["<provider>"]
+	resourceID := args.String["<resource>"]
+
+	res, err := client.DeleteResource(provider, resourceID)
+	if err != nil {
+		return err
+	}
+
+	app, err := client.GetApp(mustApp())
+	if err != nil {
+		return err
+	}
+	var attached bool
+	for _, id := range res.Apps {
+		if id == app.ID {
+			attached = true
+			break
+		}
+	}
+	if !attached {
+		log.Printf("Deleted resource %s.", res.ID)
+		return nil
+	}
+
+	// unset the resource's environment variables, leaving any that have
+	// been changed since it was added
+	release, err := client.GetAppRelease(app.ID)
+	if err != nil && err != controller.ErrNotFound {
+		return err
+	}
+	env := make(map[string]*string)
+	for k, v := range res.Env {
+		if cur, ok := release.Env[k]; ok && cur == v {
+			env[k] = nil
+		}
+	}
+	if len(env) == 0 {
+		log.Printf("Deleted resource %s.", res.ID)
+		return nil
+	}
+
+	releaseID, err := setEnv(client, "", env)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Deleted resource %s and created release %s.", res.ID, releaseID)
+
+	return nil
+}
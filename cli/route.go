@@ -17,17 +17,26 @@ import (
 func init() {
 	register("route", runRoute, `
 usage: flynn route
-       flynn route add http [-s <service>] [-c <tls-cert> -k <tls-key>] [--sticky] <domain>
-       flynn route add tcp [-s <service>]
+       flynn route add http [-s <service>] [-p <path>] [-c <tls-cert> -k <tls-key> | --acme] [--sticky] [-b <policy> [--hash-header <header>]] [--rate <rate> [--burst <burst>] [--rate-header <header>]] <domain>
+       flynn route add tcp [-s <service>] [-b <policy>] [--max-conns <max>] [--sni <domain>]
        flynn route remove <id>
 
 Manage routes for application.
 
 Options:
-	-s, --service <service>    service name to route domain to (defaults to APPNAME-web)
-	-c, --tls-cert <tls-cert>  path to PEM encoded certificate for TLS, - for stdin (http only)
-	-k, --tls-key <tls-key>    path to PEM encoded private key for TLS, - for stdin (http only)
-	--sticky                   enable cookie-based sticky routing (http only)
+	-s, --service <service>       service name to route domain to (defaults to APPNAME-web)
+	-p, --path <path>             path prefix to route to the service, longest match wins (http only)
+	-c, --tls-cert <tls-cert>     path to PEM encoded certificate for TLS, - for stdin (http only)
+	-k, --tls-key <tls-key>       path to PEM encoded private key for TLS, - for stdin (http only)
+	--acme                        obtain and renew a TLS certificate from the router's ACME server (http only)
+	--sticky                      enable cookie-based sticky routing (http only)
+	-b, --load-balancer <policy>  backend selection policy: random (default), round-robin, least-requests or (http only) header-hash
+	--hash-header <header>        request header hashed by the header-hash policy (http only)
+	--rate <rate>                 requests per second allowed from each client, others get a 429 (http only)
+	--burst <burst>               requests a client may make at once (http only, defaults to the rate)
+	--rate-header <header>        request header identifying clients for rate limiting instead of their IP (http only)
+	--max-conns <max>             maximum number of concurrent connections (tcp only)
+	--sni <domain>                pass TLS connections for domain on the HTTPS port through to the service (tcp only)
 
 Commands:
 	With no arguments, shows a list of routes.
@@ -39,7 +48,15 @@ Examples:
 
 	$ flynn route add http example.com
 
+	$ flynn route add http -s api-web --path /api example.com
+
+	$ flynn route add http --acme example.com
+
+	$ flynn route add http --load-balancer header-hash --hash-header X-User-Id example.com
+
 	$ flynn route add tcp
+
+	$ flynn route add tcp -s db --sni db.example.com
 `)
 }
 
@@ -73,10 +90,14 @@ func runRoute(args *docopt.Args, client *controller.Client) error {
 			protocol = "tcp"
 			route = strconv.Itoa(k.TCPRoute().Port)
 			service = k.TCPRoute().Service
+			if domain := k.TCPRoute().Domain; domain != "" {
+				protocol = "tls"
+				route = domain
+			}
 		case "http":
-			route = k.HTTPRoute().Domain
+			route = k.HTTPRoute().Domain + k.HTTPRoute().Path
 			service = k.TCPRoute().Service
-			if k.HTTPRoute().TLSCert == "" {
+			if k.HTTPRoute().TLSCert == "" && !k.HTTPRoute().ACME {
 				protocol = "http"
 			} else {
 				protocol = "https"
@@ -93,12 +114,27 @@ func runRouteAddTCP(args *docopt.Args, client *controller.Client) error {
 		service = mustApp() + "-web"
 	}
 
-	hr := &router.TCPRoute{Service: service}
+	hr := &router.TCPRoute{
+		Service:      service,
+		LoadBalancer: args.String["--load-balancer"],
+		Domain:       args.String["--sni"],
+	}
+	if s := args.String["--max-conns"]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return fmt.Errorf("Invalid max conns: %q", s)
+		}
+		hr.MaxConns = n
+	}
 	r := hr.ToRoute()
 	if err := client.CreateRoute(mustApp(), r); err != nil {
 		return err
 	}
 	hr = r.TCPRoute()
+	if hr.Domain != "" {
+		fmt.Printf("%s passing through TLS connections for %s\n", r.ID, hr.Domain)
+		return nil
+	}
 	fmt.Printf("%s listening on port %d\n", r.ID, hr.Port)
 	return nil
 }
@@ -138,11 +174,29 @@ func runRouteAddHTTP(args *docopt.Args, client *controller.Client) error {
 	}
 
 	hr := &router.HTTPRoute{
-		Service: service,
-		Domain:  args.String["<domain>"],
-		TLSCert: string(tlsCert),
-		TLSKey:  string(tlsKey),
-		Sticky:  args.Bool["sticky"],
+		Service:      service,
+		Domain:       args.String["<domain>"],
+		Path:         args.String["--path"],
+		TLSCert:      string(tlsCert),
+		TLSKey:       string(tlsKey),
+		Sticky:       args.Bool["sticky"],
+		LoadBalancer: args.String["--load-balancer"],
+		HashHeader:   args.String["--hash-header"],
+		ACME:         args.Bool["--acme"],
+	}
+	if s := args.String["--rate"]; s != "" {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("Invalid rate: %q", s)
+		}
+		hr.RateLimit = &router.RateLimit{Rate: rate, Header: args.String["--rate-header"]}
+		if s := args.String["--burst"]; s != "" {
+			burst, err := strconv.Atoi(s)
+			if err != nil || burst < 1 {
+				return fmt.Errorf("Invalid burst: %q", s)
+			}
+			hr.RateLimit.Burst = burst
+		}
 	}
 	route := hr.ToRoute()
 	if err := client.CreateRoute(mustApp(), route); err != nil {
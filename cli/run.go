@@ -85,10 +85,15 @@ func runRun(args *docopt.Args, client *controller.Client) error {
 		return err
 	}
 	defer rwc.Close()
-	attachClient := cluster.NewAttachClient(rwc)
+	return runAttached(cluster.NewAttachClient(rwc), req.TTY)
+}
 
+// runAttached connects stdin, stdout and stderr to an attached job (or exec)
+// and forwards signals to it, exiting with its exit status once it exits.
+func runAttached(attachClient cluster.AttachClient, tty bool) error {
 	var termState *term.State
-	if req.TTY {
+	var err error
+	if tty {
 		termState, err = term.MakeRaw(os.Stdin.Fd())
 		if err != nil {
 			return err
@@ -132,7 +137,7 @@ func runRun(args *docopt.Args, client *controller.Client) error {
 	if err != nil {
 		return err
 	}
-	if req.TTY {
+	if tty {
 		term.RestoreTerminal(os.Stdin.Fd(), termState)
 	}
 	shutdown.ExitWithCode(exitStatus)
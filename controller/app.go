@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"regexp"
+	"time"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-sql"
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/pq/hstore"
@@ -256,3 +259,30 @@ func (c *controllerAPI) UpdateApp(ctx context.Context, rw http.ResponseWriter, r
 	}
 	httphelper.JSON(rw, 200, app)
 }
+
+// AppLog streams the aggregated log of all of the app's jobs from the log
+// aggregator.
+func (c *controllerAPI) AppLog(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	app := c.getApp(ctx)
+	u, err := url.Parse(c.logaggregatorURL)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	proxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			q := r.URL.Query()
+			// don't pass the controller auth key on to the aggregator
+			q.Del("key")
+			r.Header.Del("Authorization")
+
+			r.URL.Scheme = u.Scheme
+			r.URL.Host = u.Host
+			r.URL.Path = "/apps/" + app.ID + "/log"
+			r.URL.RawQuery = q.Encode()
+			r.Host = u.Host
+		},
+		FlushInterval: 100 * time.Millisecond,
+	}
+	proxy.ServeHTTP(w, req)
+}
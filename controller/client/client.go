@@ -13,6 +13,7 @@ import (
 	"time"
 
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/httpclient"
 	"github.com/flynn/flynn/pkg/pinned"
 	"github.com/flynn/flynn/pkg/stream"
@@ -163,6 +164,14 @@ func (c *Client) PutResource(resource *ct.Resource) error {
 	return c.Put(fmt.Sprintf("/providers/%s/resources/%s", resource.ProviderID, resource.ID), resource, resource)
 }
 
+// DeleteResource deprovisions and deletes the resource identified by
+// resourceID under providerID, returning the deleted resource.
+func (c *Client) DeleteResource(providerID, resourceID string) (*ct.Resource, error) {
+	res := &ct.Resource{}
+	err := c.Send("DELETE", fmt.Sprintf("/providers/%s/resources/%s", providerID, resourceID), nil, res)
+	return res, err
+}
+
 // PutFormation updates an existing formation.
 func (c *Client) PutFormation(formation *ct.Formation) error {
 	if formation.AppID == "" || formation.ReleaseID == "" {
@@ -195,6 +204,21 @@ func (c *Client) GetAppRelease(appID string) (*ct.Release, error) {
 	return release, c.Get(fmt.Sprintf("/apps/%s/release", appID), release)
 }
 
+// AppReleaseList returns the releases which have been deployed for an app,
+// most recently deployed first.
+func (c *Client) AppReleaseList(appID string) ([]*ct.DeployedRelease, error) {
+	var releases []*ct.DeployedRelease
+	return releases, c.Get(fmt.Sprintf("/apps/%s/releases", appID), &releases)
+}
+
+// CreateRollback creates a deployment of a previously deployed release of an
+// app. If releaseID is empty, the release deployed before the current one is
+// used.
+func (c *Client) CreateRollback(appID, releaseID string) (*ct.Deployment, error) {
+	deployment := &ct.Deployment{}
+	return deployment, c.Post(fmt.Sprintf("/apps/%s/rollback", appID), &ct.Release{ID: releaseID}, deployment)
+}
+
 // RouteList returns all routes for an app.
 func (c *Client) RouteList(appID string) ([]*router.Route, error) {
 	var routes []*router.Route
@@ -217,6 +241,34 @@ func (c *Client) DeleteRoute(appID string, routeID string) error {
 	return c.Delete(fmt.Sprintf("/apps/%s/routes/%s", appID, routeID))
 }
 
+// DrainList returns all log drains for an app.
+func (c *Client) DrainList(appID string) ([]*ct.Drain, error) {
+	var drains []*ct.Drain
+	return drains, c.Get(fmt.Sprintf("/apps/%s/drains", appID), &drains)
+}
+
+// AllDrainList returns the log drains of all apps.
+func (c *Client) AllDrainList() ([]*ct.Drain, error) {
+	var drains []*ct.Drain
+	return drains, c.Get("/drains", &drains)
+}
+
+// GetDrain returns details for the drainID under the specified app.
+func (c *Client) GetDrain(appID, drainID string) (*ct.Drain, error) {
+	drain := &ct.Drain{}
+	return drain, c.Get(fmt.Sprintf("/apps/%s/drains/%s", appID, drainID), drain)
+}
+
+// CreateDrain creates a new log drain for the specified app.
+func (c *Client) CreateDrain(appID string, drain *ct.Drain) error {
+	return c.Post(fmt.Sprintf("/apps/%s/drains", appID), drain, drain)
+}
+
+// DeleteDrain deletes a log drain under the specified app.
+func (c *Client) DeleteDrain(appID, drainID string) error {
+	return c.Delete(fmt.Sprintf("/apps/%s/drains/%s", appID, drainID))
+}
+
 // GetFormation returns details for the specified formation under app and
 // release.
 func (c *Client) GetFormation(appID, releaseID string) (*ct.Formation, error) {
@@ -273,7 +325,21 @@ func (c *Client) DeployAppRelease(appID, releaseID string) error {
 	if err != nil {
 		return err
 	}
+	return c.waitForDeployment(d)
+}
+
+// RollbackAppRelease deploys a previously deployed release of an app and
+// waits for the deployment to complete, returning the release which was
+// deployed.
+func (c *Client) RollbackAppRelease(appID, releaseID string) (string, error) {
+	d, err := c.CreateRollback(appID, releaseID)
+	if err != nil {
+		return "", err
+	}
+	return d.NewReleaseID, c.waitForDeployment(d)
+}
 
+func (c *Client) waitForDeployment(d *ct.Deployment) error {
 	// if initial deploy, just stop here
 	if d.FinishedAt != nil {
 		return nil
@@ -289,8 +355,11 @@ outer:
 	for {
 		select {
 		case e := <-events:
-			if e.Status == "complete" {
+			switch e.Status {
+			case "complete":
 				break outer
+			case "failed":
+				return fmt.Errorf("Deployment failed, rolling back to release %s.", d.OldReleaseID)
 			}
 		case <-time.After(10 * time.Second):
 			return fmt.Errorf("Timed out waiting for deployment completion!")
@@ -313,6 +382,37 @@ func (c *Client) StreamJobEvents(appID string, lastID int64, output chan<- *ct.J
 	return httpclient.Stream(res, output), nil
 }
 
+// StreamAppLog streams the aggregated log lines of all of the jobs of appID
+// which match opts to output. If opts.Follow is true, new log lines are
+// streamed after the buffered log.
+func (c *Client) StreamAppLog(appID string, opts *ct.LogOpts, output chan<- *ct.LogMessage) (stream.Stream, error) {
+	query := url.Values{}
+	if opts != nil {
+		if opts.Lines > 0 {
+			query.Set("lines", strconv.Itoa(opts.Lines))
+		}
+		if opts.Follow {
+			query.Set("follow", "true")
+		}
+		if opts.ProcessType != "" {
+			query.Set("process_type", opts.ProcessType)
+		}
+		if opts.JobID != "" {
+			query.Set("job_id", opts.JobID)
+		}
+	}
+	path := fmt.Sprintf("/apps/%s/log", appID)
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	header := http.Header{"Accept": []string{"text/event-stream"}}
+	res, err := c.RawReq("GET", path, header, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return httpclient.Stream(res, output), nil
+}
+
 // GetJobLog returns a ReadCloser stream of the job with id of jobID, running
 // under appID. If tail is true, new log lines are streamed after the buffered
 // log.
@@ -350,6 +450,12 @@ func (c *Client) RunJobAttached(appID string, job *ct.NewJob) (httpclient.ReadWr
 	return c.Hijack("POST", fmt.Sprintf("/apps/%s/jobs", appID), http.Header{"Upgrade": {"flynn-attach/0"}}, job)
 }
 
+// ExecJob runs a command with a TTY in a running job, returning a
+// connection to it which uses the attach protocol.
+func (c *Client) ExecJob(appID, jobID string, req *ct.NewExec) (httpclient.ReadWriteCloser, error) {
+	return c.Hijack("POST", fmt.Sprintf("/apps/%s/jobs/%s/exec", appID, jobID), http.Header{"Upgrade": {"flynn-attach/0"}}, req)
+}
+
 // RunJobDetached runs a new job under the specified app, returning the job's
 // details.
 func (c *Client) RunJobDetached(appID string, req *ct.NewJob) (*ct.Job, error) {
@@ -363,6 +469,12 @@ func (c *Client) GetJob(appID, jobID string) (*ct.Job, error) {
 	return job, c.Get(fmt.Sprintf("/apps/%s/jobs/%s", appID, jobID), job)
 }
 
+// GetJobStats returns a sample of a running job's resource usage.
+func (c *Client) GetJobStats(appID, jobID string) (*host.JobStats, error) {
+	stats := &host.JobStats{}
+	return stats, c.Get(fmt.Sprintf("/apps/%s/jobs/%s/stats", appID, jobID), stats)
+}
+
 // JobList returns a list of all jobs.
 func (c *Client) JobList(appID string) ([]*ct.Job, error) {
 	var jobs []*ct.Job
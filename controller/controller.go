@@ -89,7 +89,14 @@ func main() {
 		hb.Close()
 	})
 
-	handler := appHandler(handlerConfig{db: db, cc: cc, sc: sc, pgxpool: pgxpool, key: os.Getenv("AUTH_KEY")})
+	handler := appHandler(handlerConfig{
+		db:               db,
+		cc:               cc,
+		sc:               sc,
+		pgxpool:          pgxpool,
+		key:              os.Getenv("AUTH_KEY"),
+		logaggregatorURL: os.Getenv("LOGAGGREGATOR_URL"),
+	})
 	shutdown.Fatal(http.ListenAndServe(addr, handler))
 }
 
@@ -99,6 +106,10 @@ type handlerConfig struct {
 	sc      routerc.Client
 	pgxpool *pgx.ConnPool
 	key     string
+
+	// logaggregatorURL is the base URL of the log aggregator, defaulting to
+	// its discoverd service address
+	logaggregatorURL string
 }
 
 // NOTE: this is temporary until httphelper supports custom errors
@@ -129,6 +140,9 @@ func appHandler(c handlerConfig) http.Handler {
 	if err != nil {
 		shutdown.Fatal(err)
 	}
+	if c.logaggregatorURL == "" {
+		c.logaggregatorURL = "http://flynn-logaggregator.discoverd"
+	}
 
 	providerRepo := NewProviderRepo(c.db)
 	keyRepo := NewKeyRepo(c.db)
@@ -139,6 +153,7 @@ func appHandler(c handlerConfig) http.Handler {
 	jobRepo := NewJobRepo(c.db)
 	formationRepo := NewFormationRepo(c.db, appRepo, releaseRepo, artifactRepo)
 	deploymentRepo := NewDeploymentRepo(c.db, c.pgxpool)
+	drainRepo := NewDrainRepo(c.db)
 
 	api := controllerAPI{
 		appRepo:        appRepo,
@@ -149,8 +164,11 @@ func appHandler(c handlerConfig) http.Handler {
 		jobRepo:        jobRepo,
 		resourceRepo:   resourceRepo,
 		deploymentRepo: deploymentRepo,
+		drainRepo:      drainRepo,
 		clusterClient:  c.cc,
 		routerc:        c.sc,
+
+		logaggregatorURL: c.logaggregatorURL,
 	}
 
 	httpRouter := httprouter.New()
@@ -175,17 +193,29 @@ func appHandler(c handlerConfig) http.Handler {
 	httpRouter.GET("/apps/:apps_id/jobs", httphelper.WrapHandler(api.appLookup(api.ListJobs)))
 	httpRouter.DELETE("/apps/:apps_id/jobs/:jobs_id", httphelper.WrapHandler(api.appLookup(api.KillJob)))
 	httpRouter.GET("/apps/:apps_id/jobs/:jobs_id/log", httphelper.WrapHandler(api.appLookup(api.JobLog)))
+	httpRouter.GET("/apps/:apps_id/jobs/:jobs_id/stats", httphelper.WrapHandler(api.appLookup(api.JobStats)))
+	httpRouter.POST("/apps/:apps_id/jobs/:jobs_id/exec", httphelper.WrapHandler(api.appLookup(api.ExecJob)))
+	httpRouter.GET("/apps/:apps_id/log", httphelper.WrapHandler(api.appLookup(api.AppLog)))
+
+	httpRouter.POST("/apps/:apps_id/drains", httphelper.WrapHandler(api.appLookup(api.CreateDrain)))
+	httpRouter.GET("/apps/:apps_id/drains", httphelper.WrapHandler(api.appLookup(api.GetAppDrains)))
+	httpRouter.GET("/apps/:apps_id/drains/:drains_id", httphelper.WrapHandler(api.appLookup(api.GetDrain)))
+	httpRouter.DELETE("/apps/:apps_id/drains/:drains_id", httphelper.WrapHandler(api.appLookup(api.DeleteDrain)))
+	httpRouter.GET("/drains", httphelper.WrapHandler(api.GetDrains))
 
 	httpRouter.POST("/apps/:apps_id/deploy", httphelper.WrapHandler(api.appLookup(api.CreateDeployment)))
 	httpRouter.GET("/deployments/:deployment_id", httphelper.WrapHandler(api.GetDeployment))
 
 	httpRouter.PUT("/apps/:apps_id/release", httphelper.WrapHandler(api.appLookup(api.SetAppRelease)))
 	httpRouter.GET("/apps/:apps_id/release", httphelper.WrapHandler(api.appLookup(api.GetAppRelease)))
+	httpRouter.GET("/apps/:apps_id/releases", httphelper.WrapHandler(api.appLookup(api.ListAppReleases)))
+	httpRouter.POST("/apps/:apps_id/rollback", httphelper.WrapHandler(api.appLookup(api.RollbackAppRelease)))
 
 	httpRouter.POST("/providers/:providers_id/resources", httphelper.WrapHandler(api.ProvisionResource))
 	httpRouter.GET("/providers/:providers_id/resources", httphelper.WrapHandler(api.GetProviderResources))
 	httpRouter.GET("/providers/:providers_id/resources/:resources_id", httphelper.WrapHandler(api.GetResource))
 	httpRouter.PUT("/providers/:providers_id/resources/:resources_id", httphelper.WrapHandler(api.PutResource))
+	httpRouter.DELETE("/providers/:providers_id/resources/:resources_id", httphelper.WrapHandler(api.DeleteResource))
 	httpRouter.GET("/apps/:apps_id/resources", httphelper.WrapHandler(api.appLookup(api.GetAppResources)))
 
 	httpRouter.POST("/apps/:apps_id/routes", httphelper.WrapHandler(api.appLookup(api.CreateRoute)))
@@ -225,8 +255,11 @@ type controllerAPI struct {
 	jobRepo        *JobRepo
 	resourceRepo   *ResourceRepo
 	deploymentRepo *DeploymentRepo
+	drainRepo      *DrainRepo
 	clusterClient  clusterClient
 	routerc        routerc.Client
+
+	logaggregatorURL string
 }
 
 func (c *controllerAPI) getApp(ctx context.Context) *ct.App {
@@ -29,10 +29,11 @@ func init() {
 func Test(t *testing.T) { TestingT(t) }
 
 type S struct {
-	cc  *tu.FakeCluster
-	srv *httptest.Server
-	hc  handlerConfig
-	c   *controller.Client
+	cc     *tu.FakeCluster
+	srv    *httptest.Server
+	logagg *fakeLogAggregator
+	hc     handlerConfig
+	c      *controller.Client
 }
 
 var _ = Suite(&S{})
@@ -67,7 +68,8 @@ func (s *S) SetUpSuite(c *C) {
 	}
 
 	s.cc = tu.NewFakeCluster()
-	s.hc = handlerConfig{db: pg, cc: s.cc, sc: newFakeRouter(), pgxpool: pgxpool, key: authKey}
+	s.logagg = newFakeLogAggregator()
+	s.hc = handlerConfig{db: pg, cc: s.cc, sc: newFakeRouter(), pgxpool: pgxpool, key: authKey, logaggregatorURL: s.logagg.URL}
 	handler := appHandler(s.hc)
 	s.srv = httptest.NewServer(handler)
 	client, err := controller.NewClient(s.srv.URL, authKey)
@@ -75,6 +77,10 @@ func (s *S) SetUpSuite(c *C) {
 	s.c = client
 }
 
+func (s *S) TearDownSuite(c *C) {
+	s.logagg.Close()
+}
+
 func (s *S) TestBadAuth(c *C) {
 	res, err := http.Get(s.srv.URL + "/apps")
 	c.Assert(err, IsNil)
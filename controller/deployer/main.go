@@ -131,7 +131,18 @@ func (c *context) HandleJob(job *que.Job) (e error) {
 				ReleaseID: deployment.NewReleaseID,
 				Status:    "failed",
 			}
-			e = c.rollback(log, deployment, f)
+			if e = c.rollback(log, deployment, f); e != nil {
+				return
+			}
+			log.Info("marking the deployment as done")
+			if err := c.setDeploymentDone(deployment.ID); err != nil {
+				log.Error("error marking the deployment as done", "err", err)
+			}
+			// signal that the old release is running again
+			events <- ct.DeploymentEvent{
+				ReleaseID: deployment.OldReleaseID,
+				Status:    "rolled_back",
+			}
 		}
 	}()
 	log.Info("performing deployment")
@@ -166,6 +177,7 @@ func (c *context) rollback(l log15.Logger, deployment *ct.Deployment, original *
 		return err
 	}
 
+	// deleting the new formation scales it to zero
 	log.Info("deleting the new formation")
 	if err := c.client.DeleteFormation(deployment.AppID, deployment.NewReleaseID); err != nil {
 		log.Error("error deleting the new formation:", "err", err)
@@ -0,0 +1,242 @@
+package strategy
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/gopkg.in/inconshreveable/log15.v2"
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+// App meta keys which configure the canary strategy.
+const (
+	canaryCountKey = "canary_count"
+	canarySoakKey  = "canary_soak_period"
+)
+
+const (
+	defaultCanaryCount = 1
+	defaultCanarySoak  = 30 * time.Second
+)
+
+// canaryConfig returns the number of canary jobs to start per process type
+// and how long to watch them for crashes before promoting the release.
+func canaryConfig(app *ct.App) (int, time.Duration, error) {
+	count, soak := defaultCanaryCount, defaultCanarySoak
+	if s, ok := app.Meta[canaryCountKey]; ok {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid %s app meta: %q", canaryCountKey, s)
+		}
+		count = n
+	}
+	if s, ok := app.Meta[canarySoakKey]; ok {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return 0, 0, fmt.Errorf("invalid %s app meta: %q", canarySoakKey, s)
+		}
+		soak = d
+	}
+	return count, soak, nil
+}
+
+func canary(l log15.Logger, client *controller.Client, d *ct.Deployment, events chan<- ct.DeploymentEvent) error {
+	log := l.New("fn", "canary", "deployment_id", d.ID, "app_id", d.AppID)
+	log.Info("starting canary deployment")
+
+	log.Info("getting app")
+	app, err := client.GetApp(d.AppID)
+	if err != nil {
+		log.Error("error getting app", "err", err)
+		return err
+	}
+	count, soak, err := canaryConfig(app)
+	if err != nil {
+		log.Error("error getting canary config", "err", err)
+		return err
+	}
+
+	log.Info("getting job event stream")
+	jobStream := make(chan *ct.JobEvent)
+	stream, err := client.StreamJobEvents(d.AppID, 0, jobStream)
+	if err != nil {
+		log.Error("error getting job event stream", "err", err)
+		return err
+	}
+	defer stream.Close()
+
+	olog := log.New("release_id", d.OldReleaseID)
+	olog.Info("getting old formation")
+	f, err := client.GetFormation(d.AppID, d.OldReleaseID)
+	if err != nil {
+		olog.Error("error getting old formation", "err", err)
+		return err
+	}
+
+	canaryProcesses := make(map[string]int, len(f.Processes))
+	for typ, n := range f.Processes {
+		if n == 0 {
+			continue
+		}
+		if n > count {
+			n = count
+		}
+		canaryProcesses[typ] = n
+	}
+
+	nlog := log.New("release_id", d.NewReleaseID)
+	nlog.Info("creating canary formation", "processes", canaryProcesses)
+	if err := client.PutFormation(&ct.Formation{
+		AppID:     d.AppID,
+		ReleaseID: d.NewReleaseID,
+		Processes: canaryProcesses,
+	}); err != nil {
+		nlog.Error("error creating canary formation", "err", err)
+		return err
+	}
+
+	expected := make(jobEvents)
+	for typ, n := range canaryProcesses {
+		for i := 0; i < n; i++ {
+			events <- ct.DeploymentEvent{
+				ReleaseID: d.NewReleaseID,
+				JobState:  "starting",
+				JobType:   typ,
+			}
+		}
+		expected[typ] = map[string]int{"up": n}
+	}
+	nlog.Info("waiting for canary job events", "expected", expected)
+	if err := waitForJobEvents(jobStream, events, d.NewReleaseID, expected, nlog); err != nil {
+		nlog.Error("error waiting for canary job events", "err", err)
+		return abortCanary(nlog, client, d, canaryProcesses, events, err)
+	}
+
+	events <- ct.DeploymentEvent{
+		ReleaseID: d.NewReleaseID,
+		JobState:  "soaking",
+	}
+	nlog.Info("watching canary jobs", "soak_period", soak)
+	if err := watchForCrashes(jobStream, events, d.NewReleaseID, soak, nlog); err != nil {
+		nlog.Error("canary job crashed during soak period", "err", err)
+		return abortCanary(nlog, client, d, canaryProcesses, events, err)
+	}
+
+	events <- ct.DeploymentEvent{
+		ReleaseID: d.NewReleaseID,
+		JobState:  "promoting",
+	}
+	nlog.Info("scaling new formation to full size", "processes", f.Processes)
+	if err := client.PutFormation(&ct.Formation{
+		AppID:     d.AppID,
+		ReleaseID: d.NewReleaseID,
+		Processes: f.Processes,
+	}); err != nil {
+		nlog.Error("error scaling new formation to full size", "err", err)
+		return err
+	}
+
+	expected = make(jobEvents)
+	for typ, n := range f.Processes {
+		remaining := n - canaryProcesses[typ]
+		if remaining == 0 {
+			continue
+		}
+		for i := 0; i < remaining; i++ {
+			events <- ct.DeploymentEvent{
+				ReleaseID: d.NewReleaseID,
+				JobState:  "starting",
+				JobType:   typ,
+			}
+		}
+		expected[typ] = map[string]int{"up": remaining}
+	}
+	if len(expected) > 0 {
+		nlog.Info("waiting for job events", "expected", expected)
+		if err := waitForJobEvents(jobStream, events, d.NewReleaseID, expected, nlog); err != nil {
+			nlog.Error("error waiting for job events", "err", err)
+			return err
+		}
+	}
+
+	olog.Info("scaling old formation to zero")
+	if err := client.PutFormation(&ct.Formation{
+		AppID:     d.AppID,
+		ReleaseID: d.OldReleaseID,
+	}); err != nil {
+		olog.Error("error scaling old formation to zero", "err", err)
+		return err
+	}
+
+	expected = make(jobEvents)
+	for typ, n := range f.Processes {
+		for i := 0; i < n; i++ {
+			events <- ct.DeploymentEvent{
+				ReleaseID: d.OldReleaseID,
+				JobState:  "stopping",
+				JobType:   typ,
+			}
+		}
+		expected[typ] = map[string]int{"down": n}
+	}
+	olog.Info("waiting for job events", "expected", expected)
+	if err := waitForJobEvents(jobStream, events, d.OldReleaseID, expected, olog); err != nil {
+		olog.Error("error waiting for job events", "err", err)
+		return err
+	}
+	log.Info("finished canary deployment")
+	return nil
+}
+
+// abortCanary scales the canary formation back to zero and returns the error
+// which caused the abort.
+func abortCanary(log log15.Logger, client *controller.Client, d *ct.Deployment, processes map[string]int, events chan<- ct.DeploymentEvent, cause error) error {
+	log.Warn("aborting canary deployment", "err", cause)
+	if err := client.PutFormation(&ct.Formation{
+		AppID:     d.AppID,
+		ReleaseID: d.NewReleaseID,
+	}); err != nil {
+		log.Error("error scaling canary formation to zero", "err", err)
+		return err
+	}
+	for typ, n := range processes {
+		for i := 0; i < n; i++ {
+			events <- ct.DeploymentEvent{
+				ReleaseID: d.NewReleaseID,
+				JobState:  "stopping",
+				JobType:   typ,
+			}
+		}
+	}
+	return cause
+}
+
+// watchForCrashes watches job events for the given release for the soak
+// period, returning an error if any job crashes.
+func watchForCrashes(events chan *ct.JobEvent, deployEvents chan<- ct.DeploymentEvent, releaseID string, soak time.Duration, log log15.Logger) error {
+	timeout := time.After(soak)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return fmt.Errorf("job event stream closed")
+			}
+			if event.Job.ReleaseID != releaseID {
+				continue
+			}
+			log.Info("got job event", "job_id", event.JobID, "type", event.Type, "state", event.State)
+			if event.State == "crashed" {
+				deployEvents <- ct.DeploymentEvent{
+					ReleaseID: releaseID,
+					JobState:  "crashed",
+					JobType:   event.Type,
+				}
+				return fmt.Errorf("job crashed!")
+			}
+		case <-timeout:
+			return nil
+		}
+	}
+}
@@ -14,6 +14,7 @@ type PerformFunc func(log15.Logger, *controller.Client, *ct.Deployment, chan<- c
 var performFuncs = map[string]PerformFunc{
 	"all-at-once": allAtOnce,
 	"one-by-one":  oneByOne,
+	"canary":      canary,
 }
 
 func Get(strategy string) (PerformFunc, error) {
@@ -132,9 +132,10 @@ func (c *controllerAPI) CreateDeployment(ctx context.Context, w http.ResponseWri
 		respondWithError(w, err)
 		return
 	}
-	release := rel.(*ct.Release)
-	app := c.getApp(ctx)
+	c.createDeployment(w, c.getApp(ctx), rel.(*ct.Release))
+}
 
+func (c *controllerAPI) createDeployment(w http.ResponseWriter, app *ct.App, release *ct.Release) {
 	// TODO: wrap all of this in a transaction
 	oldRelease, err := c.appRepo.GetRelease(app.ID)
 	if err == ErrNotFound {
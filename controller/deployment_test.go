@@ -79,4 +79,66 @@ func (s *S) TestStreamDeployment(c *C) {
 	case <-time.After(time.Second):
 		c.Fatal("Timed out waiting for event")
 	}
+
+	createDeploymentEvent(ct.DeploymentEvent{DeploymentID: d.ID, ReleaseID: newRelease.ID, Status: "failed"})
+	createDeploymentEvent(ct.DeploymentEvent{DeploymentID: d.ID, ReleaseID: release.ID, Status: "rolled_back"})
+	for _, status := range []string{"failed", "rolled_back"} {
+		select {
+		case e := <-events:
+			c.Assert(e.Status, Equals, status)
+		case <-time.After(time.Second):
+			c.Fatal("Timed out waiting for event")
+		}
+	}
+}
+
+func (s *S) TestRollbackDeployment(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "rollback-deployment"})
+	release := s.createTestRelease(c, &ct.Release{})
+	c.Assert(s.c.PutFormation(&ct.Formation{
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		Processes: map[string]int{"web": 1},
+	}), IsNil)
+
+	// rolling back without any history should error
+	_, err := s.c.CreateRollback(app.ID, "")
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.ValidationError)
+
+	d, err := s.c.CreateDeployment(app.ID, release.ID)
+	c.Assert(err, IsNil)
+	c.Assert(d.FinishedAt, NotNil)
+
+	newRelease := s.createTestRelease(c, &ct.Release{})
+	d, err = s.c.CreateDeployment(app.ID, newRelease.ID)
+	c.Assert(err, IsNil)
+
+	// fake the deployer completing the deployment
+	c.Assert(s.hc.db.Exec("UPDATE deployments SET finished_at = now() WHERE deployment_id = $1", d.ID), IsNil)
+	c.Assert(s.c.SetAppRelease(app.ID, newRelease.ID), IsNil)
+
+	releases, err := s.c.AppReleaseList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(releases, HasLen, 2)
+	c.Assert(releases[0].ID, Equals, newRelease.ID)
+	c.Assert(releases[1].ID, Equals, release.ID)
+	c.Assert(releases[0].DeployedAt, NotNil)
+	c.Assert(releases[1].DeployedAt, NotNil)
+	c.Assert(releases[0].DeployedAt.Before(*releases[1].DeployedAt), Equals, false)
+
+	// rolling back to a release which was never deployed should error
+	otherRelease := s.createTestRelease(c, &ct.Release{})
+	_, err = s.c.CreateRollback(app.ID, otherRelease.ID)
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.ValidationError)
+
+	// rolling back to the current release should error
+	_, err = s.c.CreateRollback(app.ID, newRelease.ID)
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.ValidationError)
+
+	// rolling back without a release ID uses the previous release
+	d, err = s.c.CreateRollback(app.ID, "")
+	c.Assert(err, IsNil)
+	c.Assert(d.AppID, Equals, app.ID)
+	c.Assert(d.OldReleaseID, Equals, newRelease.ID)
+	c.Assert(d.NewReleaseID, Equals, release.ID)
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-sql"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/pq"
+	"github.com/flynn/flynn/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/flynn/flynn/controller/schema"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/ctxhelper"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/postgres"
+)
+
+type DrainRepo struct {
+	db *postgres.DB
+}
+
+func NewDrainRepo(db *postgres.DB) *DrainRepo {
+	return &DrainRepo{db}
+}
+
+func validateDrainURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "syslog" && u.Scheme != "syslog+tls") {
+		return ct.ValidationError{Field: "url", Message: "must be a syslog:// or syslog+tls:// URL"}
+	}
+	if _, port, err := net.SplitHostPort(u.Host); err != nil || port == "" {
+		return ct.ValidationError{Field: "url", Message: "must include a host and port"}
+	}
+	return nil
+}
+
+func (r *DrainRepo) Add(drain *ct.Drain) error {
+	if err := validateDrainURL(drain.URL); err != nil {
+		return err
+	}
+	err := r.db.QueryRow("INSERT INTO drains (app_id, url) VALUES ($1, $2) RETURNING drain_id, created_at", drain.AppID, drain.URL).Scan(&drain.ID, &drain.CreatedAt)
+	if e, ok := err.(*pq.Error); ok && e.Code.Name() == "unique_violation" {
+		return ct.ValidationError{Field: "url", Message: "is already a drain for this app"}
+	}
+	drain.ID = postgres.CleanUUID(drain.ID)
+	return err
+}
+
+func scanDrain(s postgres.Scanner) (*ct.Drain, error) {
+	drain := &ct.Drain{}
+	err := s.Scan(&drain.ID, &drain.AppID, &drain.URL, &drain.CreatedAt)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	drain.ID = postgres.CleanUUID(drain.ID)
+	drain.AppID = postgres.CleanUUID(drain.AppID)
+	return drain, err
+}
+
+func (r *DrainRepo) Get(id string) (*ct.Drain, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	row := r.db.QueryRow("SELECT drain_id, app_id, url, created_at FROM drains WHERE drain_id = $1 AND deleted_at IS NULL", id)
+	return scanDrain(row)
+}
+
+func (r *DrainRepo) Remove(id string) error {
+	return r.db.Exec("UPDATE drains SET deleted_at = now() WHERE drain_id = $1 AND deleted_at IS NULL", id)
+}
+
+// List returns the drains of all apps.
+func (r *DrainRepo) List() ([]*ct.Drain, error) {
+	rows, err := r.db.Query("SELECT drain_id, app_id, url, created_at FROM drains WHERE deleted_at IS NULL ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	return scanDrains(rows)
+}
+
+func (r *DrainRepo) AppList(appID string) ([]*ct.Drain, error) {
+	rows, err := r.db.Query("SELECT drain_id, app_id, url, created_at FROM drains WHERE app_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC", appID)
+	if err != nil {
+		return nil, err
+	}
+	return scanDrains(rows)
+}
+
+func scanDrains(rows *sql.Rows) ([]*ct.Drain, error) {
+	drains := []*ct.Drain{}
+	for rows.Next() {
+		drain, err := scanDrain(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		drains = append(drains, drain)
+	}
+	return drains, rows.Err()
+}
+
+func (c *controllerAPI) getDrain(ctx context.Context) (*ct.Drain, error) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+	drain, err := c.drainRepo.Get(params.ByName("drains_id"))
+	if err != nil {
+		return nil, err
+	}
+	if drain.AppID != c.getApp(ctx).ID {
+		return nil, ErrNotFound
+	}
+	return drain, nil
+}
+
+func (c *controllerAPI) CreateDrain(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var drain ct.Drain
+	if err := httphelper.DecodeJSON(req, &drain); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := schema.Validate(drain); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	drain.AppID = c.getApp(ctx).ID
+	if err := c.drainRepo.Add(&drain); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &drain)
+}
+
+func (c *controllerAPI) GetDrain(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	drain, err := c.getDrain(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, drain)
+}
+
+func (c *controllerAPI) GetAppDrains(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	drains, err := c.drainRepo.AppList(c.getApp(ctx).ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, drains)
+}
+
+func (c *controllerAPI) DeleteDrain(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	drain, err := c.getDrain(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := c.drainRepo.Remove(drain.ID); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	w.WriteHeader(200)
+}
+
+// GetDrains returns the drains of all apps, which the log aggregator
+// forwards logs to.
+func (c *controllerAPI) GetDrains(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	drains, err := c.drainRepo.List()
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, drains)
+}
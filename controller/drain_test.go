@@ -0,0 +1,76 @@
+package main
+
+import (
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+)
+
+func (s *S) createTestDrain(c *C, appID string, in *ct.Drain) *ct.Drain {
+	c.Assert(s.c.CreateDrain(appID, in), IsNil)
+	return in
+}
+
+func (s *S) TestCreateDrain(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "create-drain"})
+	drain := s.createTestDrain(c, app.Name, &ct.Drain{URL: "syslog+tls://logs.example.com:6514"})
+	c.Assert(drain.ID, Not(Equals), "")
+	c.Assert(drain.AppID, Equals, app.ID)
+	c.Assert(drain.CreatedAt, NotNil)
+
+	gotDrain, err := s.c.GetDrain(app.ID, drain.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotDrain.URL, Equals, drain.URL)
+
+	// the same URL cannot be added twice
+	err = s.c.CreateDrain(app.ID, &ct.Drain{URL: drain.URL})
+	c.Assert(err, NotNil)
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.ValidationError)
+}
+
+func (s *S) TestCreateInvalidDrain(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "create-invalid-drain"})
+	for _, u := range []string{"http://logs.example.com:514", "syslog://logs.example.com", "logs.example.com:514"} {
+		err := s.c.CreateDrain(app.ID, &ct.Drain{URL: u})
+		c.Assert(err, NotNil, Commentf("url = %s", u))
+		c.Assert(err.(hh.JSONError).Code, Equals, hh.ValidationError)
+	}
+}
+
+func (s *S) TestDeleteDrain(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "delete-drain"})
+	other := s.createTestApp(c, &ct.App{Name: "delete-drain-other"})
+	drain := s.createTestDrain(c, app.ID, &ct.Drain{URL: "syslog://logs.example.com:514"})
+
+	// drains are only accessible through their own app
+	_, err := s.c.GetDrain(other.ID, drain.ID)
+	c.Assert(err, Equals, controller.ErrNotFound)
+	c.Assert(s.c.DeleteDrain(other.ID, drain.ID), Equals, controller.ErrNotFound)
+
+	c.Assert(s.c.DeleteDrain(app.ID, drain.ID), IsNil)
+	_, err = s.c.GetDrain(app.ID, drain.ID)
+	c.Assert(err, Equals, controller.ErrNotFound)
+}
+
+func (s *S) TestListDrains(c *C) {
+	app0 := s.createTestApp(c, &ct.App{Name: "list-drains1"})
+	app1 := s.createTestApp(c, &ct.App{Name: "list-drains2"})
+	drain0 := s.createTestDrain(c, app0.ID, &ct.Drain{URL: "syslog://logs.example.com:514"})
+	drain1 := s.createTestDrain(c, app0.ID, &ct.Drain{URL: "syslog://logs.example.com:515"})
+	drain2 := s.createTestDrain(c, app1.ID, &ct.Drain{URL: "syslog://logs.example.com:514"})
+
+	drains, err := s.c.DrainList(app0.ID)
+	c.Assert(err, IsNil)
+	c.Assert(drains, HasLen, 2)
+	c.Assert(drains[0].ID, Equals, drain1.ID)
+	c.Assert(drains[1].ID, Equals, drain0.ID)
+
+	all, err := s.c.AllDrainList()
+	c.Assert(err, IsNil)
+	ids := make(map[string]bool, len(all))
+	for _, d := range all {
+		ids[d.ID] = true
+	}
+	c.Assert(ids[drain0.ID] && ids[drain1.ID] && ids[drain2.ID], Equals, true)
+}
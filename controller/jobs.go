@@ -56,23 +56,27 @@ func NewJobRepo(db *postgres.DB) *JobRepo {
 }
 
 func (r *JobRepo) Get(id string) (*ct.Job, error) {
-	row := r.db.QueryRow("SELECT concat(host_id, '-', job_id), app_id, release_id, process_type, state, meta, created_at, updated_at FROM job_cache WHERE concat(host_id, '-', job_id) = $1", id)
+	row := r.db.QueryRow("SELECT concat_ws('-', NULLIF(host_id, ''), job_id), app_id, release_id, process_type, state, error, meta, created_at, updated_at FROM job_cache WHERE concat_ws('-', NULLIF(host_id, ''), job_id) = $1", id)
 	return scanJob(row)
 }
 
 func (r *JobRepo) Add(job *ct.Job) error {
 	hostID, jobID, err := cluster.ParseJobID(job.ID)
+	if err != nil && job.State == "failed" && !strings.Contains(job.ID, "-") {
+		// jobs which the scheduler failed to place have no host
+		hostID, jobID, err = "", job.ID, nil
+	}
 	if err != nil {
 		log.Printf("Unable to parse hostID from %q", job.ID)
 		return ErrNotFound
 	}
 	meta := metaToHstore(job.Meta)
 	// TODO: actually validate
-	err = r.db.QueryRow("INSERT INTO job_cache (job_id, host_id, app_id, release_id, process_type, state, meta) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at, updated_at",
-		jobID, hostID, job.AppID, job.ReleaseID, job.Type, job.State, meta).Scan(&job.CreatedAt, &job.UpdatedAt)
+	err = r.db.QueryRow("INSERT INTO job_cache (job_id, host_id, app_id, release_id, process_type, state, error, meta) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING created_at, updated_at",
+		jobID, hostID, job.AppID, job.ReleaseID, job.Type, job.State, job.Error, meta).Scan(&job.CreatedAt, &job.UpdatedAt)
 	if e, ok := err.(*pq.Error); ok && e.Code.Name() == "unique_violation" {
-		err = r.db.QueryRow("UPDATE job_cache SET state = $3, updated_at = now() WHERE job_id = $1 AND host_id = $2 RETURNING created_at, updated_at",
-			jobID, hostID, job.State).Scan(&job.CreatedAt, &job.UpdatedAt)
+		err = r.db.QueryRow("UPDATE job_cache SET state = $3, error = $4, updated_at = now() WHERE job_id = $1 AND host_id = $2 RETURNING created_at, updated_at",
+			jobID, hostID, job.State, job.Error).Scan(&job.CreatedAt, &job.UpdatedAt)
 	}
 	if err != nil {
 		return err
@@ -83,7 +87,7 @@ func (r *JobRepo) Add(job *ct.Job) error {
 func scanJob(s postgres.Scanner) (*ct.Job, error) {
 	job := &ct.Job{}
 	var meta hstore.Hstore
-	err := s.Scan(&job.ID, &job.AppID, &job.ReleaseID, &job.Type, &job.State, &meta, &job.CreatedAt, &job.UpdatedAt)
+	err := s.Scan(&job.ID, &job.AppID, &job.ReleaseID, &job.Type, &job.State, &job.Error, &meta, &job.CreatedAt, &job.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			err = ErrNotFound
@@ -102,7 +106,7 @@ func scanJob(s postgres.Scanner) (*ct.Job, error) {
 }
 
 func (r *JobRepo) List(appID string) ([]*ct.Job, error) {
-	rows, err := r.db.Query("SELECT concat(host_id, '-', job_id), app_id, release_id, process_type, state, meta, created_at, updated_at FROM job_cache WHERE app_id = $1 ORDER BY created_at DESC", appID)
+	rows, err := r.db.Query("SELECT concat_ws('-', NULLIF(host_id, ''), job_id), app_id, release_id, process_type, state, error, meta, created_at, updated_at FROM job_cache WHERE app_id = $1 ORDER BY created_at DESC", appID)
 	if err != nil {
 		return nil, err
 	}
@@ -119,7 +123,7 @@ func (r *JobRepo) List(appID string) ([]*ct.Job, error) {
 }
 
 func (r *JobRepo) listEvents(appID string, sinceID int64, count int) ([]*ct.JobEvent, error) {
-	query := "SELECT event_id, concat(job_events.host_id, '-', job_events.job_id), job_events.app_id, job_cache.release_id, job_cache.process_type, job_events.state, job_events.created_at FROM job_events INNER JOIN job_cache ON job_events.job_id = job_cache.job_id AND job_events.host_id = job_cache.host_id WHERE job_events.app_id = $1 AND event_id > $2 ORDER BY event_id DESC"
+	query := "SELECT event_id, concat_ws('-', NULLIF(job_events.host_id, ''), job_events.job_id), job_events.app_id, job_cache.release_id, job_cache.process_type, job_events.state, job_cache.error, job_events.created_at FROM job_events INNER JOIN job_cache ON job_events.job_id = job_cache.job_id AND job_events.host_id = job_cache.host_id WHERE job_events.app_id = $1 AND event_id > $2 ORDER BY event_id DESC"
 	args := []interface{}{appID, sinceID}
 	if count > 0 {
 		query += " LIMIT $3"
@@ -142,13 +146,13 @@ func (r *JobRepo) listEvents(appID string, sinceID int64, count int) ([]*ct.JobE
 }
 
 func (r *JobRepo) getEvent(eventID int64) (*ct.JobEvent, error) {
-	row := r.db.QueryRow("SELECT event_id, concat(job_events.host_id, '-', job_events.job_id), job_events.app_id, job_cache.release_id, job_cache.process_type, job_events.state, job_events.created_at FROM job_events INNER JOIN job_cache ON job_events.job_id = job_cache.job_id AND job_events.host_id = job_cache.host_id WHERE job_events.event_id = $1", eventID)
+	row := r.db.QueryRow("SELECT event_id, concat_ws('-', NULLIF(job_events.host_id, ''), job_events.job_id), job_events.app_id, job_cache.release_id, job_cache.process_type, job_events.state, job_cache.error, job_events.created_at FROM job_events INNER JOIN job_cache ON job_events.job_id = job_cache.job_id AND job_events.host_id = job_cache.host_id WHERE job_events.event_id = $1", eventID)
 	return scanJobEvent(row)
 }
 
 func scanJobEvent(s postgres.Scanner) (*ct.JobEvent, error) {
 	event := &ct.JobEvent{}
-	err := s.Scan(&event.ID, &event.JobID, &event.AppID, &event.ReleaseID, &event.Type, &event.State, &event.CreatedAt)
+	err := s.Scan(&event.ID, &event.JobID, &event.AppID, &event.ReleaseID, &event.Type, &event.State, &event.Error, &event.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			err = ErrNotFound
@@ -299,6 +303,20 @@ func (c *controllerAPI) JobLog(ctx context.Context, w http.ResponseWriter, req *
 	}
 }
 
+func (c *controllerAPI) JobStats(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	hc, jobID, err := c.connectHost(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	stats, err := hc.GetJobStats(jobID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, stats)
+}
+
 func streamJobs(ctx context.Context, req *http.Request, w http.ResponseWriter, app *ct.App, repo *JobRepo) (err error) {
 	var lastID int64
 	if req.Header.Get("Last-Event-Id") != "" {
@@ -502,25 +520,7 @@ func (c *controllerAPI) RunJob(ctx context.Context, w http.ResponseWriter, req *
 			respondWithError(w, fmt.Errorf("attach wait failed: %s", err.Error()))
 			return
 		}
-		w.Header().Set("Connection", "upgrade")
-		w.Header().Set("Upgrade", "flynn-attach/0")
-		w.WriteHeader(http.StatusSwitchingProtocols)
-		conn, _, err := w.(http.Hijacker).Hijack()
-		if err != nil {
-			panic(err)
-		}
-		defer conn.Close()
-
-		done := make(chan struct{}, 2)
-		cp := func(to io.Writer, from io.Reader) {
-			io.Copy(to, from)
-			done <- struct{}{}
-		}
-		go cp(conn, attachClient.Conn())
-		go cp(attachClient.Conn(), conn)
-		<-done
-		<-done
-
+		proxyAttach(w, attachClient)
 		return
 	} else {
 		httphelper.JSON(w, 200, &ct.Job{
@@ -530,3 +530,57 @@ func (c *controllerAPI) RunJob(ctx context.Context, w http.ResponseWriter, req *
 		})
 	}
 }
+
+func (c *controllerAPI) ExecJob(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var newExec ct.NewExec
+	if err := httphelper.DecodeJSON(req, &newExec); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := schema.Validate(newExec); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	hc, jobID, err := c.connectHost(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	attachClient, err := hc.Exec(&host.ExecReq{
+		JobID:  jobID,
+		Cmd:    newExec.Cmd,
+		Env:    newExec.Env,
+		Height: uint16(newExec.Lines),
+		Width:  uint16(newExec.Columns),
+	})
+	if err != nil {
+		respondWithError(w, fmt.Errorf("exec failed: %s", err.Error()))
+		return
+	}
+	defer attachClient.Close()
+	proxyAttach(w, attachClient)
+}
+
+// proxyAttach upgrades the request's connection and copies the attach stream
+// between it and the host until either side closes.
+func proxyAttach(w http.ResponseWriter, attachClient cluster.AttachClient) {
+	w.Header().Set("Connection", "upgrade")
+	w.Header().Set("Upgrade", "flynn-attach/0")
+	w.WriteHeader(http.StatusSwitchingProtocols)
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+
+	done := make(chan struct{}, 2)
+	cp := func(to io.Writer, from io.Reader) {
+		io.Copy(to, from)
+		done <- struct{}{}
+	}
+	go cp(conn, attachClient.Conn())
+	go cp(attachClient.Conn(), conn)
+	<-done
+	<-done
+}
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
 	"github.com/flynn/flynn/controller/client"
@@ -53,6 +54,25 @@ func (s *S) TestJobGet(c *C) {
 	c.Assert(job.Meta, DeepEquals, map[string]string{"some": "info"})
 }
 
+func (s *S) TestFailedJob(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "job-failed"})
+	release := s.createTestRelease(c, &ct.Release{})
+	s.createTestFormation(c, &ct.Formation{ReleaseID: release.ID, AppID: app.ID})
+
+	// jobs which failed to be placed have no host in their ID
+	jobID := random.UUID()
+	s.createTestJob(c, &ct.Job{ID: jobID, AppID: app.ID, ReleaseID: release.ID, Type: "web", State: "failed", Error: "no capacity"})
+
+	job, err := s.c.GetJob(app.ID, jobID)
+	c.Assert(err, IsNil)
+	c.Assert(job.ID, Equals, jobID)
+	c.Assert(job.State, Equals, "failed")
+	c.Assert(job.Error, Equals, "no capacity")
+
+	// other jobs must still have a host
+	c.Assert(s.c.PutJob(&ct.Job{ID: random.UUID(), AppID: app.ID, ReleaseID: release.ID, Type: "web", State: "up"}), NotNil)
+}
+
 func newFakeLog(r io.Reader) *fakeLog {
 	return &fakeLog{r}
 }
@@ -76,6 +96,21 @@ func (s *S) TestKillJob(c *C) {
 	c.Assert(hc.IsStopped(jobID), Equals, true)
 }
 
+func (s *S) TestJobStats(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "jobstats"})
+	hostID, jobID := random.UUID(), random.UUID()
+	hc := tu.NewFakeHostClient(hostID)
+	hc.SetJobStats(jobID, &host.JobStats{JobID: jobID, MemoryUsage: 1024, CPUTime: time.Second, Processes: 2})
+	s.cc.SetHostClient(hostID, hc)
+
+	stats, err := s.c.GetJobStats(app.ID, hostID+"-"+jobID)
+	c.Assert(err, IsNil)
+	c.Assert(stats.JobID, Equals, jobID)
+	c.Assert(stats.MemoryUsage, Equals, int64(1024))
+	c.Assert(stats.CPUTime, Equals, time.Second)
+	c.Assert(stats.Processes, Equals, 2)
+}
+
 func (s *S) createLogTestApp(c *C, name string, stream io.Reader) (*ct.App, string, string) {
 	app := s.createTestApp(c, &ct.App{Name: name})
 	hostID, jobID := random.UUID(), random.UUID()
@@ -296,3 +331,52 @@ func (s *S) TestRunJobAttached(c *C) {
 	c.Assert(job.Config.Env, DeepEquals, map[string]string{"FOO": "baz", "JOB": "true", "RELEASE": "true"})
 	c.Assert(job.Config.Stdin, Equals, true)
 }
+
+func (s *S) TestExecJob(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "exec-job"})
+	hostID, jobID := random.UUID(), random.UUID()
+	hc := tu.NewFakeHostClient(hostID)
+
+	done := make(chan struct{})
+	hc.SetExecFunc(jobID, func(req *host.ExecReq) (cluster.AttachClient, error) {
+		c.Assert(req, DeepEquals, &host.ExecReq{
+			JobID:  jobID,
+			Cmd:    []string{"sh"},
+			Env:    map[string]string{"TERM": "xterm"},
+			Height: 20,
+			Width:  10,
+		})
+		pipeR, pipeW := io.Pipe()
+		go func() {
+			stdin, err := ioutil.ReadAll(pipeR)
+			c.Assert(err, IsNil)
+			c.Assert(string(stdin), Equals, "test in")
+			close(done)
+		}()
+		return cluster.NewAttachClient(struct {
+			io.Reader
+			io.WriteCloser
+		}{strings.NewReader("test out"), pipeW}), nil
+	})
+	s.cc.SetHostClient(hostID, hc)
+
+	rwc, err := s.c.ExecJob(app.ID, hostID+"-"+jobID, &ct.NewExec{
+		Cmd:     []string{"sh"},
+		Env:     map[string]string{"TERM": "xterm"},
+		Columns: 10,
+		Lines:   20,
+	})
+	c.Assert(err, IsNil)
+	_, err = rwc.Write([]byte("test in"))
+	c.Assert(err, IsNil)
+	rwc.CloseWrite()
+	stdout, err := ioutil.ReadAll(rwc)
+	c.Assert(err, IsNil)
+	c.Assert(string(stdout), Equals, "test out")
+	rwc.Close()
+	<-done
+
+	// a command is required
+	_, err = s.c.ExecJob(app.ID, hostID+"-"+jobID, &ct.NewExec{})
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+// fakeLogAggregator records the requests made to it and responds with a
+// single log line for the requested app.
+type fakeLogAggregator struct {
+	*httptest.Server
+
+	mtx  sync.Mutex
+	reqs []*http.Request
+}
+
+func newFakeLogAggregator() *fakeLogAggregator {
+	l := &fakeLogAggregator{}
+	l.Server = httptest.NewServer(http.HandlerFunc(l.serve))
+	return l
+}
+
+func (l *fakeLogAggregator) serve(w http.ResponseWriter, req *http.Request) {
+	l.mtx.Lock()
+	l.reqs = append(l.reqs, req)
+	l.mtx.Unlock()
+
+	data, _ := json.Marshal(&ct.LogMessage{
+		AppID:       req.URL.Path,
+		JobID:       "host-job",
+		ProcessType: req.FormValue("process_type"),
+		Stream:      "stdout",
+		Message:     "hello",
+	})
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+func (l *fakeLogAggregator) lastRequest() *http.Request {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.reqs[len(l.reqs)-1]
+}
+
+func (s *S) TestAppLog(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "app-log"})
+
+	ch := make(chan *ct.LogMessage)
+	stream, err := s.c.StreamAppLog(app.Name, &ct.LogOpts{Follow: true, Lines: 10, ProcessType: "web"}, ch)
+	c.Assert(err, IsNil)
+	var msgs []*ct.LogMessage
+	for msg := range ch {
+		msgs = append(msgs, msg)
+	}
+	c.Assert(stream.Err(), IsNil)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Message, Equals, "hello")
+
+	// the request is proxied to the aggregator using the app ID, without the
+	// controller auth key
+	req := s.logagg.lastRequest()
+	c.Assert(req.URL.Path, Equals, "/apps/"+app.ID+"/log")
+	c.Assert(req.URL.Query(), DeepEquals, url.Values{
+		"follow":       {"true"},
+		"lines":        {"10"},
+		"process_type": {"web"},
+	})
+	c.Assert(req.Header.Get("Authorization"), Equals, "")
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+// defaultBufferSize is the number of log lines buffered for each app.
+const defaultBufferSize = 10000
+
+// subscriptionBuffer is the number of lines which may be queued for a
+// subscriber before it is considered too slow and dropped.
+const subscriptionBuffer = 1000
+
+// Aggregator buffers the most recent log lines of each app and fans new
+// lines out to subscribers.
+type Aggregator struct {
+	bufferSize int
+
+	// dir is the directory the buffers are saved in, or empty if they are
+	// only kept in memory.
+	dir string
+
+	mtx  sync.Mutex
+	apps map[string]*appLog
+}
+
+func NewAggregator(bufferSize int) *Aggregator {
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	return &Aggregator{
+		bufferSize: bufferSize,
+		apps:       make(map[string]*appLog),
+	}
+}
+
+// appLog is a ring buffer of the log lines for an app.
+type appLog struct {
+	msgs    []*ct.LogMessage
+	next    int // the index the next line is written to
+	full    bool
+	subs    map[*Subscription]struct{}
+	updated time.Time
+
+	// file is the file the lines are appended to if the buffers are saved,
+	// and written is the number of lines in it.
+	file    *os.File
+	written int
+}
+
+func (l *appLog) add(msg *ct.LogMessage) {
+	l.msgs[l.next] = msg
+	l.next = (l.next + 1) % len(l.msgs)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// all returns the buffered lines, oldest first.
+func (l *appLog) all() []*ct.LogMessage {
+	if !l.full {
+		return l.msgs[:l.next]
+	}
+	msgs := make([]*ct.LogMessage, 0, len(l.msgs))
+	msgs = append(msgs, l.msgs[l.next:]...)
+	return append(msgs, l.msgs[:l.next]...)
+}
+
+// logFilter selects the lines of particular process types or jobs.
+type logFilter struct {
+	processType string
+	jobID       string
+}
+
+func (f logFilter) match(msg *ct.LogMessage) bool {
+	return (f.processType == "" || f.processType == msg.ProcessType) &&
+		(f.jobID == "" || f.jobID == msg.JobID)
+}
+
+// Subscription receives the new log lines for an app which match its filter.
+// Ch is closed if the subscriber falls too far behind.
+type Subscription struct {
+	Ch     chan *ct.LogMessage
+	appID  string
+	filter logFilter
+}
+
+func (a *Aggregator) appLog(id string) *appLog {
+	l, ok := a.apps[id]
+	if !ok {
+		l = &appLog{
+			msgs: make([]*ct.LogMessage, a.bufferSize),
+			subs: make(map[*Subscription]struct{}),
+		}
+		a.apps[id] = l
+	}
+	return l
+}
+
+// Open loads the buffers saved in dir, and saves the lines added from then on
+// there too so they survive a restart.
+func (a *Aggregator) Open(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.dir = dir
+	for _, info := range files {
+		if info.IsDir() || filepath.Ext(info.Name()) != ".log" {
+			continue
+		}
+		l := a.appLog(strings.TrimSuffix(info.Name(), ".log"))
+		if err := l.load(filepath.Join(dir, info.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load adds the lines saved in the file at path, stopping at the first line
+// which can't be decoded as it was likely only partially written.
+func (l *appLog) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		msg := &ct.LogMessage{}
+		if err := dec.Decode(msg); err != nil {
+			break
+		}
+		l.add(msg)
+		l.updated = msg.Timestamp
+	}
+	return nil
+}
+
+// save appends msg to the app's file, rewriting the file with just the
+// buffered lines once it holds twice as many lines as the buffer.
+func (a *Aggregator) save(appID string, l *appLog, msg *ct.LogMessage) error {
+	path := filepath.Join(a.dir, appID+".log")
+	if l.file == nil || l.written >= 2*len(l.msgs) {
+		if l.file != nil {
+			l.file.Close()
+			l.file = nil
+		}
+		tmp, err := ioutil.TempFile(a.dir, appID)
+		if err != nil {
+			return err
+		}
+		msgs := l.all()
+		enc := json.NewEncoder(tmp)
+		for _, m := range msgs {
+			if err := enc.Encode(m); err != nil {
+				tmp.Close()
+				os.Remove(tmp.Name())
+				return err
+			}
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		l.file = tmp
+		l.written = len(msgs)
+		// msg has already been buffered, so it was written with the rest
+		return nil
+	}
+	if err := json.NewEncoder(l.file).Encode(msg); err != nil {
+		return err
+	}
+	l.written++
+	return nil
+}
+
+// Prune removes the buffers of apps which are not in appIDs and have not had
+// lines added since before, so the buffers of deleted apps are not kept
+// forever.
+func (a *Aggregator) Prune(appIDs []string, before time.Time) {
+	keep := make(map[string]struct{}, len(appIDs))
+	for _, id := range appIDs {
+		keep[id] = struct{}{}
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	for id, l := range a.apps {
+		if _, ok := keep[id]; ok || !l.updated.Before(before) {
+			continue
+		}
+		for sub := range l.subs {
+			close(sub.Ch)
+		}
+		if l.file != nil {
+			l.file.Close()
+		}
+		if a.dir != "" {
+			os.Remove(filepath.Join(a.dir, id+".log"))
+		}
+		delete(a.apps, id)
+	}
+}
+
+// Cursors returns the position of the last buffered line of each job, so
+// lines which have already been buffered are not collected again.
+func (a *Aggregator) Cursors() map[string]*cursor {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	cursors := make(map[string]*cursor)
+	for _, l := range a.apps {
+		for _, msg := range l.all() {
+			cur, ok := cursors[msg.JobID]
+			if !ok {
+				cur = &cursor{}
+				cursors[msg.JobID] = cur
+			}
+			cur.advance(msg.Timestamp)
+		}
+	}
+	return cursors
+}
+
+// Add buffers msg and sends it to the matching subscribers.
+func (a *Aggregator) Add(msg *ct.LogMessage) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	l := a.appLog(msg.AppID)
+	l.add(msg)
+	l.updated = time.Now()
+	if a.dir != "" {
+		if err := a.save(msg.AppID, l, msg); err != nil {
+			grohl.Log(grohl.Data{"fn": "Aggregator.Add", "at": "save_error", "app.id": msg.AppID, "err": err})
+		}
+	}
+	for sub := range l.subs {
+		if !sub.filter.match(msg) {
+			continue
+		}
+		select {
+		case sub.Ch <- msg:
+		default:
+			delete(l.subs, sub)
+			close(sub.Ch)
+		}
+	}
+}
+
+// Read returns the last lines buffered lines for appID which match f, or all
+// of them if lines is zero.
+func (a *Aggregator) Read(appID string, f logFilter, lines int) []*ct.LogMessage {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.read(appID, f, lines)
+}
+
+func (a *Aggregator) read(appID string, f logFilter, lines int) []*ct.LogMessage {
+	l, ok := a.apps[appID]
+	if !ok {
+		return nil
+	}
+	var msgs []*ct.LogMessage
+	for _, msg := range l.all() {
+		if f.match(msg) {
+			msgs = append(msgs, msg)
+		}
+	}
+	if lines > 0 && len(msgs) > lines {
+		msgs = msgs[len(msgs)-lines:]
+	}
+	return msgs
+}
+
+// Subscribe returns the buffered lines for appID as Read does, along with a
+// subscription to the lines which are added after them.
+func (a *Aggregator) Subscribe(appID string, f logFilter, lines int) ([]*ct.LogMessage, *Subscription) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	sub := &Subscription{
+		Ch:     make(chan *ct.LogMessage, subscriptionBuffer),
+		appID:  appID,
+		filter: f,
+	}
+	a.appLog(appID).subs[sub] = struct{}{}
+	return a.read(appID, f, lines), sub
+}
+
+// Unsubscribe stops sending lines to sub.
+func (a *Aggregator) Unsubscribe(sub *Subscription) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	l, ok := a.apps[sub.appID]
+	if !ok {
+		// the app was pruned, which closed the subscription
+		return
+	}
+	if _, ok := l.subs[sub]; ok {
+		delete(l.subs, sub)
+		close(sub.Ch)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/controller/client"
+	"github.com/flynn/flynn/controller/testutils"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/types"
+)
+
+// Hook gocheck up to the "go test" runner
+func Test(t *testing.T) { TestingT(t) }
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func newMsg(appID, typ, jobID string, i int) *ct.LogMessage {
+	return &ct.LogMessage{
+		AppID:       appID,
+		JobID:       jobID,
+		ProcessType: typ,
+		Stream:      "stdout",
+		Message:     fmt.Sprintf("line %d", i),
+	}
+}
+
+func messages(msgs []*ct.LogMessage) []string {
+	res := make([]string, len(msgs))
+	for i, msg := range msgs {
+		res[i] = msg.Message
+	}
+	return res
+}
+
+func (s *S) TestRingBuffer(c *C) {
+	agg := NewAggregator(3)
+	for i := 0; i < 5; i++ {
+		agg.Add(newMsg("app", "web", "job", i))
+	}
+	agg.Add(newMsg("other", "web", "job", 5))
+
+	c.Assert(messages(agg.Read("app", logFilter{}, 0)), DeepEquals, []string{"line 2", "line 3", "line 4"})
+	c.Assert(messages(agg.Read("app", logFilter{}, 2)), DeepEquals, []string{"line 3", "line 4"})
+	c.Assert(messages(agg.Read("other", logFilter{}, 0)), DeepEquals, []string{"line 5"})
+	c.Assert(agg.Read("missing", logFilter{}, 0), HasLen, 0)
+}
+
+func (s *S) TestFilter(c *C) {
+	agg := NewAggregator(10)
+	agg.Add(newMsg("app", "web", "job1", 0))
+	agg.Add(newMsg("app", "worker", "job2", 1))
+	agg.Add(newMsg("app", "web", "job3", 2))
+
+	c.Assert(messages(agg.Read("app", logFilter{processType: "web"}, 0)), DeepEquals, []string{"line 0", "line 2"})
+	c.Assert(messages(agg.Read("app", logFilter{jobID: "job2"}, 0)), DeepEquals, []string{"line 1"})
+	c.Assert(messages(agg.Read("app", logFilter{processType: "web"}, 1)), DeepEquals, []string{"line 2"})
+}
+
+func (s *S) TestSubscribe(c *C) {
+	agg := NewAggregator(10)
+	agg.Add(newMsg("app", "web", "job1", 0))
+
+	msgs, sub := agg.Subscribe("app", logFilter{processType: "web"}, 0)
+	c.Assert(messages(msgs), DeepEquals, []string{"line 0"})
+
+	agg.Add(newMsg("app", "worker", "job2", 1))
+	agg.Add(newMsg("other", "web", "job3", 2))
+	agg.Add(newMsg("app", "web", "job1", 3))
+	select {
+	case msg := <-sub.Ch:
+		c.Assert(msg.Message, Equals, "line 3")
+	case <-time.After(time.Second):
+		c.Fatal("timed out waiting for log message")
+	}
+
+	agg.Unsubscribe(sub)
+	_, ok := <-sub.Ch
+	c.Assert(ok, Equals, false)
+}
+
+func (s *S) TestSlowSubscriber(c *C) {
+	agg := NewAggregator(10)
+	_, sub := agg.Subscribe("app", logFilter{}, 0)
+	for i := 0; i <= subscriptionBuffer; i++ {
+		agg.Add(newMsg("app", "web", "job", i))
+	}
+	// the subscription is closed once its buffer overflows
+	for i := 0; i < subscriptionBuffer; i++ {
+		<-sub.Ch
+	}
+	_, ok := <-sub.Ch
+	c.Assert(ok, Equals, false)
+	agg.Unsubscribe(sub)
+}
+
+func (s *S) TestLineWriter(c *C) {
+	agg := NewAggregator(10)
+	col := newCollector(nil, nil, agg)
+	cur := &cursor{}
+	t0 := time.Now()
+	t1 := t0.Add(time.Millisecond)
+
+	w := col.newLineWriter(ct.LogMessage{AppID: "app", JobID: "host-job", ProcessType: "web"}, "stderr", cur)
+	w.Write(t0, []byte("foo\nba"))
+	w.Write(t1, []byte("r\nbaz"))
+	c.Assert(messages(agg.Read("app", logFilter{}, 0)), DeepEquals, []string{"foo", "bar"})
+	w.Flush()
+
+	msgs := agg.Read("app", logFilter{}, 0)
+	c.Assert(messages(msgs), DeepEquals, []string{"foo", "bar", "baz"})
+	c.Assert(*msgs[2], DeepEquals, ct.LogMessage{
+		AppID:       "app",
+		JobID:       "host-job",
+		ProcessType: "web",
+		Stream:      "stderr",
+		Timestamp:   t1,
+		Message:     "baz",
+	})
+	c.Assert(*cur, DeepEquals, cursor{Timestamp: t1, Lines: 2, seen: 2})
+
+	// lines repeated when the log is requested again from the cursor are
+	// not added again
+	cur.rewind()
+	w.Write(t0, []byte("foo\n"))
+	w.Write(t1, []byte("r\nbaz\n"))
+	w.Write(t1.Add(time.Millisecond), []byte("qux\n"))
+	c.Assert(messages(agg.Read("app", logFilter{}, 0)), DeepEquals, []string{"foo", "bar", "baz", "qux"})
+}
+
+func (s *S) TestCollectorResume(c *C) {
+	// the job isn't in the cluster, so getting it fails as if the host were
+	// unreachable once the log stream ends
+	hc := testutils.NewFakeHostClient("host")
+	cluster := testutils.NewFakeCluster()
+	cluster.SetHosts(map[string]host.Host{"host": {ID: "host"}})
+	cluster.SetHostClient("host", hc)
+	t0 := time.Now().Round(time.Millisecond)
+	t1 := t0.Add(time.Millisecond)
+	t2 := t1.Add(time.Millisecond)
+	log := []*host.LogEntry{
+		{Stream: 1, Timestamp: t0, Data: "foo\n"},
+		{Stream: 1, Timestamp: t1, Data: "bar\nba"},
+		{Stream: 2, Timestamp: t1, Data: "err\n"},
+		{Stream: 1, Timestamp: t2, Data: "z\n"},
+	}
+	hc.SetJobLog("job", log)
+	job := &host.Job{ID: "job", Metadata: map[string]string{"flynn-controller.app": "app"}}
+
+	// the log is resumed after the first line with timestamp t1
+	agg := NewAggregator(10)
+	col := newCollector(cluster, map[string]*cursor{"host-job": {Timestamp: t1, Lines: 1}}, agg)
+	col.followJob(hc, job)
+	c.Assert(messages(agg.Read("app", logFilter{}, 0)), DeepEquals, []string{"err", "baz"})
+	c.Assert(col.cursors["host-job"].Timestamp.Equal(t2), Equals, true)
+
+	// following the job again only adds the new lines
+	hc.SetJobLog("job", append(log, &host.LogEntry{Stream: 1, Timestamp: t2.Add(time.Millisecond), Data: "qux\n"}))
+	col.followJob(hc, job)
+	c.Assert(messages(agg.Read("app", logFilter{}, 0)), DeepEquals, []string{"err", "baz", "qux"})
+}
+
+func (s *S) TestPersist(c *C) {
+	dir := c.MkDir()
+	agg := NewAggregator(3)
+	c.Assert(agg.Open(dir), IsNil)
+	now := time.Now().Round(time.Millisecond)
+	for i := 0; i < 8; i++ {
+		msg := newMsg("app", "web", "job1", i)
+		msg.Timestamp = now.Add(time.Duration(i/2) * time.Millisecond)
+		agg.Add(msg)
+	}
+	agg.Add(newMsg("other", "web", "job2", 8))
+
+	// the buffers are loaded from the directory
+	loaded := NewAggregator(3)
+	c.Assert(loaded.Open(dir), IsNil)
+	c.Assert(messages(loaded.Read("app", logFilter{}, 0)), DeepEquals, []string{"line 5", "line 6", "line 7"})
+	c.Assert(messages(loaded.Read("other", logFilter{}, 0)), DeepEquals, []string{"line 8"})
+
+	// the cursors point after the last line of each job
+	cursors := loaded.Cursors()
+	c.Assert(cursors["job1"].Timestamp.Equal(now.Add(3*time.Millisecond)), Equals, true)
+	c.Assert(cursors["job1"].Lines, Equals, 2)
+
+	// apps which aren't listed are removed, unless lines were added after
+	// they were listed
+	_, sub := loaded.Subscribe("other", logFilter{}, 0)
+	listed := time.Now()
+	loaded.Add(newMsg("new", "web", "job3", 9))
+	loaded.Prune([]string{"app"}, listed)
+	_, ok := <-sub.Ch
+	c.Assert(ok, Equals, false)
+	loaded.Unsubscribe(sub)
+	c.Assert(loaded.Read("other", logFilter{}, 0), HasLen, 0)
+	c.Assert(loaded.Read("new", logFilter{}, 0), HasLen, 1)
+	_, err := os.Stat(filepath.Join(dir, "other.log"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *S) TestStreamAppLog(c *C) {
+	agg := NewAggregator(10)
+	agg.Add(newMsg("app", "web", "job1", 0))
+	agg.Add(newMsg("app", "worker", "job2", 1))
+	srv := httptest.NewServer(apiHandler(agg))
+	defer srv.Close()
+	client, err := controller.NewClient(srv.URL, "")
+	c.Assert(err, IsNil)
+
+	// without follow, the stream ends after the buffered lines
+	ch := make(chan *ct.LogMessage)
+	stream, err := client.StreamAppLog("app", &ct.LogOpts{ProcessType: "web"}, ch)
+	c.Assert(err, IsNil)
+	var msgs []*ct.LogMessage
+	for msg := range ch {
+		msgs = append(msgs, msg)
+	}
+	c.Assert(stream.Err(), IsNil)
+	c.Assert(messages(msgs), DeepEquals, []string{"line 0"})
+
+	// with follow, new lines are streamed
+	ch = make(chan *ct.LogMessage)
+	stream, err = client.StreamAppLog("app", &ct.LogOpts{Follow: true, Lines: 1}, ch)
+	c.Assert(err, IsNil)
+	defer stream.Close()
+	next := func() string {
+		select {
+		case msg := <-ch:
+			return msg.Message
+		case <-time.After(5 * time.Second):
+			c.Fatal("timed out waiting for log message")
+		}
+		return ""
+	}
+	c.Assert(next(), Equals, "line 1")
+	agg.Add(newMsg("app", "web", "job1", 2))
+	c.Assert(next(), Equals, "line 2")
+
+	// invalid options are rejected
+	res, err := http.Get(srv.URL + "/apps/app/log?lines=foo")
+	c.Assert(err, IsNil)
+	res.Body.Close()
+	c.Assert(res.StatusCode, Equals, 400)
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/attempt"
+	"github.com/flynn/flynn/pkg/cluster"
+	"github.com/flynn/flynn/pkg/stream"
+)
+
+type clusterClient interface {
+	ListHosts() ([]host.Host, error)
+	DialHost(id string) (cluster.Host, error)
+	StreamHostEvents(ch chan<- *host.HostEvent) (stream.Stream, error)
+}
+
+// logSink is something log lines are added to, such as the Aggregator or the
+// drains.
+type logSink interface {
+	Add(msg *ct.LogMessage)
+}
+
+// collector follows the log of every app job on every host and adds its lines
+// to each of its sinks.
+type collector struct {
+	cluster clusterClient
+	sinks   []logSink
+
+	mtx     sync.Mutex
+	hosts   map[string]struct{}
+	jobs    map[string]struct{}
+	cursors map[string]*cursor
+}
+
+// newCollector returns a collector which resumes the logs of the jobs in
+// cursors from the lines they point at.
+func newCollector(cc clusterClient, cursors map[string]*cursor, sinks ...logSink) *collector {
+	if cursors == nil {
+		cursors = make(map[string]*cursor)
+	}
+	return &collector{
+		cluster: cc,
+		sinks:   sinks,
+		hosts:   make(map[string]struct{}),
+		jobs:    make(map[string]struct{}),
+		cursors: cursors,
+	}
+}
+
+// cursor is the position in a job's log up to which lines have been added to
+// the sinks. Log timestamps only have millisecond resolution, so it is the
+// timestamp of the last line along with the number of lines which had it.
+type cursor struct {
+	Timestamp time.Time
+	Lines     int
+
+	// seen is the number of lines with Timestamp read since the log was
+	// last requested, which repeats the lines already added.
+	seen int
+}
+
+// advance moves the cursor past a line with timestamp ts, reporting whether
+// the line is new rather than one repeated from before the cursor.
+func (c *cursor) advance(ts time.Time) bool {
+	switch {
+	case ts.Before(c.Timestamp):
+		return false
+	case ts.Equal(c.Timestamp):
+		c.seen++
+		if c.seen <= c.Lines {
+			return false
+		}
+		c.Lines = c.seen
+		return true
+	default:
+		c.Timestamp = ts
+		c.Lines, c.seen = 1, 1
+		return true
+	}
+}
+
+// rewind is called when the log is requested again from c.Timestamp.
+func (c *cursor) rewind() {
+	c.seen = 0
+}
+
+// Run follows the jobs on the current hosts and any which are added later. It
+// returns when the host event stream ends.
+func (c *collector) Run() error {
+	events := make(chan *host.HostEvent)
+	stream, err := c.cluster.StreamHostEvents(events)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	hosts, err := c.cluster.ListHosts()
+	if err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		go c.followHost(h.ID)
+	}
+	for event := range events {
+		if event.Event == "add" {
+			go c.followHost(event.HostID)
+		}
+	}
+	return stream.Err()
+}
+
+var dialHostAttempts = attempt.Strategy{
+	Total: 60 * time.Second,
+	Delay: 200 * time.Millisecond,
+}
+
+// followRetryDelay is how long to wait before following a host or job again
+// after its stream ends while it is still up.
+var followRetryDelay = time.Second
+
+// followHost follows the jobs on a host until it leaves the cluster,
+// reconnecting if its event stream ends while it is still in the cluster.
+func (c *collector) followHost(id string) {
+	if !c.add(c.hosts, id) {
+		return
+	}
+	defer c.remove(c.hosts, id)
+
+	g := grohl.NewContext(grohl.Data{"fn": "followHost", "host.id": id})
+	for {
+		c.followHostEvents(g, id)
+		if !c.hostExists(id) {
+			g.Log(grohl.Data{"at": "host_removed"})
+			return
+		}
+		time.Sleep(followRetryDelay)
+	}
+}
+
+// hostExists reports whether a host is in the cluster, assuming it is if the
+// hosts can't be listed.
+func (c *collector) hostExists(id string) bool {
+	hosts, err := c.cluster.ListHosts()
+	if err != nil {
+		return true
+	}
+	for _, h := range hosts {
+		if h.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// followHostEvents follows the jobs on a host until its event stream ends.
+func (c *collector) followHostEvents(g *grohl.Context, id string) {
+	var h cluster.Host
+	if err := dialHostAttempts.Run(func() (err error) {
+		h, err = c.cluster.DialHost(id)
+		return
+	}); err != nil {
+		g.Log(grohl.Data{"at": "dial_host_error", "err": err})
+		return
+	}
+
+	// start streaming events before listing jobs so none are missed
+	events := make(chan *host.Event)
+	stream, err := h.StreamEvents("all", events)
+	if err != nil {
+		g.Log(grohl.Data{"at": "stream_events_error", "err": err})
+		return
+	}
+	defer stream.Close()
+
+	jobs, err := h.ListJobs()
+	if err != nil {
+		g.Log(grohl.Data{"at": "list_jobs_error", "err": err})
+		return
+	}
+	g.Log(grohl.Data{"at": "start"})
+	for _, job := range jobs {
+		if job.Status == host.StatusStarting || job.Status == host.StatusRunning {
+			go c.followJob(h, job.Job)
+		}
+	}
+	for event := range events {
+		if event.Event == "start" && event.Job != nil {
+			go c.followJob(h, event.Job.Job)
+		}
+	}
+	g.Log(grohl.Data{"at": "disconnect", "err": stream.Err()})
+}
+
+// followJob adds the lines of a job's log to the sinks until it exits,
+// resuming from the last line added if the log stream ends early.
+func (c *collector) followJob(h cluster.Host, job *host.Job) {
+	if job == nil {
+		return
+	}
+	appID := job.Metadata["flynn-controller.app"]
+	if appID == "" {
+		return
+	}
+	id := h.ID() + "-" + job.ID
+	if !c.add(c.jobs, id) {
+		return
+	}
+	defer c.remove(c.jobs, id)
+
+	c.mtx.Lock()
+	cur, ok := c.cursors[id]
+	if !ok {
+		cur = &cursor{}
+		c.cursors[id] = cur
+	}
+	c.mtx.Unlock()
+
+	msg := ct.LogMessage{
+		AppID:       appID,
+		JobID:       id,
+		ProcessType: job.Metadata["flynn-controller.type"],
+	}
+	stdout := c.newLineWriter(msg, "stdout", cur)
+	stderr := c.newLineWriter(msg, "stderr", cur)
+
+	g := grohl.NewContext(grohl.Data{"fn": "followJob", "job.id": id})
+	for {
+		if err := c.streamJobLog(h, job.ID, cur, stdout, stderr); err != nil {
+			g.Log(grohl.Data{"at": "stream_log_error", "err": err})
+		}
+		active, err := h.GetJob(job.ID)
+		if err != nil {
+			// the host is unreachable, it is followed again if it comes
+			// back, resuming from the cursor
+			g.Log(grohl.Data{"at": "get_job_error", "err": err})
+			return
+		}
+		if active.Status != host.StatusStarting && active.Status != host.StatusRunning {
+			break
+		}
+		time.Sleep(followRetryDelay)
+	}
+	stdout.Flush()
+	stderr.Flush()
+
+	c.mtx.Lock()
+	delete(c.cursors, id)
+	c.mtx.Unlock()
+}
+
+// streamJobLog writes a job's log from cur to the line writers, returning
+// when the job exits or the stream fails.
+func (c *collector) streamJobLog(h cluster.Host, jobID string, cur *cursor, stdout, stderr *lineWriter) error {
+	// request the log from the start of any partial lines too, as they are
+	// written again
+	since := cur.Timestamp
+	for _, w := range []*lineWriter{stdout, stderr} {
+		if len(w.buf) > 0 && w.start.Before(since) {
+			since = w.start
+		}
+	}
+	entries := make(chan *host.LogEntry)
+	stream, err := h.StreamJobLog(jobID, since, true, entries)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	stdout.buf, stderr.buf = nil, nil
+	cur.rewind()
+	for entry := range entries {
+		switch entry.Stream {
+		case 1:
+			stdout.Write(entry.Timestamp, []byte(entry.Data))
+		case 2:
+			stderr.Write(entry.Timestamp, []byte(entry.Data))
+		}
+	}
+	return stream.Err()
+}
+
+func (c *collector) add(set map[string]struct{}, id string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if _, ok := set[id]; ok {
+		return false
+	}
+	set[id] = struct{}{}
+	return true
+}
+
+func (c *collector) remove(set map[string]struct{}, id string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(set, id)
+}
+
+// maxLineLength is the length at which a line without a newline is split.
+const maxLineLength = 64 * 1024
+
+// lineWriter splits the output of a job stream into lines, adding each one to
+// the sinks timestamped with the time the log entry which ended it was
+// written.
+type lineWriter struct {
+	c   *collector
+	msg ct.LogMessage
+	cur *cursor
+	buf []byte
+
+	// start is the timestamp of the log entry buf starts in, and ts is the
+	// timestamp of the last entry written
+	start time.Time
+	ts    time.Time
+}
+
+func (c *collector) newLineWriter(msg ct.LogMessage, stream string, cur *cursor) *lineWriter {
+	msg.Stream = stream
+	return &lineWriter{c: c, msg: msg, cur: cur}
+}
+
+// Write adds the lines ended by p, which was written to the log at ts.
+func (w *lineWriter) Write(ts time.Time, p []byte) {
+	if len(w.buf) == 0 {
+		w.start = ts
+	}
+	w.ts = ts
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			if len(w.buf) >= maxLineLength {
+				w.Flush()
+			}
+			return
+		}
+		w.add(w.buf[:i])
+		w.buf = w.buf[i+1:]
+		w.start = ts
+	}
+}
+
+// Flush adds any partial line which has been written.
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.add(w.buf)
+		w.buf = nil
+	}
+}
+
+// add adds a line to the sinks unless it was already added before the log
+// was requested again.
+func (w *lineWriter) add(line []byte) {
+	if !w.cur.advance(w.ts) {
+		return
+	}
+	msg := w.msg
+	msg.Timestamp = w.ts
+	msg.Message = string(line)
+	for _, sink := range w.c.sinks {
+		sink.Add(&msg)
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+const (
+	// drainBufferSize is the number of log lines buffered for a drain while
+	// it is unavailable, after which the oldest lines are dropped.
+	drainBufferSize = 10000
+
+	drainSyncInterval = 10 * time.Second
+	drainWriteTimeout = 10 * time.Second
+	drainMinBackoff   = 100 * time.Millisecond
+	drainMaxBackoff   = 30 * time.Second
+)
+
+type drainLister interface {
+	AllDrainList() ([]*ct.Drain, error)
+}
+
+// logReader reads the lines buffered for an app, such as the Aggregator.
+type logReader interface {
+	Read(appID string, f logFilter, lines int) []*ct.LogMessage
+}
+
+// drainManager forwards the log lines of each app to the app's drains, which
+// are periodically synced from the controller.
+type drainManager struct {
+	client drainLister
+
+	// buffer is read to resume drains from their saved cursors, which are
+	// kept in dir if it is set.
+	buffer logReader
+	dir    string
+
+	mtx     sync.RWMutex
+	drains  map[string]*drain
+	apps    map[string][]*drain
+	cursors map[string]time.Time // saved cursors of drains not yet started
+}
+
+func newDrainManager(client drainLister, buffer logReader, dir string) *drainManager {
+	m := &drainManager{
+		client:  client,
+		buffer:  buffer,
+		dir:     dir,
+		drains:  make(map[string]*drain),
+		apps:    make(map[string][]*drain),
+		cursors: make(map[string]time.Time),
+	}
+	if dir != "" {
+		if err := m.loadCursors(); err != nil && !os.IsNotExist(err) {
+			grohl.Log(grohl.Data{"fn": "newDrainManager", "at": "load_cursors_error", "err": err})
+		}
+	}
+	return m
+}
+
+func (m *drainManager) cursorsPath() string {
+	return filepath.Join(m.dir, "drains.json")
+}
+
+func (m *drainManager) loadCursors() error {
+	f, err := os.Open(m.cursorsPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(&m.cursors)
+}
+
+// SaveCursors saves the timestamp of the last line sent to each drain, so the
+// drains resume from there rather than from the lines received after a
+// restart.
+func (m *drainManager) SaveCursors() error {
+	if m.dir == "" {
+		return nil
+	}
+	m.mtx.RLock()
+	cursors := make(map[string]time.Time, len(m.drains)+len(m.cursors))
+	for id, cur := range m.cursors {
+		cursors[id] = cur
+	}
+	for id, d := range m.drains {
+		cursors[id] = d.Cursor()
+	}
+	m.mtx.RUnlock()
+
+	tmp, err := ioutil.TempFile(m.dir, "drains")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(tmp).Encode(cursors); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	return os.Rename(tmp.Name(), m.cursorsPath())
+}
+
+// Run syncs the drains every drainSyncInterval.
+func (m *drainManager) Run() {
+	for {
+		if err := m.Sync(); err != nil {
+			grohl.Log(grohl.Data{"fn": "drainManager.Run", "at": "sync_error", "err": err})
+		}
+		time.Sleep(drainSyncInterval)
+	}
+}
+
+// Sync starts forwarding to new drains and stops forwarding to drains which
+// have been removed, then saves the drain cursors.
+func (m *drainManager) Sync() error {
+	list, err := m.client.AllDrainList()
+	if err != nil {
+		return err
+	}
+
+	m.mtx.Lock()
+	drains := make(map[string]*drain, len(list))
+	apps := make(map[string][]*drain)
+	for _, info := range list {
+		d, ok := m.drains[info.ID]
+		if ok {
+			d.resumed()
+		} else {
+			d, err = newDrain(info)
+			if err != nil {
+				grohl.Log(grohl.Data{"fn": "drainManager.Sync", "at": "invalid_drain", "drain.id": info.ID, "err": err})
+				continue
+			}
+			if cur, ok := m.cursors[info.ID]; ok {
+				d.cursor = cur
+				if m.buffer != nil {
+					d.resume(m.buffer.Read(d.appID, logFilter{}, 0))
+				}
+			}
+			go d.run()
+		}
+		drains[info.ID] = d
+		apps[d.appID] = append(apps[d.appID], d)
+	}
+	for id, d := range m.drains {
+		if _, ok := drains[id]; !ok {
+			d.Close()
+		}
+	}
+	m.drains = drains
+	m.apps = apps
+	m.cursors = make(map[string]time.Time)
+	m.mtx.Unlock()
+
+	return m.SaveCursors()
+}
+
+// Add queues msg to be sent to the drains of its app.
+func (m *drainManager) Add(msg *ct.LogMessage) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	for _, d := range m.apps[msg.AppID] {
+		d.Add(msg)
+	}
+}
+
+// drain sends log lines to a syslog server, buffering them and reconnecting
+// with exponential backoff while the server is unavailable.
+type drain struct {
+	id    string
+	appID string
+	addr  string
+	tls   *tls.Config // nil for plain TCP
+
+	mtx     sync.Mutex
+	queue   []*ct.LogMessage
+	dropped int
+
+	// cursor is the timestamp of the last line sent, and skip holds the
+	// lines queued when the drain was resumed, which may be added again.
+	cursor time.Time
+	skip   map[*ct.LogMessage]struct{}
+
+	notify chan struct{}
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func newDrain(info *ct.Drain) (*drain, error) {
+	u, err := url.Parse(info.URL)
+	if err != nil {
+		return nil, err
+	}
+	d := &drain{
+		id:     info.ID,
+		appID:  info.AppID,
+		addr:   u.Host,
+		cursor: time.Now(),
+		notify: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	if u.Scheme == "syslog+tls" {
+		host, _, err := net.SplitHostPort(u.Host)
+		if err != nil {
+			return nil, err
+		}
+		d.tls = &tls.Config{ServerName: host}
+	}
+	return d, nil
+}
+
+// resume queues the lines in msgs which are newer than the cursor. Lines from
+// different jobs are not strictly ordered by timestamp, so lines received
+// around the same time as the last one sent may be skipped.
+func (d *drain) resume(msgs []*ct.LogMessage) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	skip := make(map[*ct.LogMessage]struct{})
+	for _, msg := range msgs {
+		if msg.Timestamp.After(d.cursor) {
+			d.queue = append(d.queue, msg)
+			skip[msg] = struct{}{}
+		}
+	}
+	if len(d.queue) > drainBufferSize {
+		d.dropped += len(d.queue) - drainBufferSize
+		d.queue = d.queue[len(d.queue)-drainBufferSize:]
+	}
+	d.skip = skip
+}
+
+// resumed stops checking for the lines queued by resume being added again,
+// which only happens while the drain is being started.
+func (d *drain) resumed() {
+	d.mtx.Lock()
+	d.skip = nil
+	d.mtx.Unlock()
+}
+
+// Cursor returns the timestamp of the last line sent to the drain.
+func (d *drain) Cursor() time.Time {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.cursor
+}
+
+func (d *drain) Add(msg *ct.LogMessage) {
+	d.mtx.Lock()
+	if _, ok := d.skip[msg]; ok {
+		d.mtx.Unlock()
+		return
+	}
+	if len(d.queue) >= drainBufferSize {
+		d.queue[0] = nil
+		d.queue = d.queue[1:]
+		d.dropped++
+	}
+	d.queue = append(d.queue, msg)
+	d.mtx.Unlock()
+
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (d *drain) Close() {
+	d.once.Do(func() { close(d.stop) })
+}
+
+// next returns the oldest queued line without removing it, or nil if the
+// queue is empty.
+func (d *drain) next() *ct.LogMessage {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if len(d.queue) == 0 {
+		return nil
+	}
+	return d.queue[0]
+}
+
+// sent removes msg from the front of the queue, unless it has since been
+// dropped.
+func (d *drain) sent(msg *ct.LogMessage) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if len(d.queue) > 0 && d.queue[0] == msg {
+		d.queue[0] = nil
+		d.queue = d.queue[1:]
+	}
+	if msg.Timestamp.After(d.cursor) {
+		d.cursor = msg.Timestamp
+	}
+}
+
+func (d *drain) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: drainWriteTimeout}
+	if d.tls != nil {
+		return tls.DialWithDialer(dialer, "tcp", d.addr, d.tls)
+	}
+	return dialer.Dial("tcp", d.addr)
+}
+
+// send writes msg to conn, dialing a new connection if conn is nil and
+// closing it if the write fails.
+func (d *drain) send(conn *net.Conn, msg *ct.LogMessage) error {
+	if *conn == nil {
+		c, err := d.dial()
+		if err != nil {
+			return err
+		}
+		*conn = c
+	}
+	(*conn).SetWriteDeadline(time.Now().Add(drainWriteTimeout))
+	if _, err := (*conn).Write(formatSyslog(msg)); err != nil {
+		(*conn).Close()
+		*conn = nil
+		return err
+	}
+	return nil
+}
+
+func (d *drain) run() {
+	g := grohl.NewContext(grohl.Data{"fn": "drain.run", "drain.id": d.id, "app.id": d.appID})
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	backoff := drainMinBackoff
+
+	for {
+		msg := d.next()
+		if msg == nil {
+			select {
+			case <-d.notify:
+				continue
+			case <-d.stop:
+				return
+			}
+		}
+
+		if err := d.send(&conn, msg); err != nil {
+			g.Log(grohl.Data{"at": "send_error", "err": err, "backoff": backoff.String()})
+			select {
+			case <-time.After(backoff):
+			case <-d.stop:
+				return
+			}
+			if backoff *= 2; backoff > drainMaxBackoff {
+				backoff = drainMaxBackoff
+			}
+			continue
+		}
+		backoff = drainMinBackoff
+		d.sent(msg)
+
+		d.mtx.Lock()
+		if d.dropped > 0 {
+			g.Log(grohl.Data{"at": "dropped", "count": d.dropped})
+			d.dropped = 0
+		}
+		d.mtx.Unlock()
+
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+	}
+}
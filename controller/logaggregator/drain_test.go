@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+func (s *S) TestFormatSyslog(c *C) {
+	msg := &ct.LogMessage{
+		AppID:       "app",
+		JobID:       "host-job",
+		ProcessType: "web",
+		Stream:      "stderr",
+		Timestamp:   time.Date(2015, 4, 1, 12, 30, 15, 123456000, time.UTC),
+		Message:     `an "error"]`,
+	}
+	expected := `<11>1 2015-04-01T12:30:15.123456Z - app web - [flynn@32473 app="app" process_type="web" job="host-job"] an "error"]`
+	c.Assert(string(formatSyslog(msg)), Equals, fmt.Sprintf("%d %s", len(expected), expected))
+
+	msg.Stream = "stdout"
+	msg.ProcessType = ""
+	msg.JobID = `a"b\c]`
+	expected = `<14>1 2015-04-01T12:30:15.123456Z - app - - [flynn@32473 app="app" process_type="" job="a\"b\\c\]"] an "error"]`
+	c.Assert(string(formatSyslog(msg)), Equals, fmt.Sprintf("%d %s", len(expected), expected))
+}
+
+// syslogServer receives octet counted syslog messages.
+type syslogServer struct {
+	net.Listener
+	msgs chan string
+}
+
+func newSyslogServer(c *C, addr string) *syslogServer {
+	l, err := net.Listen("tcp", addr)
+	c.Assert(err, IsNil)
+	s := &syslogServer{Listener: l, msgs: make(chan string, 100)}
+	go s.serve()
+	return s
+}
+
+func (s *syslogServer) serve() {
+	for {
+		conn, err := s.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				length, err := r.ReadString(' ')
+				if err != nil {
+					return
+				}
+				n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+				if err != nil {
+					return
+				}
+				msg := make([]byte, n)
+				if _, err := io.ReadFull(r, msg); err != nil {
+					return
+				}
+				s.msgs <- string(msg)
+			}
+		}()
+	}
+}
+
+func (s *syslogServer) receive(c *C) string {
+	select {
+	case msg := <-s.msgs:
+		// strip the header and structured data
+		return msg[strings.LastIndex(msg, "] ")+2:]
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for syslog message")
+	}
+	return ""
+}
+
+type fakeDrainLister struct {
+	mtx    sync.Mutex
+	drains []*ct.Drain
+}
+
+func (l *fakeDrainLister) AllDrainList() ([]*ct.Drain, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.drains, nil
+}
+
+func (s *S) TestDrainForwarding(c *C) {
+	srv := newSyslogServer(c, "127.0.0.1:0")
+	defer srv.Close()
+
+	lister := &fakeDrainLister{drains: []*ct.Drain{
+		{ID: "drain1", AppID: "app", URL: "syslog://" + srv.Addr().String()},
+	}}
+	m := newDrainManager(lister, nil, "")
+	c.Assert(m.Sync(), IsNil)
+
+	m.Add(newMsg("app", "web", "job", 0))
+	m.Add(newMsg("other", "web", "job", 1))
+	m.Add(newMsg("app", "web", "job", 2))
+	c.Assert(srv.receive(c), Equals, "line 0")
+	c.Assert(srv.receive(c), Equals, "line 2")
+
+	// removed drains are stopped
+	d := m.drains["drain1"]
+	lister.mtx.Lock()
+	lister.drains = nil
+	lister.mtx.Unlock()
+	c.Assert(m.Sync(), IsNil)
+	select {
+	case <-d.stop:
+	default:
+		c.Fatal("expected drain to be stopped")
+	}
+	m.Add(newMsg("app", "web", "job", 3))
+	c.Assert(d.next(), IsNil)
+}
+
+func (s *S) TestDrainOutage(c *C) {
+	// reserve an address and close it to simulate the drain being down
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	addr := l.Addr().String()
+	l.Close()
+
+	d, err := newDrain(&ct.Drain{ID: "drain", AppID: "app", URL: "syslog://" + addr})
+	c.Assert(err, IsNil)
+	go d.run()
+	defer d.Close()
+	for i := 0; i < 3; i++ {
+		d.Add(newMsg("app", "web", "job", i))
+	}
+	// wait for a connection attempt to fail
+	time.Sleep(2 * drainMinBackoff)
+
+	// the buffered lines are sent once the drain is available
+	srv := newSyslogServer(c, addr)
+	defer srv.Close()
+	for i := 0; i < 3; i++ {
+		c.Assert(srv.receive(c), Equals, fmt.Sprintf("line %d", i))
+	}
+}
+
+func (s *S) TestDrainResume(c *C) {
+	srv := newSyslogServer(c, "127.0.0.1:0")
+	defer srv.Close()
+	dir := c.MkDir()
+	agg := NewAggregator(10)
+	now := time.Now()
+	msgs := make([]*ct.LogMessage, 3)
+	for i := range msgs {
+		msgs[i] = newMsg("app", "web", "job", i)
+		msgs[i].Timestamp = now.Add(time.Duration(i-3) * time.Second)
+		agg.Add(msgs[i])
+	}
+
+	// save a cursor pointing at the first line
+	lister := &fakeDrainLister{drains: []*ct.Drain{
+		{ID: "drain1", AppID: "app", URL: "syslog://" + srv.Addr().String()},
+	}}
+	m := newDrainManager(lister, agg, dir)
+	c.Assert(m.Sync(), IsNil)
+	d := m.drains["drain1"]
+	d.Close()
+	d.mtx.Lock()
+	d.cursor = msgs[0].Timestamp
+	d.mtx.Unlock()
+	c.Assert(m.SaveCursors(), IsNil)
+
+	// the drain resumes from the buffered lines after the cursor, and lines
+	// which were already queued are not sent again
+	m = newDrainManager(lister, agg, dir)
+	c.Assert(m.Sync(), IsNil)
+	defer m.drains["drain1"].Close()
+	m.Add(msgs[2])
+	m.Add(newMsg("app", "web", "job", 3))
+	for i := 1; i < 4; i++ {
+		c.Assert(srv.receive(c), Equals, fmt.Sprintf("line %d", i))
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/julienschmidt/httprouter"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/discoverd/client"
+	"github.com/flynn/flynn/pkg/cluster"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/shutdown"
+	"github.com/flynn/flynn/pkg/sse"
+)
+
+func main() {
+	defer shutdown.Exit()
+
+	grohl.AddContext("app", "logaggregator")
+	grohl.Log(grohl.Data{"at": "start"})
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "3000"
+	}
+	addr := ":" + port
+
+	bufferSize := defaultBufferSize
+	if s := os.Getenv("BUFFER_SIZE"); s != "" {
+		var err error
+		bufferSize, err = strconv.Atoi(s)
+		if err != nil {
+			shutdown.Fatal(err)
+		}
+	}
+	agg := NewAggregator(bufferSize)
+	dir := os.Getenv("DATA_DIR")
+	if dir != "" {
+		if err := agg.Open(dir); err != nil {
+			shutdown.Fatal(err)
+		}
+	}
+
+	client, err := controller.NewClient("", os.Getenv("AUTH_KEY"))
+	if err != nil {
+		shutdown.Fatal(err)
+	}
+	drains := newDrainManager(client, agg, dir)
+	go drains.Run()
+	shutdown.BeforeExit(func() { drains.SaveCursors() })
+	go pruneApps(agg, client)
+
+	cc, err := cluster.NewClient()
+	if err != nil {
+		shutdown.Fatal(err)
+	}
+	go func() {
+		err := newCollector(cc, agg.Cursors(), agg, drains).Run()
+		if err == nil {
+			err = errors.New("host event stream closed")
+		}
+		shutdown.Fatal(err)
+	}()
+
+	hb, err := discoverd.AddServiceAndRegister("flynn-logaggregator", addr)
+	if err != nil {
+		shutdown.Fatal(err)
+	}
+	shutdown.BeforeExit(func() { hb.Close() })
+
+	shutdown.Fatal(http.ListenAndServe(addr, apiHandler(agg)))
+}
+
+// appPruneInterval is how often the buffers of deleted apps are removed.
+const appPruneInterval = time.Minute
+
+type appLister interface {
+	AppList() ([]*ct.App, error)
+}
+
+// pruneApps periodically removes the buffers of apps which have been deleted.
+func pruneApps(agg *Aggregator, client appLister) {
+	for {
+		time.Sleep(appPruneInterval)
+		listed := time.Now()
+		apps, err := client.AppList()
+		if err != nil {
+			grohl.Log(grohl.Data{"fn": "pruneApps", "at": "list_apps_error", "err": err})
+			continue
+		}
+		ids := make([]string, len(apps))
+		for i, app := range apps {
+			ids[i] = app.ID
+		}
+		agg.Prune(ids, listed)
+	}
+}
+
+func apiHandler(agg *Aggregator) http.Handler {
+	api := &httpAPI{agg: agg}
+	r := httprouter.New()
+	r.GET("/apps/:app_id/log", api.GetLog)
+	return r
+}
+
+type httpAPI struct {
+	agg *Aggregator
+}
+
+// GetLog streams the buffered log lines of an app as server-sent events,
+// followed by new lines as they are received if follow is set.
+func (a *httpAPI) GetLog(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	var lines int
+	if s := req.FormValue("lines"); s != "" {
+		var err error
+		lines, err = strconv.Atoi(s)
+		if err != nil || lines < 0 {
+			hh.Error(w, hh.JSONError{Code: hh.ValidationError, Message: "lines is invalid"})
+			return
+		}
+	}
+	appID := params.ByName("app_id")
+	f := logFilter{
+		processType: req.FormValue("process_type"),
+		jobID:       req.FormValue("job_id"),
+	}
+
+	var msgs []*ct.LogMessage
+	var sub *Subscription
+	if req.FormValue("follow") == "true" {
+		msgs, sub = a.agg.Subscribe(appID, f, lines)
+		defer a.agg.Unsubscribe(sub)
+	} else {
+		msgs = a.agg.Read(appID, f, lines)
+	}
+
+	ch := make(chan *ct.LogMessage)
+	s := sse.NewStream(w, ch, nil)
+	s.Serve()
+	go func() {
+		for _, msg := range msgs {
+			select {
+			case ch <- msg:
+			case <-s.Done:
+				return
+			}
+		}
+		if sub != nil {
+			// the subscription channel is closed if the client is too slow
+			for msg := range sub.Ch {
+				select {
+				case ch <- msg:
+				case <-s.Done:
+					return
+				}
+			}
+		}
+		close(ch)
+	}()
+	s.Wait()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	ct "github.com/flynn/flynn/controller/types"
+)
+
+const (
+	// syslog facility and severities (RFC 5424 section 6.2.1)
+	facilityUser   = 1
+	severityError  = 3
+	severityInfo   = 6
+	syslogVersion  = 1
+	syslogNilValue = "-"
+
+	// sdID is the SD-ID of the structured data element which holds the app,
+	// process type and job of a log line. 32473 is the private enterprise
+	// number reserved for documentation (RFC 5612).
+	sdID = "flynn@32473"
+
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// formatSyslog formats msg as an RFC 5424 syslog message framed with its
+// length as described in RFC 6587 section 3.4.1.
+func formatSyslog(msg *ct.LogMessage) []byte {
+	severity := severityInfo
+	if msg.Stream == "stderr" {
+		severity = severityError
+	}
+	procID := msg.ProcessType
+	if procID == "" {
+		procID = syslogNilValue
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>%d %s %s %s %s %s ",
+		facilityUser*8+severity,
+		syslogVersion,
+		msg.Timestamp.UTC().Format(syslogTimeFormat),
+		syslogNilValue, // hostname
+		msg.AppID,
+		procID,
+		syslogNilValue, // msgid
+	)
+	fmt.Fprintf(&buf, `[%s app="%s" process_type="%s" job="%s"] `,
+		sdID,
+		escapeSDParam(msg.AppID),
+		escapeSDParam(msg.ProcessType),
+		escapeSDParam(msg.JobID),
+	)
+	buf.WriteString(msg.Message)
+
+	frame := strconv.AppendInt(nil, int64(buf.Len()), 10)
+	frame = append(frame, ' ')
+	return append(frame, buf.Bytes()...)
+}
+
+// escapeSDParam escapes the characters which must be escaped in a structured
+// data parameter value (RFC 5424 section 6.3.3).
+func escapeSDParam(s string) string {
+	var buf bytes.Buffer
+	for _, c := range s {
+		switch c {
+		case '"', '\\', ']':
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(c)
+	}
+	return buf.String()
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-sql"
 	"github.com/flynn/flynn/Godeps/_workspace/src/golang.org/x/net/context"
@@ -22,11 +23,13 @@ func NewReleaseRepo(db *postgres.DB) *ReleaseRepo {
 	return &ReleaseRepo{db}
 }
 
-func scanRelease(s postgres.Scanner) (*ct.Release, error) {
+// scanRelease scans a release, along with any columns following the release
+// columns into dest.
+func scanRelease(s postgres.Scanner, dest ...interface{}) (*ct.Release, error) {
 	var artifactID *string
 	release := &ct.Release{}
 	var data []byte
-	err := s.Scan(&release.ID, &artifactID, &data, &release.CreatedAt)
+	err := s.Scan(append([]interface{}{&release.ID, &artifactID, &data, &release.CreatedAt}, dest...)...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			err = ErrNotFound
@@ -94,6 +97,32 @@ func (r *ReleaseRepo) List() (interface{}, error) {
 	return releases, rows.Err()
 }
 
+// AppList returns the releases which have been successfully deployed for the
+// given app, ordered by the time they were most recently deployed (newest
+// first). Deployments which failed and were rolled back are ignored.
+func (r *ReleaseRepo) AppList(appID string) ([]*ct.DeployedRelease, error) {
+	query := `SELECT r.release_id, r.artifact_id, r.data, r.created_at, d.deployed_at FROM releases r
+JOIN (SELECT new_release_id, max(finished_at) AS deployed_at FROM deployments d WHERE app_id = $1 AND finished_at IS NOT NULL
+AND NOT EXISTS (SELECT 1 FROM deployment_events e WHERE e.deployment_id = d.deployment_id AND e.status = 'failed')
+GROUP BY new_release_id) d
+ON r.release_id = d.new_release_id WHERE r.deleted_at IS NULL ORDER BY d.deployed_at DESC`
+	rows, err := r.db.Query(query, appID)
+	if err != nil {
+		return nil, err
+	}
+	releases := []*ct.DeployedRelease{}
+	for rows.Next() {
+		var deployedAt *time.Time
+		release, err := scanRelease(rows, &deployedAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		releases = append(releases, &ct.DeployedRelease{Release: *release, DeployedAt: deployedAt})
+	}
+	return releases, rows.Err()
+}
+
 type releaseID struct {
 	ID string `json:"id"`
 }
@@ -135,3 +164,61 @@ func (c *controllerAPI) GetAppRelease(ctx context.Context, w http.ResponseWriter
 	}
 	httphelper.JSON(w, 200, release)
 }
+
+func (c *controllerAPI) ListAppReleases(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	releases, err := c.releaseRepo.AppList(c.getApp(ctx).ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, releases)
+}
+
+func (c *controllerAPI) RollbackAppRelease(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var rid releaseID
+	if err := httphelper.DecodeJSON(req, &rid); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	app := c.getApp(ctx)
+	releases, err := c.releaseRepo.AppList(app.ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	var release *ct.Release
+	if rid.ID == "" {
+		// default to the release deployed before the current one
+		if len(releases) < 2 {
+			respondWithError(w, ct.ValidationError{
+				Message: "app has no previous release to roll back to",
+			})
+			return
+		}
+		release = &releases[1].Release
+	} else {
+		for _, r := range releases {
+			if r.ID == rid.ID {
+				release = &r.Release
+				break
+			}
+		}
+		if release == nil {
+			respondWithError(w, ct.ValidationError{
+				Message: fmt.Sprintf("release %s has not been deployed for this app", rid.ID),
+			})
+			return
+		}
+	}
+
+	if current, err := c.appRepo.GetRelease(app.ID); err == nil && current.ID == release.ID {
+		respondWithError(w, ct.ValidationError{
+			Message: fmt.Sprintf("release %s is already the current release", release.ID),
+		})
+		return
+	}
+
+	c.createDeployment(w, app, release)
+}
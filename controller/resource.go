@@ -1,6 +1,7 @@
 package main
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
@@ -62,6 +63,24 @@ func (rr *ResourceRepo) Add(r *ct.Resource) error {
 	return tx.Commit()
 }
 
+func (rr *ResourceRepo) Remove(id string) error {
+	tx, err := rr.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE resources SET deleted_at = now() WHERE resource_id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("UPDATE app_resources SET deleted_at = now() WHERE resource_id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func envHstore(m map[string]string) hstore.Hstore {
 	res := hstore.Hstore{Map: make(map[string]sql.NullString, len(m))}
 	for k, v := range m {
@@ -190,13 +209,16 @@ func (c *controllerAPI) ProvisionResource(ctx context.Context, w http.ResponseWr
 		Apps:       rr.Apps,
 	}
 
-	if err := schema.Validate(res); err != nil {
-		respondWithError(w, err)
-		return
+	err = schema.Validate(res)
+	if err == nil {
+		err = c.resourceRepo.Add(res)
 	}
-
-	if err := c.resourceRepo.Add(res); err != nil {
-		// TODO: attempt to "rollback" provisioning
+	if err != nil {
+		// the resource was provisioned but can't be registered, so remove it
+		// to avoid leaving it orphaned
+		if err := resource.Deprovision(p.URL, data.ID); err != nil {
+			log.Printf("Error deprovisioning resource %s from provider %s: %s", data.ID, p.ID, err)
+		}
 		respondWithError(w, err)
 		return
 	}
@@ -235,6 +257,36 @@ func (c *controllerAPI) GetResource(ctx context.Context, w http.ResponseWriter,
 	httphelper.JSON(w, 200, res)
 }
 
+func (c *controllerAPI) DeleteResource(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	params, _ := ctxhelper.ParamsFromContext(ctx)
+
+	p, err := c.getProvider(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	res, err := c.resourceRepo.Get(params.ByName("resources_id"))
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if res.ProviderID != p.ID {
+		respondWithError(w, ErrNotFound)
+		return
+	}
+
+	if err := resource.Deprovision(p.URL, res.ExternalID); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := c.resourceRepo.Remove(res.ID); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, res)
+}
+
 func (c *controllerAPI) PutResource(ctx context.Context, w http.ResponseWriter, req *http.Request) {
 	params, _ := ctxhelper.ParamsFromContext(ctx)
 
@@ -93,3 +93,66 @@ func (s *S) TestResourceLists(c *C) {
 	check(s.c.AppResourceList(app1.ID))
 	check(s.c.AppResourceList(app1.ID))
 }
+
+func (s *S) TestDeleteResource(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "delete-resource"})
+
+	deleted := make(chan string, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Assert(req.URL.Path, Equals, "/things")
+		switch req.Method {
+		case "POST":
+			w.Write([]byte(`{"id":"/things/delete-resource","env":{"foo":"baz"}}`))
+		case "DELETE":
+			deleted <- req.URL.Query().Get("id")
+		}
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	p := &ct.Provider{URL: fmt.Sprintf("http://%s/things", srv.Listener.Addr()), Name: "delete-resource"}
+	c.Assert(s.c.CreateProvider(p), IsNil)
+	resource, err := s.c.ProvisionResource(&ct.ResourceReq{ProviderID: p.ID, Apps: []string{app.ID}})
+	c.Assert(err, IsNil)
+
+	res, err := s.c.DeleteResource(p.ID, resource.ID)
+	c.Assert(err, IsNil)
+	c.Assert(res.ID, Equals, resource.ID)
+	c.Assert(<-deleted, Equals, "/things/delete-resource")
+
+	_, err = s.c.GetResource(p.ID, resource.ID)
+	c.Assert(err, Equals, controller.ErrNotFound)
+	list, err := s.c.AppResourceList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 0)
+
+	_, err = s.c.DeleteResource(p.ID, resource.ID)
+	c.Assert(err, Equals, controller.ErrNotFound)
+}
+
+func (s *S) TestProvisionResourceRollback(c *C) {
+	deleted := make(chan string, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "POST":
+			w.Write([]byte(`{"id":"/things/rollback","env":{"foo":"baz"}}`))
+		case "DELETE":
+			deleted <- req.URL.Query().Get("id")
+		}
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	p := &ct.Provider{URL: fmt.Sprintf("http://%s/things", srv.Listener.Addr()), Name: "provision-rollback"}
+	c.Assert(s.c.CreateProvider(p), IsNil)
+
+	// registering the resource with a non-existent app fails, so the
+	// provisioned resource should be deprovisioned
+	_, err := s.c.ProvisionResource(&ct.ResourceReq{ProviderID: p.ID, Apps: []string{random.UUID()}})
+	c.Assert(err, NotNil)
+	c.Assert(<-deleted, Equals, "/things/rollback")
+
+	list, err := s.c.ResourceList(p.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 0)
+}
@@ -56,6 +56,12 @@ func (r *fakeRouter) GetRoute(id string) (*router.Route, error) {
 
 func (r *fakeRouter) SetRoute(*router.Route) error { return nil }
 
+func (r *fakeRouter) ListBackends(string) ([]*router.Backend, error) { return nil, nil }
+
+func (r *fakeRouter) GetRouteStats(string) (*router.RouteStats, error) {
+	return &router.RouteStats{}, nil
+}
+
 type sortedRoutes []*router.Route
 
 func (p sortedRoutes) Len() int           { return len(p) }
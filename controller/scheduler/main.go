@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"os"
 	"sort"
 	"strings"
@@ -528,6 +530,8 @@ func NewFormation(c *context, ef *ct.ExpandedFormation) *Formation {
 		Processes: ef.Processes,
 		jobs:      make(jobTypeMap),
 		c:         c,
+
+		placementErrs: make(map[string]string),
 	}
 }
 
@@ -584,6 +588,10 @@ type Formation struct {
 
 	jobs jobTypeMap
 	c    *context
+
+	// placementErrs is the last placement error reported for each process
+	// type, so that rectify doesn't report the same failure every pass
+	placementErrs map[string]string
 }
 
 func (f *Formation) key() formationKey {
@@ -630,6 +638,14 @@ func (f *Formation) RestartJob(typ, hostID, jobID string) {
 		}
 		job.timerMtx.Lock()
 		job.timer = time.AfterFunc(duration, func() {
+			// the timer fires without the formation locked, so lock it
+			// as restarting updates the jobs and placement errors
+			f.mtx.Lock()
+			defer f.mtx.Unlock()
+			if f.jobs.Get(job.Type, job.HostID, job.ID) != job {
+				// the restart was cancelled while waiting for the lock
+				return
+			}
 			f.restart(job)
 		})
 		job.timerMtx.Unlock()
@@ -652,11 +668,16 @@ func (f *Formation) rectify() {
 	}
 	// update job counts
 	for t, expected := range f.Processes {
-		if f.Release.Processes[t].Omni {
+		if proc := f.Release.Processes[t]; proc.Omni {
 			// get job counts per host
 			hostCounts := make(map[string]int, len(hosts))
+			hostExpected := make(map[string]int, len(hosts))
 			for _, h := range hosts {
 				hostCounts[h.ID] = 0
+				// only run omni jobs on hosts with the required tags
+				if proc.Constraints.Allows(h.ID, h.Metadata) {
+					hostExpected[h.ID] = expected
+				}
 				for _, job := range h.Jobs {
 					if f.jobType(job) != t {
 						continue
@@ -666,6 +687,7 @@ func (f *Formation) rectify() {
 			}
 			// update per host
 			for hostID, actual := range hostCounts {
+				expected := hostExpected[hostID]
 				diff := expected - actual
 				g.Log(grohl.Data{"at": "update", "type": t, "expected": expected, "actual": actual, "diff": diff})
 				if diff > 0 {
@@ -705,7 +727,9 @@ func (f *Formation) add(n int, name string, hostID string) {
 		job, err := f.start(name, hostID)
 		if err != nil {
 			// TODO: handle error
-			g.Log(grohl.Data{"at": "error", "host.id": hostID, "job.name": name, "err": err.Error()})
+			if _, ok := err.(placementError); !ok {
+				g.Log(grohl.Data{"at": "error", "host.id": hostID, "job.name": name, "err": err.Error()})
+			}
 			continue
 		}
 		g.Log(grohl.Data{"at": "started", "host.id": job.HostID, "job.id": job.ID})
@@ -752,20 +776,17 @@ func (f *Formation) start(typ string, hostID string) (job *Job, err error) {
 			}
 		}
 	} else {
-		sh := make(sortHosts, 0, len(hosts))
-		for _, host := range hosts {
-			var count int
-			for _, job := range h.Jobs {
-				if f.jobType(job) != typ {
-					continue
-				}
-				count++
-			}
-			sh = append(sh, sortHost{host, count})
+		sh, err := f.placeHosts(typ, config.Resources, hosts)
+		if err != nil {
+			return nil, f.placementFailed(config, typ, err)
 		}
 		sh.Sort()
 		h = sh[0].Host
 	}
+	if !h.Fits(config.Resources) {
+		err := fmt.Errorf("scheduler: host %s does not have capacity for %s", h.ID, typ)
+		return nil, f.placementFailed(config, typ, err)
+	}
 
 	job = f.jobs.Add(typ, h.ID, config.ID)
 	job.Formation = f
@@ -777,6 +798,7 @@ func (f *Formation) start(typ string, hostID string) (job *Job, err error) {
 		f.c.jobs.Remove(config.ID, h.ID)
 		return nil, err
 	}
+	delete(f.placementErrs, typ)
 	return job, nil
 }
 
@@ -843,9 +865,136 @@ func (f *Formation) jobConfig(name string) *host.Job {
 	}, name)
 }
 
+// placementError is returned by start when the scheduler refuses to place a
+// job rather than overcommit a host or break the placement constraints.
+type placementError struct {
+	err error
+}
+
+func (e placementError) Error() string { return e.err.Error() }
+
+// placementFailed reports a job which could not be placed as a failed job, so
+// that the failure is visible in the app's job events, unless the same
+// failure was the last one reported for the process type.
+func (f *Formation) placementFailed(config *host.Job, typ string, err error) error {
+	if f.placementErrs[typ] == err.Error() {
+		return placementError{err}
+	}
+	f.placementErrs[typ] = err.Error()
+
+	g := grohl.NewContext(grohl.Data{"fn": "placementFailed", "app.id": f.AppID, "release.id": f.Release.ID})
+	g.Log(grohl.Data{
+		"at":        "placement_failed",
+		"job.id":    config.ID,
+		"job.type":  typ,
+		"memory":    config.Resources.Memory,
+		"cpu_quota": config.Resources.CPUQuota,
+		"err":       err.Error(),
+	})
+	job := &ct.Job{
+		ID:        config.ID,
+		AppID:     f.AppID,
+		ReleaseID: f.Release.ID,
+		Type:      typ,
+		State:     "failed",
+		Error:     err.Error(),
+		Meta:      jobMetaFromMetadata(config.Metadata),
+	}
+	go putJobAttempts.Run(func() error {
+		if err := f.c.PutJob(job); err != nil {
+			g.Log(grohl.Data{"at": "put_job", "status": "error", "job.id": job.ID, "err": err})
+			return err
+		}
+		return nil
+	})
+	return placementError{err}
+}
+
+// placeHosts returns the hosts which satisfy the placement constraints of
+// the given process type and have the capacity to run a job requesting the
+// given resources, scored for running another of its jobs.
+func (f *Formation) placeHosts(typ string, resources host.JobResources, hosts []host.Host) (sortHosts, error) {
+	c := f.Release.Processes[typ].Constraints
+	avoid := make(map[string]struct{})
+	if c != nil {
+		for _, t := range c.Avoid {
+			avoid[t] = struct{}{}
+		}
+	}
+
+	// count the jobs of the type per value of the spread tag
+	spread := make(map[string]int)
+	if c != nil && c.Spread != "" {
+		for _, h := range hosts {
+			tag, _ := ct.HostTag(h.ID, h.Metadata, c.Spread)
+			for _, job := range h.Jobs {
+				if f.jobType(job) == typ {
+					spread[tag]++
+				}
+			}
+		}
+	}
+
+	sh := make(sortHosts, 0, len(hosts))
+	var allowed int
+	for _, h := range hosts {
+		if !c.Allows(h.ID, h.Metadata) {
+			continue
+		}
+		allowed++
+		if !h.Fits(resources) {
+			continue
+		}
+		s := sortHost{Host: h, Free: math.MaxInt32}
+		if h.Resources != nil {
+			s.Free = h.Resources.AllocatableMemory - h.Allocated().Memory - resources.Memory
+		}
+		for _, job := range h.Jobs {
+			t := f.jobType(job)
+			if t == typ {
+				s.Jobs++
+			}
+			if _, ok := avoid[t]; ok {
+				s.Avoided++
+			}
+		}
+		if c != nil {
+			for k, v := range c.Prefer {
+				if tag, ok := ct.HostTag(h.ID, h.Metadata, k); !ok || tag != v {
+					s.Unpreferred++
+				}
+			}
+			if c.Spread != "" {
+				tag, _ := ct.HostTag(h.ID, h.Metadata, c.Spread)
+				s.Spread = spread[tag]
+			}
+		}
+		sh = append(sh, s)
+	}
+	if allowed == 0 {
+		return nil, fmt.Errorf("scheduler: no hosts satisfy the placement constraints of %s", typ)
+	}
+	if len(sh) == 0 {
+		return nil, fmt.Errorf("scheduler: no hosts have the capacity for %s (memory: %d KiB, cpu_quota: %d)", typ, resources.Memory, resources.CPUQuota)
+	}
+	return sh, nil
+}
+
 type sortHost struct {
 	Host host.Host
+
+	// Unpreferred is the number of preferred tags the host does not have
+	Unpreferred int
+	// Avoided is the number of jobs of avoided types on the host
+	Avoided int
+	// Spread is the number of jobs of the type on hosts with the same value
+	// of the spread tag as the host
+	Spread int
+	// Jobs is the number of jobs of the type on the host
 	Jobs int
+	// Free is the memory in KiB the host would have left unallocated after
+	// starting the job, jobs are packed onto the hosts with the least left
+	Free int
 }
 
 type sortHosts []sortHost
@@ -855,10 +1004,19 @@ func (h sortHosts) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
 func (h sortHosts) Sort()         { sort.Sort(h) }
 
 func (h sortHosts) Less(i, j int) bool {
-	if h[i].Jobs == h[j].Jobs {
-		return len(h[i].Host.Jobs) < len(h[j].Host.Jobs)
+	switch {
+	case h[i].Unpreferred != h[j].Unpreferred:
+		return h[i].Unpreferred < h[j].Unpreferred
+	case h[i].Avoided != h[j].Avoided:
+		return h[i].Avoided < h[j].Avoided
+	case h[i].Spread != h[j].Spread:
+		return h[i].Spread < h[j].Spread
+	case h[i].Jobs != h[j].Jobs:
+		return h[i].Jobs < h[j].Jobs
+	case h[i].Free != h[j].Free:
+		return h[i].Free < h[j].Free
 	}
-	return h[i].Jobs < h[j].Jobs
+	return len(h[i].Host.Jobs) < len(h[j].Host.Jobs)
 }
 
 type FormationEvent struct {
@@ -185,5 +185,40 @@ $$ LANGUAGE plpgsql`,
     CONSTRAINT que_jobs_pkey PRIMARY KEY (queue, priority, run_at, job_id))`,
 		`COMMENT ON TABLE que_jobs IS '3'`,
 	)
+	m.Add(3,
+		`ALTER TYPE deployment_strategy RENAME TO deployment_strategy_old`,
+		`CREATE TYPE deployment_strategy AS ENUM ('all-at-once', 'one-by-one', 'canary')`,
+		`ALTER TABLE apps ALTER COLUMN strategy DROP DEFAULT`,
+		`ALTER TABLE apps ALTER COLUMN strategy TYPE deployment_strategy USING strategy::text::deployment_strategy`,
+		`ALTER TABLE apps ALTER COLUMN strategy SET DEFAULT 'all-at-once'`,
+		`ALTER TABLE deployments ALTER COLUMN strategy TYPE deployment_strategy USING strategy::text::deployment_strategy`,
+		`DROP TYPE deployment_strategy_old`,
+	)
+	m.Add(4,
+		`ALTER TYPE deployment_status RENAME TO deployment_status_old`,
+		`CREATE TYPE deployment_status AS ENUM ('running', 'complete', 'failed', 'rolled_back')`,
+		`ALTER TABLE deployment_events ALTER COLUMN status DROP DEFAULT`,
+		`ALTER TABLE deployment_events ALTER COLUMN status TYPE deployment_status USING status::text::deployment_status`,
+		`ALTER TABLE deployment_events ALTER COLUMN status SET DEFAULT 'running'`,
+		`DROP TYPE deployment_status_old`,
+	)
+	m.Add(5,
+		`CREATE TABLE drains (
+    drain_id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    app_id uuid NOT NULL REFERENCES apps (app_id),
+    url text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    deleted_at timestamptz
+)`,
+		`CREATE UNIQUE INDEX ON drains (app_id, url) WHERE deleted_at IS NULL`,
+	)
+	m.Add(6,
+		`ALTER TYPE job_state RENAME TO job_state_old`,
+		`CREATE TYPE job_state AS ENUM ('starting', 'up', 'down', 'crashed', 'failed')`,
+		`ALTER TABLE job_cache ALTER COLUMN state TYPE job_state USING state::text::job_state`,
+		`ALTER TABLE job_events ALTER COLUMN state TYPE job_state USING state::text::job_state`,
+		`DROP TYPE job_state_old`,
+		`ALTER TABLE job_cache ADD COLUMN error text NOT NULL DEFAULT ''`,
+	)
 	return m.Migrate(db)
 }
@@ -57,6 +57,9 @@ func schemaForType(thing interface{}) *jsonschema.Schema {
 	if name == "newjob" {
 		name = "new_job"
 	}
+	if name == "newexec" {
+		name = "new_exec"
+	}
 	if name == "appupdate" {
 		name = "app"
 	}
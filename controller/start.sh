@@ -4,8 +4,9 @@ case $1 in
   controller) exec /bin/flynn-controller ;;
   scheduler)  exec /bin/flynn-scheduler ;;
   deployer)  exec /bin/flynn-deployer ;;
+  logaggregator) exec /bin/flynn-logaggregator ;;
   *)
-    echo "Usage: $0 {controller|scheduler|deployer}"
+    echo "Usage: $0 {controller|scheduler|deployer|logaggregator}"
     exit 2
     ;;
 esac
@@ -18,6 +18,9 @@ func NewFakeHostClient(hostID string) *FakeHostClient {
 		hostID:  hostID,
 		stopped: make(map[string]bool),
 		attach:  make(map[string]attachFunc),
+		exec:    make(map[string]execFunc),
+		stats:   make(map[string]*host.JobStats),
+		logs:    make(map[string][]*host.LogEntry),
 	}
 }
 
@@ -25,6 +28,9 @@ type FakeHostClient struct {
 	hostID    string
 	stopped   map[string]bool
 	attach    map[string]attachFunc
+	exec      map[string]execFunc
+	stats     map[string]*host.JobStats
+	logs      map[string][]*host.LogEntry
 	cluster   *FakeCluster
 	listeners []chan<- *host.Event
 	listenMtx sync.RWMutex
@@ -42,6 +48,14 @@ func (c *FakeHostClient) Attach(req *host.AttachReq, wait bool) (cluster.AttachC
 	return f(req, wait)
 }
 
+func (c *FakeHostClient) Exec(req *host.ExecReq) (cluster.AttachClient, error) {
+	f, ok := c.exec[req.JobID]
+	if !ok {
+		return nil, errors.New("job not found")
+	}
+	return f(req)
+}
+
 func (c *FakeHostClient) GetJob(id string) (*host.ActiveJob, error) {
 	hosts, err := c.cluster.ListHosts()
 	if err != nil {
@@ -65,6 +79,39 @@ func (c *FakeHostClient) StreamEvents(id string, ch chan<- *host.Event) (stream.
 	return &FakeHostEventStream{ch: ch}, nil
 }
 
+func (c *FakeHostClient) GetJobStats(id string) (*host.JobStats, error) {
+	stats, ok := c.stats[id]
+	if !ok {
+		return nil, errors.New("job not found")
+	}
+	return stats, nil
+}
+
+func (c *FakeHostClient) StreamJobStats(id string, interval time.Duration, ch chan<- *host.JobStats) (stream.Stream, error) {
+	return nil, nil
+}
+
+func (c *FakeHostClient) StreamJobLog(id string, since time.Time, follow bool, ch chan<- *host.LogEntry) (stream.Stream, error) {
+	entries := c.logs[id]
+	go func() {
+		for _, entry := range entries {
+			if !entry.Timestamp.Before(since) {
+				ch <- entry
+			}
+		}
+		close(ch)
+	}()
+	return stream.New(), nil
+}
+
+func (c *FakeHostClient) SetJobLog(id string, entries []*host.LogEntry) {
+	c.logs[id] = entries
+}
+
+func (c *FakeHostClient) SetJobStats(id string, stats *host.JobStats) {
+	c.stats[id] = stats
+}
+
 func (c *FakeHostClient) StopJob(id string) error {
 	c.stopped[id] = true
 	c.cluster.RemoveJob(c.hostID, id, false)
@@ -85,6 +132,10 @@ func (c *FakeHostClient) SetAttachFunc(id string, f attachFunc) {
 	c.attach[id] = f
 }
 
+func (c *FakeHostClient) SetExecFunc(id string, f execFunc) {
+	c.exec[id] = f
+}
+
 func (c *FakeHostClient) SendEvent(event, id string) {
 	c.listenMtx.RLock()
 	defer c.listenMtx.RUnlock()
@@ -104,6 +155,8 @@ func (c *FakeHostClient) PullImages(repository, driver, root string, tufDB io.Re
 
 type attachFunc func(req *host.AttachReq, wait bool) (cluster.AttachClient, error)
 
+type execFunc func(req *host.ExecReq) (cluster.AttachClient, error)
+
 type FakeHostEventStream struct {
 	ch chan<- *host.Event
 }
@@ -117,6 +170,30 @@ func (h *FakeHostEventStream) Err() error {
 	return nil
 }
 
-func (c *FakeHostClient) CreateVolume(providerId string) (*volume.Info, error) {
+func (c *FakeHostClient) CreateVolume(providerId string, size int64) (*volume.Info, error) {
+	return nil, nil
+}
+
+func (c *FakeHostClient) ListVolumes() ([]*volume.Info, error) {
+	return nil, nil
+}
+
+func (c *FakeHostClient) DestroyVolume(volumeID string) error {
+	return nil
+}
+
+func (c *FakeHostClient) CreateSnapshot(volumeID string) (*volume.Info, error) {
+	return nil, nil
+}
+
+func (c *FakeHostClient) ListSnapshots(volumeID string) ([]*volume.Info, error) {
+	return nil, nil
+}
+
+func (c *FakeHostClient) SendVolume(volumeID string) (io.ReadCloser, *volume.StreamInfo, error) {
+	return nil, nil, nil
+}
+
+func (c *FakeHostClient) ReceiveVolume(providerID string, info *volume.StreamInfo, input io.Reader) (*volume.Info, error) {
 	return nil, nil
 }
@@ -35,6 +35,13 @@ type Release struct {
 	CreatedAt  *time.Time             `json:"created_at,omitempty"`
 }
 
+// DeployedRelease is a release along with the time it was most recently
+// successfully deployed for an app.
+type DeployedRelease struct {
+	Release
+	DeployedAt *time.Time `json:"deployed_at,omitempty"`
+}
+
 type ProcessType struct {
 	Cmd         []string          `json:"cmd,omitempty"`
 	Entrypoint  []string          `json:"entrypoint,omitempty"`
@@ -43,6 +50,59 @@ type ProcessType struct {
 	Data        bool              `json:"data,omitempty"`
 	Omni        bool              `json:"omni,omitempty"` // omnipresent - present on all hosts
 	HostNetwork bool              `json:"host_network,omitempty"`
+	Resources   host.JobResources `json:"resources,omitempty"`
+
+	// Constraints restrict which hosts the scheduler places jobs of the
+	// process type on.
+	Constraints *PlacementConstraints `json:"constraints,omitempty"`
+}
+
+// HostIDTag is an implicit tag of every host, set to the host's ID, which can
+// be used in placement constraints alongside the tags that hosts advertise
+// with flynn-host daemon --meta.
+const HostIDTag = "host_id"
+
+// PlacementConstraints are the rules the scheduler follows when choosing a
+// host for a job, based on the tags (metadata) of each host.
+type PlacementConstraints struct {
+	// Require is a set of tags a host must have to run the job. Jobs are not
+	// started if no host has them.
+	Require map[string]string `json:"require,omitempty"`
+
+	// Prefer is a set of tags which hosts are favoured for having.
+	Prefer map[string]string `json:"prefer,omitempty"`
+
+	// Spread is a tag key, such as "zone", across the values of which the
+	// jobs of the process type are spread evenly.
+	Spread string `json:"spread,omitempty"`
+
+	// Avoid is a list of other process types of the release, hosts running
+	// jobs of which are avoided where possible.
+	Avoid []string `json:"avoid,omitempty"`
+}
+
+// HostTag returns the value of the given tag for a host with the given ID and
+// metadata.
+func HostTag(hostID string, meta map[string]string, key string) (string, bool) {
+	if key == HostIDTag {
+		return hostID, true
+	}
+	v, ok := meta[key]
+	return v, ok
+}
+
+// Allows reports whether a host with the given ID and metadata has all of the
+// required tags.
+func (c *PlacementConstraints) Allows(hostID string, meta map[string]string) bool {
+	if c == nil {
+		return true
+	}
+	for k, v := range c.Require {
+		if tag, ok := HostTag(hostID, meta, k); !ok || tag != v {
+			return false
+		}
+	}
+	return true
 }
 
 type Port struct {
@@ -79,6 +139,7 @@ type Job struct {
 	ReleaseID string            `json:"release,omitempty"`
 	Type      string            `json:"type,omitempty"`
 	State     string            `json:"state,omitempty"`
+	Error     string            `json:"error,omitempty"`
 	Cmd       []string          `json:"cmd,omitempty"`
 	Meta      map[string]string `json:"meta,omitempty"`
 	CreatedAt *time.Time        `json:"created_at,omitempty"`
@@ -91,6 +152,40 @@ type JobEvent struct {
 	JobID string `json:"job_id,omitempty"`
 }
 
+// LogMessage is a line of output from one of an app's jobs, as streamed by
+// GET /apps/:apps_id/log.
+type LogMessage struct {
+	AppID       string    `json:"app"`
+	JobID       string    `json:"job_id"`
+	ProcessType string    `json:"process_type,omitempty"`
+	Stream      string    `json:"stream"` // "stdout" or "stderr"
+	Timestamp   time.Time `json:"timestamp"`
+	Message     string    `json:"message"`
+}
+
+// LogOpts are the options for GET /apps/:apps_id/log, which are sent as the
+// query parameters lines, follow, process_type and job_id.
+type LogOpts struct {
+	// Lines is the number of buffered lines to return, or all of them if
+	// it is zero.
+	Lines int
+
+	// Follow streams new lines after the buffered ones.
+	Follow bool
+
+	ProcessType string
+	JobID       string
+}
+
+// Drain is a syslog server which the logs of an app are forwarded to. URL
+// is syslog://host:port for TCP or syslog+tls://host:port for TLS.
+type Drain struct {
+	ID        string     `json:"id,omitempty"`
+	AppID     string     `json:"app,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
 type NewJob struct {
 	ReleaseID  string            `json:"release,omitempty"`
 	Cmd        []string          `json:"cmd,omitempty"`
@@ -102,6 +197,14 @@ type NewJob struct {
 	Lines      int               `json:"tty_lines,omitempty"`
 }
 
+// NewExec is a request to run a command with a TTY in a running job.
+type NewExec struct {
+	Cmd     []string          `json:"cmd,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Columns int               `json:"tty_columns,omitempty"`
+	Lines   int               `json:"tty_lines,omitempty"`
+}
+
 type Deployment struct {
 	ID           string     `json:"id,omitempty"`
 	AppID        string     `json:"app,omitempty"`
@@ -23,6 +23,7 @@ func JobConfig(f *ct.ExpandedFormation, name string) *host.Job {
 			"flynn-controller.release":  f.Release.ID,
 			"flynn-controller.type":     name,
 		},
+		Resources: t.Resources,
 		Artifact: host.Artifact{
 			Type: f.Artifact.Type,
 			URI:  f.Artifact.URI,
@@ -22,6 +22,8 @@ type Service interface {
 	Watch(events chan *Event) (stream.Stream, error)
 	GetMeta() (*ServiceMeta, error)
 	SetMeta(*ServiceMeta) error
+	SetLeaderPolicy(*LeaderPolicy) error
+	StepDownLeader() error
 }
 
 var ErrTimedOut = errors.New("discoverd: timed out waiting for instances")
@@ -209,3 +211,113 @@ func (s *service) GetMeta() (*ServiceMeta, error) {
 func (s *service) SetMeta(m *ServiceMeta) error {
 	return s.client.c.Put(fmt.Sprintf("/services/%s/meta", s.name), m, m)
 }
+
+// LeaderType is the method used to elect the leader of a service.
+type LeaderType string
+
+const (
+	// LeaderTypeOldest elects the instance with the lowest index, this is the
+	// default.
+	LeaderTypeOldest LeaderType = "oldest"
+
+	// LeaderTypeManual elects the instance with the ID given by the policy,
+	// falling back to the oldest instance if it is not registered.
+	LeaderTypeManual LeaderType = "manual"
+
+	// LeaderTypeMeta elects the oldest instance which has the metadata given
+	// by the policy, falling back to the oldest instance if there are none.
+	LeaderTypeMeta LeaderType = "meta"
+)
+
+// leaderPolicyKey is the key of the service metadata object that the leader
+// policy is stored in.
+const leaderPolicyKey = "leader_policy"
+
+// LeaderPolicy configures how the leader of a service is elected. It is
+// stored in the service metadata, which must be a JSON object if a policy is
+// set.
+type LeaderPolicy struct {
+	Type LeaderType `json:"type"`
+
+	// InstanceID is the ID of the leader if Type is LeaderTypeManual.
+	InstanceID string `json:"instance_id,omitempty"`
+
+	// MetaKey and MetaValue are the instance metadata preferred if Type is
+	// LeaderTypeMeta. An empty MetaValue matches any instance with MetaKey
+	// set.
+	MetaKey   string `json:"meta_key,omitempty"`
+	MetaValue string `json:"meta_value,omitempty"`
+}
+
+func (p *LeaderPolicy) Valid() error {
+	switch p.Type {
+	case LeaderTypeOldest:
+	case LeaderTypeManual:
+		if p.InstanceID == "" {
+			return errors.New("discoverd: manual leader policy must have an instance_id")
+		}
+	case LeaderTypeMeta:
+		if p.MetaKey == "" {
+			return errors.New("discoverd: meta leader policy must have a meta_key")
+		}
+	default:
+		return fmt.Errorf("discoverd: unknown leader type %q", p.Type)
+	}
+	return nil
+}
+
+// LeaderPolicy returns the leader policy stored in the metadata, or nil if
+// there is none.
+func (m *ServiceMeta) LeaderPolicy() (*LeaderPolicy, error) {
+	if !strings.HasPrefix(strings.TrimSpace(string(m.Data)), "{") {
+		// metadata which is not an object can't contain a policy
+		return nil, nil
+	}
+	var data struct {
+		LeaderPolicy *LeaderPolicy `json:"leader_policy"`
+	}
+	if err := json.Unmarshal(m.Data, &data); err != nil {
+		return nil, err
+	}
+	return data.LeaderPolicy, nil
+}
+
+// SetLeaderPolicy stores the leader policy in the service metadata, keeping
+// any other fields of the metadata object. A nil policy removes any existing
+// policy so that the oldest instance is elected.
+func (s *service) SetLeaderPolicy(p *LeaderPolicy) error {
+	meta, err := s.GetMeta()
+	if IsNotFound(err) {
+		meta = &ServiceMeta{}
+	} else if err != nil {
+		return err
+	}
+	var data map[string]json.RawMessage
+	if len(meta.Data) > 0 {
+		if err := json.Unmarshal(meta.Data, &data); err != nil {
+			return fmt.Errorf("discoverd: service metadata is not an object: %s", err)
+		}
+	}
+	if data == nil {
+		data = make(map[string]json.RawMessage)
+	}
+	if p == nil {
+		delete(data, leaderPolicyKey)
+	} else {
+		if data[leaderPolicyKey], err = json.Marshal(p); err != nil {
+			return err
+		}
+	}
+	if meta.Data, err = json.Marshal(data); err != nil {
+		return err
+	}
+	return s.SetMeta(meta)
+}
+
+// StepDownLeader forces the current leader to step down so that the next
+// instance chosen by the leader policy is elected. It fails if the leader
+// is pinned by a manual leader policy, or if no other instance would be
+// elected.
+func (s *service) StepDownLeader() error {
+	return s.client.c.Delete(fmt.Sprintf("/services/%s/leader", s.name))
+}
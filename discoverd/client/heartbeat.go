@@ -44,13 +44,31 @@ func (c *Client) Register(service, addr string) (Heartbeater, error) {
 }
 
 func (c *Client) RegisterInstance(service string, inst *Instance) (Heartbeater, error) {
+	return c.RegisterInstanceWithInterval(service, inst, 0)
+}
+
+// RegisterInstanceWithInterval registers the instance and sends heartbeats
+// at the given interval, which must be shorter than the instance's TTL. A
+// zero interval heartbeats at half the TTL.
+func (c *Client) RegisterInstanceWithInterval(service string, inst *Instance, interval time.Duration) (Heartbeater, error) {
+	ttl := inst.TTL
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	if interval == 0 {
+		interval = ttl / 2
+	}
+	if interval < 0 || interval >= ttl {
+		return nil, ErrInvalidInterval
+	}
 	firstErr := make(chan error)
 	h := &heartbeater{
-		c:       c,
-		service: service,
-		stop:    make(chan struct{}),
-		done:    make(chan struct{}),
-		inst:    inst.Clone(),
+		c:        c,
+		service:  service,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		inst:     inst.Clone(),
 	}
 	h.inst.Addr = expandAddr(h.inst.Addr)
 	if h.inst.Proto == "" {
@@ -69,8 +87,9 @@ type heartbeater struct {
 	sync.Mutex
 	inst *Instance
 
-	service string
-	closed  bool
+	service  string
+	interval time.Duration
+	closed   bool
 }
 
 func (h *heartbeater) Close() error {
@@ -93,7 +112,8 @@ func (h *heartbeater) Addr() string {
 	return h.inst.Addr
 }
 
-const heartbeatInterval = 5 * time.Second
+// defaultTTL is the TTL the server gives instances which don't set one.
+const defaultTTL = 10 * time.Second
 
 func (h *heartbeater) run(firstErr chan<- error) {
 	h.inst.ID = h.inst.id()
@@ -109,7 +129,7 @@ func (h *heartbeater) run(firstErr chan<- error) {
 	if err != nil {
 		return
 	}
-	ticker := time.NewTicker(heartbeatInterval)
+	ticker := time.NewTicker(h.interval)
 	for {
 		select {
 		case <-ticker.C:
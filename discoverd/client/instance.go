@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"time"
 )
 
 type EventKind uint
@@ -18,6 +19,10 @@ const (
 	EventKindLeader
 	EventKindCurrent
 	EventKindServiceMeta
+	// EventKindExpired is sent instead of EventKindDown when an instance
+	// is removed because it stopped sending heartbeats, rather than
+	// because it was unregistered.
+	EventKindExpired
 	EventKindAll     = ^EventKind(0)
 	EventKindUnknown = EventKind(0)
 )
@@ -30,6 +35,7 @@ var eventKindStrings = map[EventKind]string{
 	EventKindCurrent:     "current",
 	EventKindUnknown:     "unknown",
 	EventKindServiceMeta: "service_meta",
+	EventKindExpired:     "expired",
 }
 
 func (k EventKind) String() string {
@@ -85,6 +91,14 @@ func (e *Event) String() string {
 	return fmt.Sprintf("[%s] %s %#v", e.Service, e.Kind, e.Instance)
 }
 
+// Well-known Instance.Meta keys which set the priority and weight (as defined
+// in RFC 2782) of the SRV records served for the instance over DNS. Both
+// default to 1.
+const (
+	MetaSRVPriority = "srv_priority"
+	MetaSRVWeight   = "srv_weight"
+)
+
 // Instance is a single running instance of a service. It is immutable after it
 // has been initialized.
 type Instance struct {
@@ -100,7 +114,9 @@ type Instance struct {
 	// tcp, udp, http, https. It must be lowercase alphanumeric.
 	Proto string `json:"proto"`
 
-	// Meta is arbitrary metadata specified when registering the instance.
+	// Meta is arbitrary metadata specified when registering the instance. It
+	// is served in DNS TXT records, and the MetaSRVPriority and MetaSRVWeight
+	// keys set the priority and weight of the instance's DNS SRV records.
 	Meta map[string]string `json:"meta,omitempty"`
 
 	// Index is the logical epoch of the initial registration of the instance.
@@ -109,6 +125,11 @@ type Instance struct {
 	// instance creation.
 	Index uint64 `json:"index,omitempty"`
 
+	// TTL is how long the instance stays registered without a heartbeat
+	// before it expires. It is rounded up to the nearest second, and zero
+	// means the server default of 10 seconds.
+	TTL time.Duration `json:"ttl,omitempty"`
+
 	// addrOnce is used to initialize host/port
 	addrOnce sync.Once
 	host     string
@@ -125,6 +146,9 @@ func (inst *Instance) Valid() error {
 	if err := inst.validProto(); err != nil {
 		return err
 	}
+	if inst.TTL < 0 {
+		return ErrInvalidTTL
+	}
 	if _, _, err := net.SplitHostPort(inst.Addr); err != nil {
 		return err
 	}
@@ -152,6 +176,8 @@ func (inst *Instance) splitHostPort() {
 
 var ErrUnsetProto = errors.New("discoverd: proto must be set")
 var ErrInvalidProto = errors.New("discoverd: proto must be lowercase alphanumeric")
+var ErrInvalidTTL = errors.New("discoverd: ttl must not be negative")
+var ErrInvalidInterval = errors.New("discoverd: heartbeat interval must be positive and shorter than the ttl")
 
 func (inst *Instance) validProto() error {
 	if inst.Proto == "" {
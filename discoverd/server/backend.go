@@ -8,6 +8,7 @@ type Backend interface {
 	AddInstance(service string, inst *discoverd.Instance) error
 	RemoveInstance(service, id string) error
 	SetServiceMeta(service string, meta *discoverd.ServiceMeta) error
+	StepDownLeader(service, id string) error
 	StartSync() error
 	Close() error
 }
@@ -17,6 +18,7 @@ type SyncHandler interface {
 	RemoveService(service string)
 	AddInstance(service string, inst *discoverd.Instance)
 	RemoveInstance(service, id string)
+	ExpireInstance(service, id string)
 	SetService(service string, data []*discoverd.Instance)
 	SetServiceMeta(service string, meta []byte, index uint64)
 	ListServices() []string
@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,6 +16,7 @@ import (
 type DNSStore interface {
 	Get(string) []*discoverd.Instance
 	GetLeader(string) *discoverd.Instance
+	GetServiceMeta(string) *discoverd.ServiceMeta
 }
 
 type DNSServer struct {
@@ -28,6 +30,7 @@ type DNSServer struct {
 }
 
 const maxUDPRecords = 3
+const maxTXTString = 255
 const dnsDomain = "discoverd."
 
 func (srv *DNSServer) ListenAndServe() error {
@@ -179,10 +182,15 @@ func (d dnsAPI) ServiceLookup(w dns.ResponseWriter, req *dns.Msg) {
 	var proto string
 	var instanceID string
 	var leader bool
+	var meta bool
 	switch {
 	case len(labels) == 1:
 		// normal lookup
 		service = labels[0]
+	case len(labels) == 2 && labels[0] == "_meta":
+		// service metadata lookup
+		meta = true
+		service = labels[1]
 	case len(labels) == 2 && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_"):
 		// RFC 2782 request looks like _postgres._tcp
 		service = labels[0][1:]
@@ -209,6 +217,15 @@ func (d dnsAPI) ServiceLookup(w dns.ResponseWriter, req *dns.Msg) {
 		}
 	}
 
+	if meta {
+		serviceMeta := d.Store.GetServiceMeta(service)
+		if serviceMeta == nil || qType != dns.TypeTXT && qType != dns.TypeANY {
+			return
+		}
+		res.Answer = []dns.RR{txtRecord(qName, txtStrings(string(serviceMeta.Data)))}
+		return
+	}
+
 	if leader || instanceID != "" {
 		// we're doing a lookup for a single instance
 		var resInst *discoverd.Instance
@@ -228,6 +245,12 @@ func (d dnsAPI) ServiceLookup(w dns.ResponseWriter, req *dns.Msg) {
 		}
 
 		addr := parseAddr(resInst)
+		if qType == dns.TypeTXT {
+			if len(addr.Meta) > 0 {
+				res.Answer = []dns.RR{txtRecord(qName, addr.Meta)}
+			}
+			return
+		}
 		if qType != dns.TypeA && qType != dns.TypeAAAA && qType != dns.TypeANY && qType != dns.TypeSRV ||
 			addr.IPv4 == nil && qType == dns.TypeA ||
 			addr.IPv6 == nil && qType == dns.TypeAAAA {
@@ -235,15 +258,21 @@ func (d dnsAPI) ServiceLookup(w dns.ResponseWriter, req *dns.Msg) {
 			// request type or the type is incorrect
 			return
 		}
-		res.Answer = make([]dns.RR, 0, 2)
+		res.Answer = make([]dns.RR, 0, 3)
 		if qType != dns.TypeSRV {
 			res.Answer = append(res.Answer, addrRecord(qName, addr))
 		}
 		if qType == dns.TypeSRV || qType == dns.TypeANY {
 			res.Answer = append(res.Answer, d.srvRecord(qName, service, addr, false))
 		}
+		if qType == dns.TypeANY && len(addr.Meta) > 0 {
+			res.Answer = append(res.Answer, txtRecord(qName, addr.Meta))
+		}
 		if tcp && qType == dns.TypeSRV {
 			res.Extra = []dns.RR{addrRecord(qName, addr)}
+			if len(addr.Meta) > 0 {
+				res.Extra = append(res.Extra, txtRecord(qName, addr.Meta))
+			}
 		}
 		return
 	}
@@ -279,9 +308,10 @@ func (d dnsAPI) ServiceLookup(w dns.ResponseWriter, req *dns.Msg) {
 		// return empty response
 		return
 	}
-	shuffle(addrs)
+	sortAddrs(addrs)
 
-	// Truncate the response if we're using UDP
+	// Truncate the response if we're using UDP, keeping the addresses that
+	// clients would pick first
 	if !tcp && len(addrs) > maxUDPRecords {
 		addrs = addrs[:maxUDPRecords]
 	}
@@ -299,10 +329,14 @@ func (d dnsAPI) ServiceLookup(w dns.ResponseWriter, req *dns.Msg) {
 	}
 
 	if qType == dns.TypeSRV && tcp {
-		// Add extra records mapping instance IDs to addresses
-		res.Extra = make([]dns.RR, len(addrs))
-		for i, addr := range addrs {
-			res.Extra[i] = addrRecord(d.instanceDomain(service, addr.ID), addr)
+		// Add extra records mapping instance IDs to addresses and metadata
+		res.Extra = make([]dns.RR, 0, len(addrs))
+		for _, addr := range addrs {
+			name := d.instanceDomain(service, addr.ID)
+			res.Extra = append(res.Extra, addrRecord(name, addr))
+			if len(addr.Meta) > 0 {
+				res.Extra = append(res.Extra, txtRecord(name, addr.Meta))
+			}
 		}
 	}
 }
@@ -330,8 +364,8 @@ func (d dnsAPI) srvRecord(name, service string, addr *addrData, instTarget bool)
 			Rrtype: dns.TypeSRV,
 			Class:  dns.ClassINET,
 		},
-		Priority: 1,
-		Weight:   1,
+		Priority: addr.Priority,
+		Weight:   addr.Weight,
 		Port:     addr.Port,
 		Target:   name,
 	}
@@ -366,16 +400,75 @@ func addrRecord(name string, addr *addrData) dns.RR {
 	}
 }
 
+// txtRecord returns a TXT record containing the given strings, which must
+// already be escaped by txtEscape.
+func txtRecord(name string, txt []string) dns.RR {
+	return &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+		},
+		Txt: txt,
+	}
+}
+
+// txtEscape escapes backslashes, as the dns package expects TXT strings in
+// presentation format.
+func txtEscape(s string) string {
+	return strings.Replace(s, `\`, `\\`, -1)
+}
+
+// txtStrings splits s into escaped strings short enough to fit in a TXT
+// record.
+func txtStrings(s string) []string {
+	var res []string
+	var buf []byte
+	for i := 0; i < len(s); i++ {
+		if len(buf) >= maxTXTString-1 {
+			res = append(res, string(buf))
+			buf = buf[:0]
+		}
+		if s[i] == '\\' {
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, s[i])
+	}
+	return append(res, string(buf))
+}
+
+// metaStrings returns escaped RFC 1464 style "key=value" strings for the
+// given instance metadata, sorted by key. Pairs that do not fit in a single
+// TXT string are omitted.
+func metaStrings(meta map[string]string) []string {
+	res := make([]string, 0, len(meta))
+	for k, v := range meta {
+		if s := txtEscape(k + "=" + v); len(s) <= maxTXTString {
+			res = append(res, s)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
 type addrData struct {
-	IPv6   net.IP
-	IPv4   net.IP
-	String string
-	Port   uint16
-	ID     string
+	IPv6     net.IP
+	IPv4     net.IP
+	String   string
+	Port     uint16
+	ID       string
+	Priority uint16
+	Weight   uint16
+	Meta     []string
 }
 
 func parseAddr(inst *discoverd.Instance) *addrData {
-	res := &addrData{ID: inst.ID}
+	res := &addrData{
+		ID:       inst.ID,
+		Priority: parseMetaUint16(inst.Meta, discoverd.MetaSRVPriority, 1),
+		Weight:   parseMetaUint16(inst.Meta, discoverd.MetaSRVWeight, 1),
+		Meta:     metaStrings(inst.Meta),
+	}
 	ip, port, _ := net.SplitHostPort(inst.Addr)
 	res.String = ip
 	portInt, _ := strconv.Atoi(port)
@@ -388,6 +481,14 @@ func parseAddr(inst *discoverd.Instance) *addrData {
 	return res
 }
 
+func parseMetaUint16(meta map[string]string, key string, def uint16) uint16 {
+	n, err := strconv.ParseUint(meta[key], 10, 16)
+	if err != nil {
+		return def
+	}
+	return uint16(n)
+}
+
 func shuffle(s []*addrData) []*addrData {
 	for i := len(s) - 1; i > 0; i-- {
 		j := random.Math.Intn(i + 1)
@@ -396,6 +497,47 @@ func shuffle(s []*addrData) []*addrData {
 	return s
 }
 
+type addrsByPriority []*addrData
+
+func (a addrsByPriority) Len() int           { return len(a) }
+func (a addrsByPriority) Less(i, j int) bool { return a[i].Priority < a[j].Priority }
+func (a addrsByPriority) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// sortAddrs orders s by ascending SRV priority, and the addresses within each
+// priority by a weighted random selection as described in RFC 2782.
+func sortAddrs(s []*addrData) {
+	sort.Stable(addrsByPriority(shuffle(s)))
+	for i := 0; i < len(s); {
+		j := i + 1
+		for j < len(s) && s[j].Priority == s[i].Priority {
+			j++
+		}
+		weightedShuffle(s[i:j])
+		i = j
+	}
+}
+
+// weightedShuffle orders s so that each position is filled by one of the
+// remaining addresses with a probability proportional to its weight.
+// Addresses with a weight of zero are left at the end in random order.
+func weightedShuffle(s []*addrData) {
+	var total int
+	for _, addr := range s {
+		total += int(addr.Weight)
+	}
+	for i := 0; i < len(s) && total > 0; i++ {
+		n := random.Math.Intn(total)
+		for j := i; j < len(s); j++ {
+			if n < int(s[j].Weight) {
+				total -= int(s[j].Weight)
+				s[i], s[j] = s[j], s[i]
+				break
+			}
+			n -= int(s[j].Weight)
+		}
+	}
+}
+
 func isTCP(addr net.Addr) bool {
 	_, ok := addr.(*net.TCPAddr)
 	return ok
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"strconv"
@@ -538,6 +539,200 @@ func (s *DNSSuite) TestServiceLookup(c *C) {
 	}
 }
 
+func (s *DNSSuite) exchange(c *C, net, domain string, q uint16) *dns.Msg {
+	client := &dns.Client{Net: net}
+	req := &dns.Msg{}
+	req.SetQuestion(domain, q)
+	addr := s.srv.UDPAddr
+	if net == "tcp" {
+		addr = s.srv.TCPAddr
+	}
+	res, _, err := client.Exchange(req, addr)
+	c.Assert(err, IsNil)
+	return res
+}
+
+func (s *DNSSuite) TestInstanceMeta(c *C) {
+	inst, _ := fakeStaticInstance("tcp", "192.168.0.1", 80)
+	inst.Meta = map[string]string{
+		"foo":                     "bar",
+		"path":                    `C:\foo`,
+		discoverd.MetaSRVPriority: "10",
+		discoverd.MetaSRVWeight:   "20",
+	}
+	other, _ := fakeStaticInstance("tcp", "192.168.0.2", 81)
+	s.state.SetService("a", []*discoverd.Instance{inst, other})
+
+	instDomain := fmt.Sprintf("%s.a._i.discoverd.", inst.ID)
+	otherDomain := fmt.Sprintf("%s.a._i.discoverd.", other.ID)
+	expected := []string{"foo=bar", `path=C:\\foo`, "srv_priority=10", "srv_weight=20"}
+
+	for _, net := range []string{"udp", "tcp"} {
+		c.Log(net)
+
+		// TXT lookups of instances return their metadata
+		for _, domain := range []string{instDomain, "leader.a.discoverd."} {
+			res := s.exchange(c, net, domain, dns.TypeTXT)
+			c.Assert(res.Rcode, Equals, dns.RcodeSuccess)
+			c.Assert(res.Answer, HasLen, 1)
+			txt, ok := res.Answer[0].(*dns.TXT)
+			c.Assert(ok, Equals, true)
+			c.Assert(txt.Hdr.Name, Equals, domain)
+			c.Assert(txt.Txt, DeepEquals, expected)
+		}
+
+		// instances without metadata have no TXT record
+		res := s.exchange(c, net, otherDomain, dns.TypeTXT)
+		c.Assert(res.Rcode, Equals, dns.RcodeSuccess)
+		c.Assert(res.Answer, HasLen, 0)
+		assertSOA(c, res.Ns)
+
+		// ANY lookups include the TXT record
+		res = s.exchange(c, net, instDomain, dns.TypeANY)
+		c.Assert(res.Answer, HasLen, 3)
+		var found bool
+		for _, rr := range res.Answer {
+			if txt, ok := rr.(*dns.TXT); ok {
+				found = true
+				c.Assert(txt.Txt, DeepEquals, expected)
+			}
+		}
+		c.Assert(found, Equals, true)
+
+		// SRV records use the priority and weight from the metadata
+		res = s.exchange(c, net, "a.discoverd.", dns.TypeSRV)
+		c.Assert(res.Answer, HasLen, 2)
+		for _, rr := range res.Answer {
+			srv := rr.(*dns.SRV)
+			if srv.Target == instDomain {
+				c.Assert(srv.Priority, Equals, uint16(10))
+				c.Assert(srv.Weight, Equals, uint16(20))
+			} else {
+				c.Assert(srv.Target, Equals, otherDomain)
+				c.Assert(srv.Priority, Equals, uint16(1))
+				c.Assert(srv.Weight, Equals, uint16(1))
+			}
+		}
+
+		// SRV responses over TCP include TXT records in the extra section
+		if net == "tcp" {
+			c.Assert(res.Extra, HasLen, 3)
+			var txts int
+			for _, rr := range res.Extra {
+				if txt, ok := rr.(*dns.TXT); ok {
+					txts++
+					c.Assert(txt.Hdr.Name, Equals, instDomain)
+					c.Assert(txt.Txt, DeepEquals, expected)
+				}
+			}
+			c.Assert(txts, Equals, 1)
+		} else {
+			c.Assert(res.Extra, HasLen, 0)
+		}
+	}
+
+	// invalid priorities and weights fall back to the default
+	inst.Meta = map[string]string{
+		discoverd.MetaSRVPriority: "-1",
+		discoverd.MetaSRVWeight:   "100000",
+	}
+	s.state.SetService("a", []*discoverd.Instance{inst})
+	res := s.exchange(c, "udp", instDomain, dns.TypeSRV)
+	c.Assert(res.Answer, HasLen, 1)
+	srv := res.Answer[0].(*dns.SRV)
+	c.Assert(srv.Priority, Equals, uint16(1))
+	c.Assert(srv.Weight, Equals, uint16(1))
+}
+
+func (s *DNSSuite) TestSRVPriority(c *C) {
+	// five instances at two priorities, with one of the lower priority
+	// instances having a weight of zero
+	var insts []*discoverd.Instance
+	for i, meta := range []map[string]string{
+		{discoverd.MetaSRVPriority: "2"},
+		{discoverd.MetaSRVPriority: "1", discoverd.MetaSRVWeight: "0"},
+		{discoverd.MetaSRVPriority: "2"},
+		{discoverd.MetaSRVPriority: "1", discoverd.MetaSRVWeight: "10"},
+		{discoverd.MetaSRVPriority: "1", discoverd.MetaSRVWeight: "10"},
+	} {
+		inst, _ := fakeStaticInstance("tcp", fmt.Sprintf("192.168.0.%d", i+1), 80)
+		inst.Meta = meta
+		insts = append(insts, inst)
+	}
+	s.state.SetService("a", insts)
+
+	for i := 0; i < 10; i++ {
+		// truncated UDP responses only contain the lowest priority
+		// instances, with the zero weight instance last
+		res := s.exchange(c, "udp", "a.discoverd.", dns.TypeSRV)
+		c.Assert(res.Answer, HasLen, maxUDPRecords)
+		for _, rr := range res.Answer {
+			c.Assert(rr.(*dns.SRV).Priority, Equals, uint16(1))
+		}
+		c.Assert(res.Answer[2].(*dns.SRV).Weight, Equals, uint16(0))
+
+		// TCP responses contain all instances in priority order
+		res = s.exchange(c, "tcp", "a.discoverd.", dns.TypeSRV)
+		c.Assert(res.Answer, HasLen, 5)
+		for j, rr := range res.Answer {
+			expected := uint16(1)
+			if j >= 3 {
+				expected = 2
+			}
+			c.Assert(rr.(*dns.SRV).Priority, Equals, expected)
+		}
+	}
+}
+
+func (s *DNSSuite) TestServiceMetaLookup(c *C) {
+	data, err := json.Marshal(map[string]string{
+		"name": strings.Repeat("a", 300),
+		"path": `C:\foo`,
+		"text": `say "hello"`,
+	})
+	c.Assert(err, IsNil)
+
+	for _, net := range []string{"udp", "tcp"} {
+		c.Log(net)
+		s.state.SetServiceMeta("a", nil, 0)
+
+		// non-existent service
+		res := s.exchange(c, net, "_meta.b.discoverd.", dns.TypeTXT)
+		c.Assert(res.Rcode, Equals, dns.RcodeNameError)
+		assertSOA(c, res.Ns)
+
+		// service without metadata
+		res = s.exchange(c, net, "_meta.a.discoverd.", dns.TypeTXT)
+		c.Assert(res.Rcode, Equals, dns.RcodeSuccess)
+		c.Assert(res.Answer, HasLen, 0)
+		assertSOA(c, res.Ns)
+
+		s.state.SetServiceMeta("a", data, 1)
+		for _, q := range []uint16{dns.TypeTXT, dns.TypeANY} {
+			res = s.exchange(c, net, "_meta.a.discoverd.", q)
+			c.Assert(res.Rcode, Equals, dns.RcodeSuccess)
+			c.Assert(res.Answer, HasLen, 1)
+			txt, ok := res.Answer[0].(*dns.TXT)
+			c.Assert(ok, Equals, true)
+			c.Assert(txt.Hdr.Name, Equals, "_meta.a.discoverd.")
+			// long data is split into multiple strings
+			c.Assert(txt.Txt, HasLen, 2)
+			c.Assert(txtUnescape(strings.Join(txt.Txt, "")), Equals, string(data))
+		}
+
+		// other record types have no answers
+		res = s.exchange(c, net, "_meta.a.discoverd.", dns.TypeA)
+		c.Assert(res.Rcode, Equals, dns.RcodeSuccess)
+		c.Assert(res.Answer, HasLen, 0)
+	}
+}
+
+// txtUnescape reverses the escaping the dns package applies to quotes and
+// backslashes when unpacking TXT records.
+func txtUnescape(s string) string {
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(s)
+}
+
 func assertSOA(c *C, rrs []dns.RR) {
 	c.Assert(rrs, HasLen, 1)
 	c.Assert(rrs[0], FitsTypeOf, &dns.SOA{})
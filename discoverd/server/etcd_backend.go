@@ -43,6 +43,14 @@ type etcdBackend struct {
 
 const defaultTTL = 10
 
+// instanceTTL returns the TTL of the instance in seconds, rounded up.
+func instanceTTL(inst *discoverd.Instance) uint64 {
+	if inst.TTL <= 0 {
+		return defaultTTL
+	}
+	return uint64((inst.TTL + time.Second - 1) / time.Second)
+}
+
 type NotFoundError struct {
 	Service  string
 	Instance string
@@ -161,13 +169,14 @@ func (b *etcdBackend) AddInstance(service string, inst *discoverd.Instance) erro
 	}
 	dataString := string(data)
 	key := b.instanceKey(service, inst.ID)
+	ttl := instanceTTL(inst)
 
-	_, err = b.etcd.Update(key, dataString, defaultTTL)
+	_, err = b.etcd.Update(key, dataString, ttl)
 	if e, ok := err.(*etcd.EtcdError); ok && e.ErrorCode == 100 {
 		// This is a workaround for etcd issue #407: https://github.com/coreos/etcd/issues/407
 		// If we just do a Set and don't try to Update first, createdIndex will get incremented
 		// on each heartbeat, breaking leader election.
-		_, err = b.etcd.Set(key, dataString, defaultTTL)
+		_, err = b.etcd.Set(key, dataString, ttl)
 	}
 
 	return err
@@ -181,6 +190,28 @@ func (b *etcdBackend) RemoveInstance(service, id string) error {
 	return err
 }
 
+// StepDownLeader re-registers the instance so that it has the highest index
+// of the service's instances, which causes a new leader to be elected unless
+// the leader policy still prefers the instance.
+func (b *etcdBackend) StepDownLeader(service, id string) error {
+	key := b.instanceKey(service, id)
+	res, err := b.etcd.Get(key, false, false)
+	if isEtcdNotFound(err) {
+		return NotFoundError{Service: service, Instance: id}
+	}
+	if err != nil {
+		return err
+	}
+	inst := &discoverd.Instance{}
+	if err := json.Unmarshal([]byte(res.Node.Value), inst); err != nil {
+		return err
+	}
+	// Set replaces the node rather than updating it, so the instance gets a
+	// new createdIndex (see the etcd issue #407 workaround in AddInstance)
+	_, err = b.etcd.Set(key, res.Node.Value, instanceTTL(inst))
+	return err
+}
+
 func (b *etcdBackend) Close() error {
 	if b.done != nil {
 		close(b.stopSync)
@@ -284,7 +315,9 @@ func (b *etcdBackend) StartSync() error {
 func (b *etcdBackend) instanceEvent(serviceName string, res *etcd.Response) {
 	instanceID := path.Base(res.Node.Key)
 
-	if res.Action == "delete" || res.Action == "expire" {
+	if res.Action == "expire" {
+		b.h.ExpireInstance(serviceName, instanceID)
+	} else if res.Action == "delete" {
 		b.h.RemoveInstance(serviceName, instanceID)
 	} else {
 		inst := &discoverd.Instance{}
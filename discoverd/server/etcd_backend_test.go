@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/coreos/go-etcd/etcd"
 	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
@@ -102,6 +103,22 @@ func (s *EtcdSuite) testBasicSync(c *C, events chan *discoverd.Event) {
 	assertEvent(c, events, "a", discoverd.EventKindDown, &inst2)
 }
 
+func (s *EtcdSuite) TestInstanceExpiry(c *C) {
+	events := make(chan *discoverd.Event, 1)
+	s.state.Subscribe("a", false, discoverd.EventKindUp|discoverd.EventKindDown|discoverd.EventKindExpired, events)
+
+	c.Assert(s.backend.AddService("a"), IsNil)
+	c.Assert(s.backend.StartSync(), IsNil)
+
+	// instance with a short TTL expires if it is not refreshed
+	inst := fakeInstance()
+	inst.TTL = time.Second
+	c.Assert(s.backend.AddInstance("a", inst), IsNil)
+	assertEvent(c, events, "a", discoverd.EventKindUp, inst)
+	assertEvent(c, events, "a", discoverd.EventKindExpired, inst)
+	c.Assert(s.state.Get("a"), HasLen, 0)
+}
+
 func (s *EtcdSuite) TestLeaderElection(c *C) {
 	events := make(chan *discoverd.Event, 2)
 	s.state.Subscribe("a", false, discoverd.EventKindLeader|discoverd.EventKindUp, events)
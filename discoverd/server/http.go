@@ -20,6 +20,7 @@ type Datastore interface {
 	AddInstance(service string, inst *discoverd.Instance) error
 	RemoveInstance(service, id string) error
 	SetServiceMeta(service string, meta *discoverd.ServiceMeta) error
+	StepDownLeader(service string) error
 
 	// Typically implemented by State
 	Get(service string) []*discoverd.Instance
@@ -53,6 +54,26 @@ func (d basicDatastore) SetServiceMeta(service string, meta *discoverd.ServiceMe
 	return d.Backend.SetServiceMeta(service, meta)
 }
 
+var (
+	ErrNoLeader     = errors.New("discoverd: no leader found")
+	ErrLeaderPinned = errors.New("discoverd: the leader is pinned by a manual leader policy")
+	ErrNoNextLeader = errors.New("discoverd: no other instance would be elected leader")
+)
+
+func (d basicDatastore) StepDownLeader(service string) error {
+	leader := d.State.GetLeader(service)
+	if leader == nil {
+		return ErrNoLeader
+	}
+	if p := d.State.GetLeaderPolicy(service); p != nil && p.Type == discoverd.LeaderTypeManual && p.InstanceID == leader.ID {
+		return ErrLeaderPinned
+	}
+	if d.State.GetNextLeader(service) == nil {
+		return ErrNoNextLeader
+	}
+	return d.Backend.StepDownLeader(service, leader.ID)
+}
+
 func NewBasicDatastore(state *State, backend Backend) Datastore {
 	return &basicDatastore{state, backend}
 }
@@ -76,6 +97,7 @@ func NewHTTPHandler(ds Datastore) http.Handler {
 	router.GET("/services/:service/instances", api.GetInstances)
 
 	router.GET("/services/:service/leader", api.GetLeader)
+	router.DELETE("/services/:service/leader", api.StepDownLeader)
 
 	router.GET("/ping", func(http.ResponseWriter, *http.Request, httprouter.Params) {})
 
@@ -128,6 +150,14 @@ func (h *httpAPI) SetServiceMeta(w http.ResponseWriter, r *http.Request, params
 		hh.Error(w, err)
 		return
 	}
+	policy, err := meta.LeaderPolicy()
+	if err == nil && policy != nil {
+		err = policy.Valid()
+	}
+	if err != nil {
+		jsonError(w, hh.ValidationError, err)
+		return
+	}
 
 	if err := h.Store.SetServiceMeta(params.ByName("service"), meta); err != nil {
 		if IsNotFound(err) {
@@ -183,7 +213,7 @@ func (h *httpAPI) RemoveInstance(w http.ResponseWriter, r *http.Request, params
 
 func (h *httpAPI) GetInstances(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
-		h.handleStream(w, params, discoverd.EventKindUp|discoverd.EventKindUpdate|discoverd.EventKindDown)
+		h.handleStream(w, params, discoverd.EventKindUp|discoverd.EventKindUpdate|discoverd.EventKindDown|discoverd.EventKindExpired)
 		return
 	}
 
@@ -209,6 +239,19 @@ func (h *httpAPI) GetLeader(w http.ResponseWriter, r *http.Request, params httpr
 	hh.JSON(w, 200, leader)
 }
 
+func (h *httpAPI) StepDownLeader(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if err := h.Store.StepDownLeader(params.ByName("service")); err != nil {
+		if err == ErrNoLeader || IsNotFound(err) {
+			jsonError(w, hh.ObjectNotFoundError, err)
+		} else if err == ErrLeaderPinned || err == ErrNoNextLeader {
+			jsonError(w, hh.PreconditionFailedError, err)
+		} else {
+			hh.Error(w, err)
+		}
+		return
+	}
+}
+
 func (h *httpAPI) GetServiceStream(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
 		h.handleStream(w, params, discoverd.EventKindAll)
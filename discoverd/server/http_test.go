@@ -86,6 +86,23 @@ func (s *HTTPSuite) TestRegister(c *C) {
 	assertEvent(c, events, "a", discoverd.EventKindDown, inst)
 }
 
+func (s *HTTPSuite) TestRegisterInterval(c *C) {
+	inst := &discoverd.Instance{Addr: "127.0.0.1:80", Proto: "tcp", TTL: 2 * time.Second}
+	for _, interval := range []time.Duration{-time.Second, 2 * time.Second, 3 * time.Second} {
+		_, err := s.client.RegisterInstanceWithInterval("a", inst, interval)
+		c.Assert(err, Equals, discoverd.ErrInvalidInterval)
+	}
+
+	// the interval must also be shorter than the default TTL
+	inst.TTL = 0
+	_, err := s.client.RegisterInstanceWithInterval("a", inst, time.Minute)
+	c.Assert(err, Equals, discoverd.ErrInvalidInterval)
+
+	hb, err := s.client.RegisterInstanceWithInterval("a", inst, time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(hb.Close(), IsNil)
+}
+
 func (s *HTTPSuite) TestWatch(c *C) {
 	events := make(chan *discoverd.Event, 1)
 	stream := s.state.Subscribe("a", false, discoverd.EventKindUp, events)
@@ -219,6 +236,73 @@ func (s *HTTPSuite) TestLeader(c *C) {
 	c.Assert(discoverd.IsNotFound(err), Equals, true)
 }
 
+func (s *HTTPSuite) TestStepDownLeader(c *C) {
+	srv := s.client.Service("a")
+
+	// Step down with no instances 404s
+	err := srv.StepDownLeader()
+	c.Assert(discoverd.IsNotFound(err), Equals, true)
+
+	leaders := make(chan *discoverd.Instance)
+	stream, err := srv.Leaders(leaders)
+	c.Assert(err, IsNil)
+	defer stream.Close()
+
+	inst1 := fakeInstance()
+	hb1, err := s.client.RegisterInstance("a", inst1)
+	c.Assert(err, IsNil)
+	defer hb1.Close()
+	assertLeader(c, leaders, inst1)
+	inst2 := fakeInstance()
+	inst2.Meta["disk"] = "ssd"
+	hb2, err := s.client.RegisterInstance("a", inst2)
+	c.Assert(err, IsNil)
+	defer hb2.Close()
+
+	// Ensure the next oldest instance is elected
+	c.Assert(srv.StepDownLeader(), IsNil)
+	assertLeader(c, leaders, inst2)
+	c.Assert(srv.StepDownLeader(), IsNil)
+	assertLeader(c, leaders, inst1)
+
+	// Ensure a manually pinned leader is elected and cannot step down
+	c.Assert(srv.SetLeaderPolicy(&discoverd.LeaderPolicy{
+		Type:       discoverd.LeaderTypeManual,
+		InstanceID: inst2.ID,
+	}), IsNil)
+	assertLeader(c, leaders, inst2)
+	err = srv.StepDownLeader()
+	c.Assert(err, FitsTypeOf, hh.JSONError{})
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.PreconditionFailedError)
+
+	// Ensure removing the policy keeps other meta fields
+	meta, err := srv.GetMeta()
+	c.Assert(err, IsNil)
+	meta.Data = []byte(`{"foo":"bar","leader_policy":{"type":"manual","instance_id":"` + inst2.ID + `"}}`)
+	c.Assert(srv.SetMeta(meta), IsNil)
+	c.Assert(srv.SetLeaderPolicy(nil), IsNil)
+	assertLeader(c, leaders, inst1)
+	meta, err = srv.GetMeta()
+	c.Assert(err, IsNil)
+	c.Assert(string(meta.Data), Equals, `{"foo":"bar"}`)
+
+	// Ensure stepping down fails if no other instance matches a meta policy
+	c.Assert(srv.SetLeaderPolicy(&discoverd.LeaderPolicy{
+		Type:      discoverd.LeaderTypeMeta,
+		MetaKey:   "disk",
+		MetaValue: "ssd",
+	}), IsNil)
+	assertLeader(c, leaders, inst2)
+	err = srv.StepDownLeader()
+	c.Assert(err, FitsTypeOf, hh.JSONError{})
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.PreconditionFailedError)
+
+	// Ensure invalid policies are rejected
+	err = srv.SetLeaderPolicy(&discoverd.LeaderPolicy{Type: "foo"})
+	c.Assert(err, FitsTypeOf, hh.JSONError{})
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.ValidationError)
+}
+
 func (s *HTTPSuite) TestInstances(c *C) {
 	// Instances with no service 404s
 	_, err := s.client.Service("b").Instances()
@@ -57,32 +57,68 @@ type service struct {
 	meta      []byte
 	metaIndex uint64
 
+	// leaderPolicy is parsed from meta, nil means the oldest instance is
+	// elected
+	leaderPolicy *discoverd.LeaderPolicy
+
 	leaderID string
-	// leaderIndex is >0 when set, zero is unset
-	leaderIndex uint64
 	// notifyLeader is true if there is a new leader and the event has not been
 	// broadcasted to subscribers
 	notifyLeader bool
 }
 
-func (s *service) maybeSetLeader(inst *discoverd.Instance) {
-	if s.leaderIndex == 0 || s.leaderIndex > inst.Index {
-		s.notifyLeader = s.notifyLeader || inst.ID != s.leaderID
-		s.leaderID = inst.ID
-		s.leaderIndex = inst.Index
+// rank returns the rank of the instance under the leader policy, lower ranks
+// are preferred.
+func (s *service) rank(inst *discoverd.Instance) int {
+	p := s.leaderPolicy
+	if p == nil {
+		return 0
+	}
+	switch p.Type {
+	case discoverd.LeaderTypeManual:
+		if inst.ID == p.InstanceID {
+			return 0
+		}
+	case discoverd.LeaderTypeMeta:
+		if v, ok := inst.Meta[p.MetaKey]; ok && (p.MetaValue == "" || v == p.MetaValue) {
+			return 0
+		}
+	default:
+		return 0
 	}
+	return 1
 }
 
-func (s *service) maybePickLeader() {
+// preferLeader returns true if a should be elected leader over b.
+func (s *service) preferLeader(a, b *discoverd.Instance) bool {
+	if rankA, rankB := s.rank(a), s.rank(b); rankA != rankB {
+		return rankA < rankB
+	}
+	if a.Index != b.Index {
+		return a.Index < b.Index
+	}
+	return a.ID < b.ID
+}
+
+func (s *service) pickLeader() {
+	var leader *discoverd.Instance
 	for _, inst := range s.instances {
-		s.maybeSetLeader(inst)
+		if leader == nil || s.preferLeader(inst, leader) {
+			leader = inst
+		}
+	}
+	if leader == nil {
+		s.leaderID = ""
+		return
 	}
+	s.notifyLeader = s.notifyLeader || leader.ID != s.leaderID
+	s.leaderID = leader.ID
 }
 
 func (s *service) AddInstance(inst *discoverd.Instance) *discoverd.Instance {
 	old := s.instances[inst.ID]
 	s.instances[inst.ID] = inst
-	s.maybeSetLeader(inst)
+	s.pickLeader()
 	return old
 }
 
@@ -93,21 +129,29 @@ func (s *service) RemoveInstance(id string) *discoverd.Instance {
 	}
 	delete(s.instances, id)
 	if inst.ID == s.leaderID {
-		s.leaderID = ""
-		s.leaderIndex = 0
-		s.maybePickLeader()
+		s.pickLeader()
 	}
 	return inst
 }
 
 func (s *service) SetInstances(data map[string]*discoverd.Instance) {
-	if _, ok := data[s.leaderID]; !ok {
-		// the current leader is not in the new set
-		s.leaderID = ""
-		s.leaderIndex = 0
-	}
 	s.instances = data
-	s.maybePickLeader()
+	s.pickLeader()
+}
+
+func (s *service) SetMeta(data []byte, index uint64) {
+	s.meta = data
+	s.metaIndex = index
+
+	meta := &discoverd.ServiceMeta{Data: data, Index: index}
+	policy, err := meta.LeaderPolicy()
+	if err != nil || policy != nil && policy.Valid() != nil {
+		// invalid policies are rejected by the HTTP API, so this only
+		// happens if etcd is modified directly
+		policy = nil
+	}
+	s.leaderPolicy = policy
+	s.pickLeader()
 }
 
 func (s *service) BroadcastLeader() *discoverd.Instance {
@@ -125,6 +169,27 @@ func (s *service) Leader() *discoverd.Instance {
 	return s.instances[s.leaderID]
 }
 
+// NextLeader returns the instance which would be elected if the current leader
+// stepped down, or nil if the leader would be elected again.
+func (s *service) NextLeader() *discoverd.Instance {
+	leader := s.Leader()
+	if leader == nil {
+		return nil
+	}
+	var next *discoverd.Instance
+	for _, inst := range s.instances {
+		// a leader which steps down is re-registered as the newest
+		// instance, so it is only replaced by instances ranked as highly
+		if inst.ID == leader.ID || s.rank(inst) > s.rank(leader) {
+			continue
+		}
+		if next == nil || s.preferLeader(inst, next) {
+			next = inst
+		}
+	}
+	return next
+}
+
 func (s *service) Meta() *discoverd.ServiceMeta {
 	if s == nil || s.metaIndex == 0 {
 		return nil
@@ -182,6 +247,16 @@ func (s *State) AddInstance(serviceName string, inst *discoverd.Instance) {
 }
 
 func (s *State) RemoveInstance(serviceName, id string) {
+	s.removeInstance(serviceName, id, discoverd.EventKindDown)
+}
+
+// ExpireInstance removes an instance which stopped sending heartbeats,
+// broadcasting an expired event rather than a down event.
+func (s *State) ExpireInstance(serviceName, id string) {
+	s.removeInstance(serviceName, id, discoverd.EventKindExpired)
+}
+
+func (s *State) removeInstance(serviceName, id string, kind discoverd.EventKind) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
@@ -196,7 +271,7 @@ func (s *State) RemoveInstance(serviceName, id string) {
 
 	s.broadcast(&discoverd.Event{
 		Service:  serviceName,
-		Kind:     discoverd.EventKindDown,
+		Kind:     kind,
 		Instance: inst,
 	})
 	s.broadcastLeader(serviceName)
@@ -226,14 +301,25 @@ func (s *State) SetServiceMeta(serviceName string, data []byte, index uint64) {
 		return
 	}
 
-	service.meta = data
-	service.metaIndex = index
+	service.SetMeta(data, index)
 
 	s.broadcast(&discoverd.Event{
 		Service:     serviceName,
 		Kind:        discoverd.EventKindServiceMeta,
 		ServiceMeta: &discoverd.ServiceMeta{Data: data, Index: index},
 	})
+	s.broadcastLeader(serviceName)
+}
+
+// GetLeaderPolicy returns the leader policy of the service, or nil if the
+// oldest instance is elected.
+func (s *State) GetLeaderPolicy(service string) *discoverd.LeaderPolicy {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.services[service] == nil {
+		return nil
+	}
+	return s.services[service].leaderPolicy
 }
 
 func (s *State) GetServiceMeta(service string) *discoverd.ServiceMeta {
@@ -309,6 +395,14 @@ func (s *State) GetLeader(service string) *discoverd.Instance {
 	return s.services[service].Leader()
 }
 
+// GetNextLeader returns the instance which would be elected if the current
+// leader of the service stepped down, or nil if there is none.
+func (s *State) GetNextLeader(service string) *discoverd.Instance {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.services[service].NextLeader()
+}
+
 func (s *State) Get(service string) []*discoverd.Instance {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
@@ -196,6 +196,29 @@ func (StateSuite) TestDeleteInstance(c *C) {
 	assertEvent(c, events, "a", discoverd.EventKindDown, inst)
 }
 
+func (StateSuite) TestExpireInstance(c *C) {
+	state := NewState()
+	events := make(chan *discoverd.Event, 1)
+	state.Subscribe("a", false, discoverd.EventKindDown|discoverd.EventKindExpired, events)
+
+	// + with instance that doesn't exist
+	inst := fakeInstance()
+	state.AddInstance("a", inst)
+	state.ExpireInstance("a", "b")
+	c.Assert(state.Get("a"), HasLen, 1)
+	assertNoEvent(c, events)
+
+	// + with instance that exists
+	state.ExpireInstance("a", inst.ID)
+	c.Assert(state.Get("a"), HasLen, 0)
+	assertEvent(c, events, "a", discoverd.EventKindExpired, inst)
+
+	// + removed instances are down rather than expired
+	state.AddInstance("a", inst)
+	state.RemoveInstance("a", inst.ID)
+	assertEvent(c, events, "a", discoverd.EventKindDown, inst)
+}
+
 func (StateSuite) TestSetService(c *C) {
 	state := NewState()
 	events := make(chan *discoverd.Event, 3)
@@ -358,6 +381,91 @@ func (StateSuite) TestLeaderElection(c *C) {
 	c.Assert(state.GetLeader("a"), IsNil)
 }
 
+func (StateSuite) TestLeaderPolicy(c *C) {
+	state := NewState()
+	state.AddService("a")
+	events := make(chan *discoverd.Event, 1)
+	state.Subscribe("a", false, discoverd.EventKindLeader, events)
+
+	first := fakeInstance()
+	first.Index = 1
+	second := fakeInstance()
+	second.Index = 2
+	second.Meta = map[string]string{"host": "b"}
+	third := fakeInstance()
+	third.Index = 3
+	third.Meta = map[string]string{"host": "c"}
+	state.SetService("a", []*discoverd.Instance{first, second, third})
+	assertEvent(c, events, "a", discoverd.EventKindLeader, first)
+
+	setPolicy := func(index uint64, policy string) {
+		state.SetServiceMeta("a", []byte(`{"foo":"bar","leader_policy":`+policy+`}`), index)
+	}
+
+	// manual policy elects the pinned instance
+	setPolicy(1, fmt.Sprintf(`{"type":"manual","instance_id":%q}`, third.ID))
+	assertEvent(c, events, "a", discoverd.EventKindLeader, third)
+	c.Assert(state.GetLeader("a"), DeepEquals, third)
+	c.Assert(state.GetLeaderPolicy("a"), DeepEquals, &discoverd.LeaderPolicy{
+		Type:       discoverd.LeaderTypeManual,
+		InstanceID: third.ID,
+	})
+
+	// manual policy falls back to the oldest instance when the pinned
+	// instance is removed, and elects it again when it returns
+	state.RemoveInstance("a", third.ID)
+	assertEvent(c, events, "a", discoverd.EventKindLeader, first)
+	state.AddInstance("a", third)
+	assertEvent(c, events, "a", discoverd.EventKindLeader, third)
+	c.Assert(state.GetNextLeader("a"), IsNil)
+
+	// meta policy elects the oldest instance with a matching key and value
+	setPolicy(2, `{"type":"meta","meta_key":"host","meta_value":"c"}`)
+	assertNoEvent(c, events)
+	c.Assert(state.GetLeader("a"), DeepEquals, third)
+	c.Assert(state.GetNextLeader("a"), IsNil)
+	setPolicy(3, `{"type":"meta","meta_key":"host","meta_value":"b"}`)
+	assertEvent(c, events, "a", discoverd.EventKindLeader, second)
+
+	// meta policy without a value matches any instance with the key
+	setPolicy(4, `{"type":"meta","meta_key":"host"}`)
+	assertNoEvent(c, events)
+	c.Assert(state.GetLeader("a"), DeepEquals, second)
+	c.Assert(state.GetNextLeader("a"), DeepEquals, third)
+
+	// meta policy falls back to the oldest instance if none match
+	setPolicy(5, `{"type":"meta","meta_key":"disk","meta_value":"ssd"}`)
+	assertEvent(c, events, "a", discoverd.EventKindLeader, first)
+
+	// an instance which starts matching is elected
+	updated := *third
+	updated.Meta = map[string]string{"disk": "ssd"}
+	state.AddInstance("a", &updated)
+	assertEvent(c, events, "a", discoverd.EventKindLeader, &updated)
+
+	// removing the policy elects the oldest instance
+	state.SetServiceMeta("a", []byte(`{"foo":"bar"}`), 6)
+	assertEvent(c, events, "a", discoverd.EventKindLeader, first)
+	c.Assert(state.GetLeaderPolicy("a"), IsNil)
+	c.Assert(state.GetNextLeader("a"), DeepEquals, second)
+
+	// a higher index causes the leader to step down
+	reregistered := *first
+	reregistered.Index = 7
+	state.AddInstance("a", &reregistered)
+	assertEvent(c, events, "a", discoverd.EventKindLeader, second)
+
+	// invalid policies and non-object metadata are ignored
+	setPolicy(8, fmt.Sprintf(`{"type":"manual","instance_id":%q}`, third.ID))
+	assertEvent(c, events, "a", discoverd.EventKindLeader, &updated)
+	setPolicy(9, `{"type":"foo"}`)
+	assertEvent(c, events, "a", discoverd.EventKindLeader, second)
+	c.Assert(state.GetLeaderPolicy("a"), IsNil)
+	state.SetServiceMeta("a", []byte("1"), 10)
+	assertNoEvent(c, events)
+	c.Assert(state.GetLeaderPolicy("a"), IsNil)
+}
+
 func (StateSuite) TestGetNilService(c *C) {
 	state := NewState()
 	c.Assert(state.Get("a"), HasLen, 0)
@@ -663,6 +771,10 @@ func (StateSuite) TestEventKindJSON(c *C) {
 	err = json.Unmarshal([]byte(`{"kind":"leader"}`), &kind)
 	c.Assert(err, IsNil)
 	c.Assert(kind.Kind, Equals, discoverd.EventKindLeader)
+
+	err = json.Unmarshal([]byte(`{"kind":"expired"}`), &kind)
+	c.Assert(err, IsNil)
+	c.Assert(kind.Kind, Equals, discoverd.EventKindExpired)
 }
 
 func (StateSuite) TestInstanceHostPort(c *C) {
@@ -25,12 +25,27 @@ type Backend interface {
 	Stop(string) error
 	Signal(string, int) error
 	ResizeTTY(id string, height, width uint16) error
+	Stats(id string) (*host.JobStats, error)
 	Attach(*AttachRequest) error
+	// ReadLog sends the entries in a job's log to ch, oldest first, and
+	// closes it once they have been sent, or once the job exits if follow
+	// is set. It returns early if done is closed.
+	ReadLog(id string, follow bool, ch chan<- *host.LogEntry, done <-chan struct{}) error
+	Exec(*host.ExecReq) (ExecProcess, error)
 	Cleanup() error
 	UnmarshalState(map[string]*host.ActiveJob, map[string][]byte, []byte) error
 	ConfigureNetworking(strategy NetworkStrategy, job string) (*NetworkInfo, error)
 }
 
+// An ExecProcess is a process started in a running job's container by
+// Backend.Exec.  Reading and writing it reads and writes the process's TTY.
+type ExecProcess interface {
+	io.ReadWriteCloser
+	ResizeTTY(height, width uint16) error
+	Signal(int) error
+	Wait() (int, error)
+}
+
 type NetworkInfo struct {
 	BridgeAddr  string
 	Nameservers []string
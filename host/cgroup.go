@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flynn/flynn/host/types"
+)
+
+// cgroupRoot is where the cgroup hierarchies are mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupDir returns the directory of the cgroup which the process belongs to in the
+// hierarchy of the given subsystem (e.g. "pids" or "memory").
+func cgroupDir(pid int, subsystem string) (string, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return parseCgroupDir(f, subsystem)
+}
+
+// parseCgroupDir finds the cgroup directory of a subsystem from the contents of
+// /proc/<pid>/cgroup, which has a "hierarchy-ID:subsystems:path" line for
+// each hierarchy.  The unified hierarchy, which has no subsystems listed, is
+// used if the subsystem isn't mounted separately.
+func parseCgroupDir(r io.Reader, subsystem string) (string, error) {
+	var unified string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" {
+			unified = filepath.Join(cgroupRoot, parts[2])
+			continue
+		}
+		for _, name := range strings.Split(parts[1], ",") {
+			if name == subsystem {
+				return filepath.Join(cgroupRoot, parts[1], parts[2]), nil
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	if unified == "" {
+		return "", fmt.Errorf("cgroup: no %s hierarchy found", subsystem)
+	}
+	return unified, nil
+}
+
+// cgroupControllerEnabled reports whether the kernel has a cgroup controller
+// (e.g. "pids") enabled, checking the unified hierarchy if it is not listed
+// in /proc/cgroups.
+func cgroupControllerEnabled(name string) bool {
+	if f, err := os.Open("/proc/cgroups"); err == nil {
+		enabled := parseProcCgroups(f, name)
+		f.Close()
+		if enabled {
+			return true
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	if err != nil {
+		return false
+	}
+	for _, controller := range strings.Fields(string(data)) {
+		if controller == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProcCgroups reports whether a controller is enabled in the contents of
+// /proc/cgroups, which has a "subsys_name hierarchy num_cgroups enabled" line
+// for each controller the kernel supports.
+func parseProcCgroups(r io.Reader, name string) bool {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 4 && fields[0] == name {
+			return fields[3] == "1"
+		}
+	}
+	return false
+}
+
+// setProcessLimit limits the number of processes in the cgroup of the given process,
+// including ones it has already forked.
+func setProcessLimit(pid, max int) error {
+	dir, err := cgroupDir(pid, "pids")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "pids.max"), []byte(strconv.Itoa(max)), 0644)
+}
+
+// cgroupStats reads the resource usage of the cgroups the process belongs to.
+// The pids controller is only available on Linux 4.3 and later, so the number
+// of processes is left as zero if it is missing.
+func cgroupStats(pid int) (*host.JobStats, error) {
+	var dirs [2]string
+	for i, subsystem := range []string{"memory", "cpuacct"} {
+		dir, err := cgroupDir(pid, subsystem)
+		if err != nil {
+			return nil, err
+		}
+		dirs[i] = dir
+	}
+	pidsDir, _ := cgroupDir(pid, "pids")
+	return readCgroupStats(dirs[0], dirs[1], pidsDir)
+}
+
+// readCgroupStats reads the accounting files in the given memory, cpuacct and
+// pids cgroup directories, which all have different names in the unified
+// hierarchy.  pidsDir may be empty, and the process count is skipped if it is
+// or if it has no pids.current file.
+func readCgroupStats(memoryDir, cpuDir, pidsDir string) (*host.JobStats, error) {
+	stats := &host.JobStats{Time: time.Now()}
+	var err error
+	if stats.MemoryUsage, err = readCgroupInt(memoryDir, "memory.usage_in_bytes", "memory.current"); err != nil {
+		return nil, err
+	}
+	if stats.MemoryLimit, err = readCgroupInt(memoryDir, "memory.limit_in_bytes", "memory.max"); err != nil {
+		return nil, err
+	}
+	if stats.CPUTime, err = readCPUTime(cpuDir); err != nil {
+		return nil, err
+	}
+	if pidsDir == "" {
+		return stats, nil
+	}
+	processes, err := readCgroupInt(pidsDir, "pids.current")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	stats.Processes = int(processes)
+	return stats, nil
+}
+
+// unlimited is the smallest value considered to be "no limit", since the
+// kernel reports unset memory limits as the largest page-aligned int64.
+const unlimited = 1 << 62
+
+// readCgroupInt reads an integer from the first of the named files which
+// exists in dir, returning zero for limits which are unset.
+func readCgroupInt(dir string, names ...string) (int64, error) {
+	var err error
+	for _, name := range names {
+		var data []byte
+		data, err = ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "max" {
+			return 0, nil
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if n >= unlimited {
+			return 0, nil
+		}
+		return n, nil
+	}
+	return 0, err
+}
+
+// readCPUTime reads the total CPU time used by the cgroup in dir.
+func readCPUTime(dir string) (time.Duration, error) {
+	if n, err := readCgroupInt(dir, "cpuacct.usage"); err == nil {
+		return time.Duration(n), nil
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	// the unified hierarchy has no cpuacct.usage, but reports the usage
+	// in microseconds in cpu.stat instead
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "usage_usec" {
+			n, err := strconv.ParseInt(fields[1], 10, 64)
+			return time.Duration(n) * time.Microsecond, err
+		}
+	}
+	return 0, fmt.Errorf("cgroup: no CPU usage found in %s", dir)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+)
+
+func (S) TestParseCgroupDir(c *C) {
+	const cgroups = `11:pids:/machine.slice/machine-lxc\x2dabc.scope
+4:cpu,cpuacct:/machine.slice/machine-lxc\x2dabc.scope
+0::/machine.slice/machine-lxc\x2dabc.scope
+`
+	for _, t := range []struct {
+		subsystem string
+		dir       string
+	}{
+		{"pids", `/sys/fs/cgroup/pids/machine.slice/machine-lxc\x2dabc.scope`},
+		{"cpuacct", `/sys/fs/cgroup/cpu,cpuacct/machine.slice/machine-lxc\x2dabc.scope`},
+		{"memory", `/sys/fs/cgroup/machine.slice/machine-lxc\x2dabc.scope`},
+	} {
+		dir, err := parseCgroupDir(strings.NewReader(cgroups), t.subsystem)
+		c.Assert(err, IsNil)
+		c.Assert(dir, Equals, t.dir)
+	}
+
+	_, err := parseCgroupDir(strings.NewReader("11:pids:/\n"), "memory")
+	c.Assert(err, NotNil)
+}
+
+func (S) TestParseProcCgroups(c *C) {
+	const cgroups = `#subsys_name	hierarchy	num_cgroups	enabled
+cpuset	3	1	1
+memory	5	120	1
+pids	0	1	0
+`
+	c.Assert(parseProcCgroups(strings.NewReader(cgroups), "memory"), Equals, true)
+	c.Assert(parseProcCgroups(strings.NewReader(cgroups), "pids"), Equals, false)
+	c.Assert(parseProcCgroups(strings.NewReader(cgroups), "hugetlb"), Equals, false)
+}
+
+func writeCgroupFiles(c *C, files map[string]string) string {
+	dir := c.MkDir()
+	for name, data := range files {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644), IsNil)
+	}
+	return dir
+}
+
+func (S) TestReadCgroupStats(c *C) {
+	// separate hierarchies, as mounted by cgroup v1
+	memory := writeCgroupFiles(c, map[string]string{
+		"memory.usage_in_bytes": "1048576\n",
+		"memory.limit_in_bytes": "9223372036854771712\n",
+	})
+	cpu := writeCgroupFiles(c, map[string]string{"cpuacct.usage": "1500000000\n"})
+	pids := writeCgroupFiles(c, map[string]string{"pids.current": "3\n"})
+	stats, err := readCgroupStats(memory, cpu, pids)
+	c.Assert(err, IsNil)
+	c.Assert(stats.MemoryUsage, Equals, int64(1048576))
+	c.Assert(stats.MemoryLimit, Equals, int64(0))
+	c.Assert(stats.CPUTime, Equals, 1500*time.Millisecond)
+	c.Assert(stats.Processes, Equals, 3)
+
+	// the unified hierarchy
+	unified := writeCgroupFiles(c, map[string]string{
+		"memory.current": "2097152\n",
+		"memory.max":     "4194304\n",
+		"cpu.stat":       "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n",
+		"pids.current":   "1\n",
+	})
+	stats, err = readCgroupStats(unified, unified, unified)
+	c.Assert(err, IsNil)
+	c.Assert(stats.MemoryUsage, Equals, int64(2097152))
+	c.Assert(stats.MemoryLimit, Equals, int64(4194304))
+	c.Assert(stats.CPUTime, Equals, 2500*time.Millisecond)
+	c.Assert(stats.Processes, Equals, 1)
+
+	// the process count is skipped without the pids controller
+	stats, err = readCgroupStats(memory, cpu, "")
+	c.Assert(err, IsNil)
+	c.Assert(stats.MemoryUsage, Equals, int64(1048576))
+	c.Assert(stats.Processes, Equals, 0)
+	c.Assert(os.Remove(filepath.Join(unified, "pids.current")), IsNil)
+	stats, err = readCgroupStats(unified, unified, unified)
+	c.Assert(err, IsNil)
+	c.Assert(stats.CPUTime, Equals, 2500*time.Millisecond)
+	c.Assert(stats.Processes, Equals, 0)
+
+	// other missing accounting files are an error
+	c.Assert(os.Remove(filepath.Join(unified, "memory.current")), IsNil)
+	_, err = readCgroupStats(unified, unified, unified)
+	c.Assert(err, NotNil)
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"text/tabwriter"
 
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/units"
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
 	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/cluster"
@@ -48,6 +49,19 @@ func printJobDesc(job *host.ActiveJob, out io.Writer) {
 	listRec(w, "EndedAt", job.EndedAt)
 	listRec(w, "ExitStatus", job.ExitStatus)
 	listRec(w, "IP Address", job.InternalIP)
+	r := job.Job.Resources
+	if r.Memory > 0 {
+		listRec(w, "Memory", units.BytesSize(float64(r.Memory)*1024))
+	}
+	if r.CPUShares > 0 {
+		listRec(w, "CPU Shares", r.CPUShares)
+	}
+	if r.CPUQuota > 0 {
+		listRec(w, "CPU Quota", fmt.Sprintf("%.3g CPUs", float64(r.CPUQuota)/1000))
+	}
+	if r.MaxProcesses > 0 {
+		listRec(w, "Max Processes", r.MaxProcesses)
+	}
 	for k, v := range job.Job.Metadata {
 		listRec(w, k, v)
 	}
@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/units"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
+	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/pkg/cluster"
+)
+
+func init() {
+	Register("volume", runVolume, `
+usage: flynn-host volume list <host>
+       flynn-host volume migrate [--provider=<id>] [--delete] <host> <volume> <target-host>
+
+Manage volumes.
+
+Commands:
+	list     list the volumes on <host>, with their size limits, usage and
+	         the jobs they are mounted into
+
+	migrate  copy a volume from <host> to <target-host>
+
+		A snapshot of the volume is taken, sent to the target host and
+		received there as a new volume, whose ID is printed. The snapshot
+		is then destroyed. The original volume is kept unless --delete is
+		given, in which case it must not be mounted by any job.
+
+Options:
+	-p, --provider=<id>  volume provider on the target host [default: default]
+	--delete             destroy the original volume once it has been copied
+
+Examples:
+
+	$ flynn-host volume list host1
+	ID                                PARENT  SIZE     USED     AVAILABLE  JOBS
+	0e4ec4e11bbd4b138aa6a2b6b2a1a4a5          1.074GB  24.58MB  1.049GB    a7b2c1d4e5f64b3c8d9e0f1a2b3c4d5e
+
+	$ flynn-host volume migrate host1 0e4ec4e11bbd4b138aa6a2b6b2a1a4a5 host2
+	Migrated volume 0e4ec4e11bbd4b138aa6a2b6b2a1a4a5 to host2 as 7d8f7b5e43b44e0aa5ab8c0b69f62c94.
+`)
+}
+
+func runVolume(args *docopt.Args, client *cluster.Client) error {
+	if args.Bool["list"] {
+		return runVolumeList(args, client)
+	} else if args.Bool["migrate"] {
+		return runVolumeMigrate(args, client)
+	}
+	return nil
+}
+
+func runVolumeList(args *docopt.Args, client *cluster.Client) error {
+	hostID := args.String["<host>"]
+	hostClient, err := client.DialHost(hostID)
+	if err != nil {
+		return fmt.Errorf("could not connect to host %s: %s", hostID, err)
+	}
+	vols, err := hostClient.ListVolumes()
+	if err != nil {
+		return err
+	}
+	sort.Sort(volumesByID(vols))
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', 0)
+	defer w.Flush()
+	listRec(w, "ID", "PARENT", "SIZE", "USED", "AVAILABLE", "JOBS")
+	for _, vol := range vols {
+		var size string
+		if vol.Size > 0 {
+			size = units.HumanSize(float64(vol.Size))
+		}
+		listRec(w,
+			vol.ID,
+			vol.ParentID,
+			size,
+			units.HumanSize(float64(vol.Used)),
+			units.HumanSize(float64(vol.Available)),
+			mountedJobs(vol.Mounts),
+		)
+	}
+	return nil
+}
+
+// mountedJobs lists the IDs of the jobs in mounts, which are sorted by job ID.
+func mountedJobs(mounts []volume.VolumeMount) string {
+	var jobs []string
+	for i, m := range mounts {
+		if i == 0 || m.JobID != mounts[i-1].JobID {
+			jobs = append(jobs, m.JobID)
+		}
+	}
+	return strings.Join(jobs, ",")
+}
+
+type volumesByID []*volume.Info
+
+func (v volumesByID) Len() int           { return len(v) }
+func (v volumesByID) Less(i, j int) bool { return v[i].ID < v[j].ID }
+func (v volumesByID) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+func runVolumeMigrate(args *docopt.Args, client *cluster.Client) error {
+	hostID := args.String["<host>"]
+	volumeID := args.String["<volume>"]
+	targetID := args.String["<target-host>"]
+
+	src, err := client.DialHost(hostID)
+	if err != nil {
+		return fmt.Errorf("could not connect to host %s: %s", hostID, err)
+	}
+	dst, err := client.DialHost(targetID)
+	if err != nil {
+		return fmt.Errorf("could not connect to host %s: %s", targetID, err)
+	}
+
+	// send a snapshot rather than the volume itself so the copy is
+	// consistent even if the volume is in use
+	snap, err := src.CreateSnapshot(volumeID)
+	if err != nil {
+		return fmt.Errorf("could not snapshot volume %s: %s", volumeID, err)
+	}
+	defer src.DestroyVolume(snap.ID)
+
+	stream, info, err := src.SendVolume(snap.ID)
+	if err != nil {
+		return fmt.Errorf("could not send volume %s: %s", volumeID, err)
+	}
+	defer stream.Close()
+	vol, err := dst.ReceiveVolume(args.String["--provider"], info, stream)
+	if err != nil {
+		return fmt.Errorf("could not receive volume %s on host %s: %s", volumeID, targetID, err)
+	}
+	fmt.Printf("Migrated volume %s to %s as %s.\n", volumeID, targetID, vol.ID)
+
+	if args.Bool["--delete"] {
+		// the snapshot must be destroyed before the volume it was taken of
+		if err := src.DestroyVolume(snap.ID); err != nil {
+			return fmt.Errorf("could not destroy snapshot %s: %s", snap.ID, err)
+		}
+		if err := src.DestroyVolume(volumeID); err != nil {
+			return fmt.Errorf("could not destroy volume %s: %s", volumeID, err)
+		}
+		fmt.Printf("Destroyed volume %s on %s.\n", volumeID, hostID)
+	}
+	return nil
+}
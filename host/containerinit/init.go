@@ -25,11 +25,14 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	sigutil "github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/signal"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/term"
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/libcontainer/netlink"
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/libcontainer/user"
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/kr/pty"
@@ -149,11 +152,49 @@ func (c *Client) Signal(signal int) error {
 	return err
 }
 
+// ExecRequest is a request to run an additional process in the container.
+type ExecRequest struct {
+	ID     string // chosen by the caller to refer to the process in later calls
+	Args   []string
+	Env    map[string]string
+	Height uint16
+	Width  uint16
+}
+
+type ExecSignal struct {
+	ID     string
+	Signal int
+}
+
+// Exec starts a process in the container with a new TTY, returning the master
+// side of the TTY.
+func (c *Client) Exec(req *ExecRequest) (*os.File, error) {
+	var fd fdrpc.FD
+	if err := c.c.Call("ContainerInit.Exec", req, &fd); err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd.FD), "execPtyMaster"), nil
+}
+
+// WaitExec waits for a process started by Exec to exit, returning its exit
+// status.
+func (c *Client) WaitExec(id string) (int, error) {
+	var status int
+	return status, c.c.Call("ContainerInit.WaitExec", id, &status)
+}
+
+func (c *Client) SignalExec(id string, signal int) error {
+	return c.c.Call("ContainerInit.SignalExec", &ExecSignal{ID: id, Signal: signal}, &struct{}{})
+}
+
 func newContainerInit(c *Config) *ContainerInit {
 	return &ContainerInit{
+		config:    c,
 		resume:    make(chan struct{}),
 		streams:   make(map[chan StateChange]struct{}),
 		openStdin: c.OpenStdin,
+		execs:     make(map[string]*execProcess),
+		execPIDs:  make(map[int]*execProcess),
 	}
 }
 
@@ -169,9 +210,23 @@ type ContainerInit struct {
 	stderr     *os.File
 	ptyMaster  *os.File
 	openStdin  bool
+	config     *Config
 
 	streams    map[chan StateChange]struct{}
 	streamsMtx sync.RWMutex
+
+	execs    map[string]*execProcess
+	execPIDs map[int]*execProcess
+	execMtx  sync.Mutex
+}
+
+// execProcess is a process started by Exec, which is reaped by babySit along
+// with any other orphans.
+type execProcess struct {
+	process    *os.Process
+	ptyMaster  *os.File
+	exited     chan struct{}
+	exitStatus int
 }
 
 func (c *ContainerInit) GetState(arg *struct{}, status *State) error {
@@ -236,6 +291,140 @@ func (c *ContainerInit) GetStdin(arg struct{}, f *os.File) error {
 	return nil
 }
 
+func (c *ContainerInit) Exec(req *ExecRequest, fd *fdrpc.FD) error {
+	c.mtx.Lock()
+	state := c.state
+	c.mtx.Unlock()
+	if state != StateRunning {
+		return errors.New("the container is not running")
+	}
+	if len(req.Args) == 0 {
+		return errors.New("no command given")
+	}
+
+	// run the process as the job's user, resolving the command with the
+	// job's environment rather than containerinit's own
+	cred, err := getCredential(c.config)
+	if err != nil {
+		return err
+	}
+	pathEnv, ok := req.Env["PATH"]
+	if !ok {
+		pathEnv = c.config.Env["PATH"]
+	}
+	cmdPath, err := lookPath(req.Args[0], pathEnv, c.config.WorkDir)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(cmdPath, req.Args[1:]...)
+	cmd.Dir = c.config.WorkDir
+	cmd.Env = make([]string, 0, len(c.config.Env)+len(req.Env))
+	for k, v := range c.config.Env {
+		if _, ok := req.Env[k]; !ok {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+	for k, v := range req.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	ptyMaster, ptySlave, err := pty.Open()
+	if err != nil {
+		return err
+	}
+	defer ptySlave.Close()
+	if err := term.SetWinsize(ptyMaster.Fd(), &term.Winsize{Height: req.Height, Width: req.Width}); err != nil {
+		ptyMaster.Close()
+		return err
+	}
+	cmd.Stdin = ptySlave
+	cmd.Stdout = ptySlave
+	cmd.Stderr = ptySlave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Credential: cred}
+
+	// hold the lock until the process is registered so that babySit can't
+	// reap it before then
+	c.execMtx.Lock()
+	defer c.execMtx.Unlock()
+	if _, ok := c.execs[req.ID]; ok {
+		ptyMaster.Close()
+		return fmt.Errorf("exec %s already exists", req.ID)
+	}
+	if err := cmd.Start(); err != nil {
+		ptyMaster.Close()
+		return err
+	}
+	p := &execProcess{process: cmd.Process, ptyMaster: ptyMaster, exited: make(chan struct{})}
+	c.execs[req.ID] = p
+	c.execPIDs[cmd.Process.Pid] = p
+	fd.FD = int(ptyMaster.Fd())
+	return nil
+}
+
+func (c *ContainerInit) WaitExec(id string, status *int) error {
+	c.execMtx.Lock()
+	p, ok := c.execs[id]
+	c.execMtx.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown exec %s", id)
+	}
+	<-p.exited
+
+	c.execMtx.Lock()
+	delete(c.execs, id)
+	c.execMtx.Unlock()
+	p.ptyMaster.Close()
+	*status = p.exitStatus
+	return nil
+}
+
+func (c *ContainerInit) SignalExec(sig *ExecSignal, res *struct{}) error {
+	c.execMtx.Lock()
+	p, ok := c.execs[sig.ID]
+	c.execMtx.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown exec %s", sig.ID)
+	}
+	return p.process.Signal(syscall.Signal(sig.Signal))
+}
+
+// killExecs kills the processes started by Exec which are still running,
+// returning how many there are.
+func (c *ContainerInit) killExecs() int {
+	c.execMtx.Lock()
+	defer c.execMtx.Unlock()
+	for _, p := range c.execPIDs {
+		p.process.Signal(syscall.SIGKILL)
+	}
+	return len(c.execPIDs)
+}
+
+// runningExecs returns the number of processes started by Exec which have not
+// been reaped.
+func (c *ContainerInit) runningExecs() int {
+	c.execMtx.Lock()
+	defer c.execMtx.Unlock()
+	return len(c.execPIDs)
+}
+
+// reaped records the exit of a process which has been waited for by
+// babySit, if it was started by Exec.
+func (c *ContainerInit) reaped(pid int, status syscall.WaitStatus) {
+	c.execMtx.Lock()
+	defer c.execMtx.Unlock()
+	p, ok := c.execPIDs[pid]
+	if !ok {
+		return
+	}
+	delete(c.execPIDs, pid)
+	if status.Signaled() {
+		p.exitStatus = 128 + int(status.Signal())
+	} else {
+		p.exitStatus = status.ExitStatus()
+	}
+	close(p.exited)
+}
+
 func (c *ContainerInit) StreamState(arg struct{}, stream rpcplus.Stream) error {
 	ch := make(chan StateChange)
 	c.streamsMtx.Lock()
@@ -355,9 +544,13 @@ func getCredential(c *Config) (*syscall.Credential, error) {
 	if c.User == "" {
 		return nil, nil
 	}
+	// the user is either a name or, if set from the job's Uid, a numeric ID
 	users, err := user.ParsePasswdFileFilter("/etc/passwd", func(u user.User) bool {
-		return u.Name == c.User
+		return u.Name == c.User || strconv.Itoa(u.Uid) == c.User
 	})
+	if uid, e := strconv.Atoi(c.User); len(users) == 0 && e == nil {
+		return &syscall.Credential{Uid: uint32(uid), Gid: uint32(uid)}, nil
+	}
 	if err != nil || len(users) == 0 {
 		if err == nil {
 			err = errors.New("unknown user")
@@ -400,6 +593,46 @@ func getCmdPath(c *Config) (string, error) {
 	return cmdPath, nil
 }
 
+// lookPath resolves file like exec.LookPath, but searches pathEnv rather than
+// containerinit's own PATH, and resolves relative paths against workDir
+// (falling back to a path in workDir, as getCmdPath does).
+func lookPath(file, pathEnv, workDir string) (string, error) {
+	if strings.Contains(file, "/") {
+		if !path.IsAbs(file) {
+			file = path.Join(workDir, file)
+		}
+		if err := findExecutable(file); err != nil {
+			return "", &exec.Error{Name: file, Err: err}
+		}
+		return file, nil
+	}
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" || !path.IsAbs(dir) {
+			dir = path.Join(workDir, dir)
+		}
+		if p := path.Join(dir, file); findExecutable(p) == nil {
+			return p, nil
+		}
+	}
+	if workDir != "" {
+		if p := path.Join(workDir, file); findExecutable(p) == nil {
+			return p, nil
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+func findExecutable(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if m := info.Mode(); m.IsDir() || m&0111 == 0 {
+		return os.ErrPermission
+	}
+	return nil
+}
+
 func monitor(port host.Port, container *ContainerInit, env map[string]string) (discoverd.Heartbeater, error) {
 	config := port.Service
 	client := discoverd.NewClientWithURL(env["DISCOVERD"])
@@ -488,7 +721,7 @@ func monitor(port host.Port, container *ContainerInit, env map[string]string) (d
 	return reg.Register(), nil
 }
 
-func babySit(process *os.Process) int {
+func babySit(init *ContainerInit, process *os.Process) int {
 	// Forward all signals to the app
 	sigchan := make(chan os.Signal, 1)
 	sigutil.CatchAll(sigchan)
@@ -503,18 +736,36 @@ func babySit(process *os.Process) int {
 
 	// Wait for the app to exit.  Also, as pid 1 it's our job to reap all
 	// orphaned zombies.
-	var wstatus syscall.WaitStatus
+	var wstatus, appStatus syscall.WaitStatus
+	var appExited bool
 	for {
 		pid, err := syscall.Wait4(-1, &wstatus, 0, nil)
-		if err == nil && pid == process.Pid {
+		if err != nil {
+			if err == syscall.ECHILD && appExited {
+				break
+			}
+			continue
+		}
+		if pid == process.Pid {
+			appStatus = wstatus
+			appExited = true
+			// the container is stopping, so kill any exec processes
+			// and keep reaping until they have all been waited for
+			if init.killExecs() == 0 {
+				break
+			}
+			continue
+		}
+		init.reaped(pid, wstatus)
+		if appExited && init.runningExecs() == 0 {
 			break
 		}
 	}
 
-	if wstatus.Signaled() {
+	if appStatus.Signaled() {
 		return 0
 	}
-	return wstatus.ExitStatus()
+	return appStatus.ExitStatus()
 }
 
 // Run as pid 1 and monitor the contained process to return its exit code.
@@ -619,7 +870,7 @@ func containerInitApp(c *Config) error {
 		}
 		hbs = append(hbs, hb)
 	}
-	exitCode := babySit(init.process)
+	exitCode := babySit(init, init.process)
 	init.mtx.Lock()
 	for _, hb := range hbs {
 		hb.Close()
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/julienschmidt/httprouter"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	"github.com/flynn/flynn/host/types"
+)
+
+// execKillTimeout is how long an exec'd process has to exit after being sent
+// SIGHUP when its client disconnects before it is killed.
+const execKillTimeout = 10 * time.Second
+
+// ServeExec runs a process in a running job's container, using the attach
+// protocol to connect the connection to the process's TTY.
+func (h *attachHandler) ServeExec(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var execReq host.ExecReq
+	if err := json.NewDecoder(req.Body).Decode(&execReq); err != nil {
+		http.Error(w, "invalid JSON", 400)
+		return
+	}
+	if len(execReq.Cmd) == 0 {
+		http.Error(w, "missing command", 400)
+		return
+	}
+	w.Header().Set("Connection", "upgrade")
+	w.Header().Set("Upgrade", "flynn-attach/0")
+	w.WriteHeader(http.StatusSwitchingProtocols)
+
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	h.exec(&execReq, conn)
+}
+
+func (h *attachHandler) exec(req *host.ExecReq, conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	g := grohl.NewContext(grohl.Data{"fn": "exec", "job.id": req.JobID})
+	g.Log(grohl.Data{"at": "start"})
+
+	w := bufio.NewWriter(conn)
+	writeError := func(err string) {
+		w.WriteByte(host.AttachError)
+		binary.Write(w, binary.BigEndian, uint32(len(err)))
+		w.WriteString(err)
+		w.Flush()
+	}
+
+	if job := h.state.GetJob(req.JobID); job == nil || job.Status != host.StatusRunning {
+		writeError("job is not running")
+		return
+	}
+	proc, err := h.backend.Exec(req)
+	if err != nil {
+		g.Log(grohl.Data{"at": "exec", "status": "error", "err": err.Error()})
+		writeError(err.Error())
+		return
+	}
+	defer proc.Close()
+	if _, err := conn.Write([]byte{host.AttachSuccess}); err != nil {
+		return
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		// the read loop only returns early if the client disconnects or
+		// breaks the protocol, in which case the process is hung up on,
+		// then killed if it doesn't exit
+		defer func() {
+			select {
+			case <-exited:
+				return
+			default:
+			}
+			g.Log(grohl.Data{"at": "disconnect"})
+			proc.Signal(int(syscall.SIGHUP))
+			select {
+			case <-exited:
+			case <-time.After(execKillTimeout):
+				g.Log(grohl.Data{"at": "kill"})
+				proc.Signal(int(syscall.SIGKILL))
+			}
+		}()
+
+		r := bufio.NewReader(conn)
+		var buf [4]byte
+
+		for {
+			frameType, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			switch frameType {
+			case host.AttachData:
+				stream, err := r.ReadByte()
+				if err != nil || stream != 0 {
+					return
+				}
+				if _, err := io.ReadFull(r, buf[:]); err != nil {
+					return
+				}
+				// there is no way to close one direction of a TTY, so
+				// zero length frames (which close stdin) are ignored
+				length := int64(binary.BigEndian.Uint32(buf[:]))
+				if _, err := io.CopyN(proc, r, length); err != nil {
+					return
+				}
+			case host.AttachSignal:
+				if _, err := io.ReadFull(r, buf[:]); err != nil {
+					return
+				}
+				signal := int(binary.BigEndian.Uint32(buf[:]))
+				g.Log(grohl.Data{"at": "signal", "signal": signal})
+				if err := proc.Signal(signal); err != nil {
+					g.Log(grohl.Data{"at": "signal", "status": "error", "err": err})
+					return
+				}
+			case host.AttachResize:
+				if _, err := io.ReadFull(r, buf[:]); err != nil {
+					return
+				}
+				height := binary.BigEndian.Uint16(buf[:])
+				width := binary.BigEndian.Uint16(buf[2:])
+				g.Log(grohl.Data{"at": "tty_resize", "height": height, "width": width})
+				if err := proc.ResizeTTY(height, width); err != nil {
+					g.Log(grohl.Data{"at": "tty_resize", "status": "error", "err": err})
+					return
+				}
+			default:
+				return
+			}
+		}
+	}()
+
+	// reading the TTY fails once the process (and anything else holding the
+	// TTY open) has exited
+	writeMtx := &sync.Mutex{}
+	io.Copy(newFrameWriter(1, w, writeMtx), proc)
+
+	status, err := proc.Wait()
+	close(exited)
+	writeMtx.Lock()
+	defer writeMtx.Unlock()
+	if err != nil {
+		g.Log(grohl.Data{"at": "wait", "status": "error", "err": err.Error()})
+		writeError(err.Error())
+		return
+	}
+	w.WriteByte(host.AttachExit)
+	binary.Write(w, binary.BigEndian, uint32(status))
+	w.Flush()
+	g.Log(grohl.Data{"at": "finish", "exit_status": status})
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"math"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/flynn/flynn/host/sampi"
 	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/host/volume"
+	dirVolume "github.com/flynn/flynn/host/volume/directory"
 	"github.com/flynn/flynn/host/volume/manager"
 	zfsVolume "github.com/flynn/flynn/host/volume/zfs"
 	"github.com/flynn/flynn/pkg/attempt"
@@ -47,9 +49,12 @@ options:
   --force                kill all containers booted by flynn-host before starting
   --volpath=PATH         directory to create volumes in [default: /var/lib/flynn/host-volumes]
   --backend=BACKEND      runner backend [default: libvirt-lxc]
+  --volume-provider=KIND default volume provider kind, zfs or directory [default: zfs]
   --meta=<KEY=VAL>...    key=value pair to add as metadata
   --bind=IP              bind containers to IP
   --flynn-init=PATH      path to flynn-init binary [default: /usr/local/bin/flynn-init]
+  --reserved-memory=MB   memory in MiB reserved for the host and not allocated to jobs [default: 0]
+  --reserved-cpu=MCPU    CPU in thousandths of a CPU reserved for the host [default: 0]
 	`)
 }
 
@@ -72,6 +77,7 @@ Commands:
   log                        Get the logs of a job
   ps                         List jobs
   stop                       Stop running jobs
+  volume                     Manage volumes
   upload-debug-info          Upload debug information to an anonymous gist
 
 See 'flynn-host help <command>' for more information on a specific command.
@@ -130,8 +136,17 @@ func runDaemon(args *docopt.Args) {
 	force := args.Bool["--force"]
 	volPath := args.String["--volpath"]
 	backendName := args.String["--backend"]
+	volumeProvider := args.String["--volume-provider"]
 	flynnInit := args.String["--flynn-init"]
 	metadata := args.All["--meta"].([]string)
+	reservedMemory, err := strconv.Atoi(args.String["--reserved-memory"])
+	if err != nil {
+		shutdown.Fatal("invalid --reserved-memory: ", err)
+	}
+	reservedCPU, err := strconv.Atoi(args.String["--reserved-cpu"])
+	if err != nil {
+		shutdown.Fatal("invalid --reserved-cpu: ", err)
+	}
 
 	grohl.AddContext("app", "host")
 	grohl.Log(grohl.Data{"at": "start"})
@@ -153,17 +168,25 @@ func runDaemon(args *docopt.Args) {
 
 	state := NewState(hostID, stateFile)
 	var backend Backend
-	var err error
 
 	// create volume manager
-	vman, err := volumemanager.New(func() (volume.Provider, error) {
-		return zfsVolume.NewProvider(&zfsVolume.ProviderConfig{
-			DatasetName: "flynn-default",
-			Make: &zfsVolume.MakeDev{
-				BackingFilename: "/var/lib/flynn/volumes/zfs/vdev/flynn-default-zpool.vdev",
-				Size:            int64(math.Pow(2, float64(30))),
-			},
-		})
+	vman, err := volumemanager.New(state.stateDB, func() (volume.Provider, error) {
+		switch volumeProvider {
+		case "zfs":
+			return zfsVolume.NewProvider(&zfsVolume.ProviderConfig{
+				DatasetName: "flynn-default",
+				Make: &zfsVolume.MakeDev{
+					BackingFilename: "/var/lib/flynn/volumes/zfs/vdev/flynn-default-zpool.vdev",
+					Size:            int64(math.Pow(2, float64(30))),
+				},
+			})
+		case "directory":
+			return dirVolume.NewProvider(&dirVolume.ProviderConfig{
+				RootPath: "/var/lib/flynn/volumes/directory",
+			})
+		default:
+			return nil, fmt.Errorf("unknown volume provider kind %q", volumeProvider)
+		}
 	})
 	if err != nil {
 		shutdown.Fatal(err)
@@ -298,6 +321,11 @@ func runDaemon(args *docopt.Args) {
 		kv := strings.SplitN(s, "=", 2)
 		h.Metadata[kv[0]] = kv[1]
 	}
+	h.Resources, err = hostResources(reservedMemory*1024, reservedCPU)
+	if err != nil {
+		// the scheduler treats hosts without resources as unlimited
+		g.Log(grohl.Data{"at": "host_resources", "status": "error", "err": err.Error()})
+	}
 
 	for {
 		newLeader := cluster.NewLeaderSignal()
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/julienschmidt/httprouter"
 	"github.com/flynn/flynn/host/types"
@@ -47,6 +48,74 @@ func (h *Host) streamEvents(id string, w http.ResponseWriter) error {
 	return nil
 }
 
+// streamStats sends samples of a running job's resource usage every interval
+// until the job stops or the client goes away.
+func (h *Host) streamStats(id string, interval time.Duration, w http.ResponseWriter) {
+	ch := make(chan *host.JobStats)
+	stream := sse.NewStream(w, ch, nil)
+	stream.Serve()
+	for {
+		if job := h.state.GetJob(id); job == nil || job.Status != host.StatusRunning {
+			stream.Close()
+			return
+		}
+		stats, err := h.backend.Stats(id)
+		if err != nil {
+			stream.CloseWithError(err)
+			return
+		}
+		select {
+		case ch <- stats:
+		case <-stream.Done:
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-stream.Done:
+			return
+		}
+	}
+}
+
+// streamLog sends the entries in a job's log which were written at or after
+// since, following new entries until the job exits if follow is set.
+func (h *Host) streamLog(id string, since time.Time, follow bool, w http.ResponseWriter) {
+	entries := make(chan *host.LogEntry)
+	done := make(chan struct{})
+	defer close(done)
+	errc := make(chan error, 1)
+	go func() { errc <- h.backend.ReadLog(id, follow, entries, done) }()
+
+	ch := make(chan *host.LogEntry)
+	stream := sse.NewStream(w, ch, nil)
+	stream.Serve()
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				stream.Close()
+				return
+			}
+			if entry.Timestamp.Before(since) {
+				continue
+			}
+			select {
+			case ch <- entry:
+			case <-stream.Done:
+				return
+			}
+		case err := <-errc:
+			if err != nil {
+				stream.CloseWithError(err)
+				return
+			}
+			errc = nil
+		case <-stream.Done:
+			return
+		}
+	}
+}
+
 type jobAPI struct {
 	host *Host
 }
@@ -76,6 +145,73 @@ func (h *jobAPI) GetJob(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	httphelper.JSON(w, 200, job)
 }
 
+func (h *jobAPI) GetJobStats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	job := h.host.state.GetJob(id)
+	if job == nil {
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.ObjectNotFoundError,
+			Message: "job not found",
+		})
+		return
+	}
+	if job.Status != host.StatusRunning {
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.PreconditionFailedError,
+			Message: "job is not running",
+		})
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		interval := time.Second
+		if s := r.URL.Query().Get("interval"); s != "" {
+			var err error
+			if interval, err = time.ParseDuration(s); err != nil || interval <= 0 {
+				httphelper.Error(w, httphelper.JSONError{
+					Code:    httphelper.ValidationError,
+					Message: "interval must be a positive duration",
+				})
+				return
+			}
+		}
+		h.host.streamStats(id, interval, w)
+		return
+	}
+	stats, err := h.host.backend.Stats(id)
+	if err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, stats)
+}
+
+func (h *jobAPI) GetJobLog(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	if job := h.host.state.GetJob(id); job == nil {
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.ObjectNotFoundError,
+			Message: "job not found",
+		})
+		return
+	}
+
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			httphelper.Error(w, httphelper.JSONError{
+				Code:    httphelper.ValidationError,
+				Message: "since must be an RFC 3339 timestamp",
+			})
+			return
+		}
+	}
+	h.host.streamLog(id, since, r.URL.Query().Get("follow") == "true", w)
+}
+
 func (h *jobAPI) StopJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id := ps.ByName("id")
 	if err := h.host.StopJob(id); err != nil {
@@ -127,6 +263,8 @@ func (h *jobAPI) RegisterRoutes(r *httprouter.Router) error {
 	r.GET("/host/jobs", h.ListJobs)
 	r.GET("/host/jobs/:id", h.GetJob)
 	r.DELETE("/host/jobs/:id", h.StopJob)
+	r.GET("/host/jobs/:id/stats", h.GetJobStats)
+	r.GET("/host/jobs/:id/log", h.GetJobLog)
 	r.POST("/host/pull-images", h.PullImages)
 	return nil
 }
@@ -140,6 +278,7 @@ func serveHTTP(host *Host, attach *attachHandler, vman *volumemanager.Manager) (
 	r := httprouter.New()
 
 	r.POST("/attach", attach.ServeHTTP)
+	r.POST("/exec", attach.ServeExec)
 
 	jobAPI := &jobAPI{host}
 	jobAPI.RegisterRoutes(r)
@@ -41,6 +41,10 @@ const (
 	libvirtNetName = "flynn"
 	bridgeName     = "flynnbr0"
 	imageRoot      = "/var/lib/docker"
+
+	// cpuPeriod is the CFS period in microseconds which CPU quotas are
+	// enforced over.
+	cpuPeriod = 100000
 )
 
 func NewLibvirtLXCBackend(state *State, vman *volumemanager.Manager, volPath, logPath, initPath string) (Backend, error) {
@@ -54,20 +58,30 @@ func NewLibvirtLXCBackend(state *State, vman *volumemanager.Manager, volPath, lo
 		return nil, err
 	}
 
+	// process limits are set with the pids cgroup controller, which was
+	// added in Linux 4.3
+	processLimits := cgroupControllerEnabled("pids")
+	if !processLimits {
+		grohl.Log(grohl.Data{"backend": "libvirt-lxc", "at": "no_pids_cgroup", "msg": "jobs with max_processes set will be rejected"})
+	}
+
 	return &LibvirtLXCBackend{
-		LogPath:    logPath,
-		VolPath:    volPath,
-		InitPath:   initPath,
-		libvirt:    libvirtc,
-		state:      state,
-		vman:       vman,
-		pinkerton:  pinkertonCtx,
-		logs:       make(map[string]*logbuf.Log),
-		containers: make(map[string]*libvirtContainer),
-		resolvConf: "/etc/resolv.conf",
+		LogPath:       logPath,
+		VolPath:       volPath,
+		InitPath:      initPath,
+		libvirt:       libvirtc,
+		state:         state,
+		vman:          vman,
+		pinkerton:     pinkertonCtx,
+		processLimits: processLimits,
+		logs:          make(map[string]*logbuf.Log),
+		containers:    make(map[string]*libvirtContainer),
+		resolvConf:    "/etc/resolv.conf",
 	}, nil
 }
 
+var errNoProcessLimits = errors.New("host: max_processes is not supported as the pids cgroup controller is not available (it requires Linux 4.3 or later)")
+
 type LibvirtLXCBackend struct {
 	LogPath   string
 	InitPath  string
@@ -77,6 +91,10 @@ type LibvirtLXCBackend struct {
 	vman      *volumemanager.Manager
 	pinkerton *pinkerton.Context
 
+	// processLimits is whether the kernel supports limiting the number of
+	// processes in a job
+	processLimits bool
+
 	ifaceMTU   int
 	bridgeAddr net.IP
 	bridgeNet  *net.IPNet
@@ -330,6 +348,11 @@ func (l *LibvirtLXCBackend) Run(job *host.Job) (err error) {
 	g := grohl.NewContext(grohl.Data{"backend": "libvirt-lxc", "fn": "run", "job.id": job.ID})
 	g.Log(grohl.Data{"at": "start", "job.artifact.uri": job.Artifact.URI, "job.cmd": job.Config.Cmd})
 
+	if job.Resources.MaxProcesses > 0 && !l.processLimits {
+		g.Log(grohl.Data{"at": "check_resources", "status": "error", "err": errNoProcessLimits})
+		return errNoProcessLimits
+	}
+
 	container := &libvirtContainer{
 		l:    l,
 		job:  job,
@@ -516,7 +539,7 @@ func (l *LibvirtLXCBackend) Run(job *host.Job) (err error) {
 	domain := &lt.Domain{
 		Type:   "lxc",
 		Name:   job.ID,
-		Memory: lt.UnitInt{Value: 1, Unit: "GiB"},
+		Memory: lt.UnitInt{Value: job.Resources.MemoryLimit(), Unit: "KiB"},
 		VCPU:   1,
 		OS: lt.OS{
 			Type: lt.OSType{Value: "exe"},
@@ -534,6 +557,14 @@ func (l *LibvirtLXCBackend) Run(job *host.Job) (err error) {
 		OnCrash:    "preserve",
 	}
 
+	if r := job.Resources; r.CPUShares > 0 || r.CPUQuota > 0 {
+		domain.CPUTune = &lt.CPUTune{Shares: r.CPUShares}
+		if r.CPUQuota > 0 {
+			domain.CPUTune.Period = cpuPeriod
+			domain.CPUTune.Quota = r.CPUQuota * cpuPeriod / 1000
+		}
+	}
+
 	if !job.Config.HostNetwork {
 		domain.Devices.Interfaces = []lt.Interface{{
 			Type:   "network",
@@ -572,6 +603,19 @@ func (l *LibvirtLXCBackend) Run(job *host.Job) (err error) {
 		return err
 	}
 
+	// libvirt has no process limit setting, so write it to the pids cgroup
+	// directly.  containerinit waits for the host to connect before starting
+	// the job's command, so this happens before the job can fork.  The job
+	// is not left running without the limit it asked for if setting it
+	// fails.
+	if max := job.Resources.MaxProcesses; max > 0 {
+		if err := setProcessLimit(domain.ID, max); err != nil {
+			g.Log(grohl.Data{"at": "set_process_limit", "status": "error", "err": err})
+			vd.Destroy()
+			return err
+		}
+	}
+
 	go container.watch(nil)
 
 	g.Log(grohl.Data{"at": "finish"})
@@ -724,6 +768,9 @@ func (c *libvirtContainer) cleanup() error {
 		if err := syscall.Unmount(filepath.Join(c.RootPath, v.Target), 0); err != nil {
 			g.Log(grohl.Data{"at": "unmount", "target": v.Target, "volumeID": v.VolumeID, "status": "error", "err": err})
 		}
+		if vol := c.l.vman.GetVolume(v.VolumeID); vol != nil {
+			vol.Unmount(c.job.ID, v.Target)
+		}
 	}
 	if !c.job.Config.HostNetwork && c.l.bridgeNet != nil {
 		ipallocator.ReleaseIP(c.l.bridgeNet, c.IP)
@@ -763,6 +810,28 @@ func (l *LibvirtLXCBackend) Stop(id string) error {
 	return c.Stop()
 }
 
+// Stats reads the resource usage of a running container from the cgroups
+// of its init process, whose PID is the ID libvirt gives LXC domains.
+func (l *LibvirtLXCBackend) Stats(id string) (*host.JobStats, error) {
+	if _, err := l.getContainer(id); err != nil {
+		return nil, err
+	}
+	d, err := l.libvirt.LookupDomainByName(id)
+	if err != nil {
+		return nil, err
+	}
+	pid, err := d.GetID()
+	if err != nil {
+		return nil, err
+	}
+	stats, err := cgroupStats(int(pid))
+	if err != nil {
+		return nil, err
+	}
+	stats.JobID = id
+	return stats, nil
+}
+
 func (l *LibvirtLXCBackend) getContainer(id string) (*libvirtContainer, error) {
 	l.containersMtx.RLock()
 	defer l.containersMtx.RUnlock()
@@ -881,6 +950,75 @@ func (l *LibvirtLXCBackend) Attach(req *AttachRequest) (err error) {
 	return io.EOF
 }
 
+func (l *LibvirtLXCBackend) ReadLog(id string, follow bool, ch chan<- *host.LogEntry, done <-chan struct{}) error {
+	data := make(chan logbuf.Data)
+	stop := make(chan struct{})
+	defer close(stop)
+	errc := make(chan error, 1)
+	go func() { errc <- l.openLog(id).Read(-1, follow, data, stop) }()
+
+	for {
+		select {
+		case d, ok := <-data:
+			if !ok {
+				close(ch)
+				return nil
+			}
+			select {
+			case ch <- &host.LogEntry{Stream: d.Stream, Timestamp: d.Timestamp.Time, Data: d.Message}:
+			case <-done:
+				return nil
+			}
+		case err := <-errc:
+			// Read closes data before returning nil, so only errors
+			// need handling here
+			if err != nil {
+				return err
+			}
+			errc = nil
+		case <-done:
+			return nil
+		}
+	}
+}
+
+func (l *LibvirtLXCBackend) Exec(req *host.ExecReq) (ExecProcess, error) {
+	container, err := l.getContainer(req.JobID)
+	if err != nil {
+		return nil, err
+	}
+	id := random.UUID()
+	pty, err := container.Exec(&containerinit.ExecRequest{
+		ID:     id,
+		Args:   req.Cmd,
+		Env:    req.Env,
+		Height: req.Height,
+		Width:  req.Width,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &libvirtExec{File: pty, id: id, client: container.Client}, nil
+}
+
+type libvirtExec struct {
+	*os.File
+	id     string
+	client *containerinit.Client
+}
+
+func (e *libvirtExec) ResizeTTY(height, width uint16) error {
+	return term.SetWinsize(e.Fd(), &term.Winsize{Height: height, Width: width})
+}
+
+func (e *libvirtExec) Signal(sig int) error {
+	return e.client.SignalExec(e.id, sig)
+}
+
+func (e *libvirtExec) Wait() (int, error) {
+	return e.client.WaitExec(e.id)
+}
+
 func (l *LibvirtLXCBackend) Cleanup() error {
 	g := grohl.NewContext(grohl.Data{"backend": "libvirt-lxc", "fn": "Cleanup"})
 	l.containersMtx.Lock()
@@ -952,6 +1090,12 @@ func (l *LibvirtLXCBackend) UnmarshalState(jobs map[string]*host.ActiveJob, jobB
 			container.cleanup()
 			continue
 		}
+		// volumes don't persist their mounts, so remind them of the restored job's
+		for _, v := range j.Job.Config.Volumes {
+			if vol := l.vman.GetVolume(v.VolumeID); vol != nil {
+				vol.Mount(j.Job.ID, v.Target)
+			}
+		}
 		l.containers[j.Job.ID] = container
 	}
 	return nil
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/flynn/flynn/host/types"
+)
+
+// hostResources returns the capacity of the host, less the given memory (in
+// KiB) and CPU (in thousandths of a CPU) reserved for the host itself.
+func hostResources(reservedMemory, reservedCPU int) (*host.HostResources, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	memory, err := parseMemTotal(f)
+	if err != nil {
+		return nil, err
+	}
+	cpu := runtime.NumCPU() * 1000
+	return &host.HostResources{
+		Memory:            memory,
+		AllocatableMemory: nonNegative(memory - reservedMemory),
+		CPU:               cpu,
+		AllocatableCPU:    nonNegative(cpu - reservedCPU),
+	}, nil
+}
+
+// parseMemTotal returns the total memory in KiB from the contents of
+// /proc/meminfo, which has a line like "MemTotal:  16384256 kB".
+func parseMemTotal(r io.Reader) (int, error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		return strconv.Atoi(fields[1])
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("meminfo: MemTotal not found")
+}
+
+func nonNegative(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
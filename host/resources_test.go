@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+)
+
+func (S) TestParseMemTotal(c *C) {
+	const meminfo = `MemTotal:       16384256 kB
+MemFree:         8192128 kB
+MemAvailable:   12288192 kB
+`
+	memory, err := parseMemTotal(strings.NewReader(meminfo))
+	c.Assert(err, IsNil)
+	c.Assert(memory, Equals, 16384256)
+
+	_, err = parseMemTotal(strings.NewReader("MemFree: 8192128 kB\n"))
+	c.Assert(err, NotNil)
+}
@@ -101,7 +101,14 @@ func (s *State) AddJobs(hostID string, jobs []*host.Job) error {
 	l.Debug("adding new jobs", "at", "ok")
 	newJobs := make([]*host.Job, len(h.Jobs), len(h.Jobs)+len(jobs))
 	copy(newJobs, h.Jobs)
-	newJobs = append(newJobs, jobs...)
+	for _, job := range jobs {
+		// refuse to overcommit hosts which report their capacity
+		if alloc := (host.Host{Jobs: newJobs, Resources: h.Resources}); !alloc.Fits(job.Resources) {
+			l.Error("insufficient host capacity", "job.id", job.ID)
+			return fmt.Errorf("sampi: Host %s has insufficient capacity for job %s", hostID, job.ID)
+		}
+		newJobs = append(newJobs, job)
+	}
 	h.Jobs = newJobs
 
 	s.next[hostID] = h
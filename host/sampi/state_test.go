@@ -1,6 +1,7 @@
 package sampi
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/flynn/flynn/host/types"
@@ -45,3 +46,76 @@ func TestStateRace(t *testing.T) {
 		t.Log("Got '2'")
 	}
 }
+
+func TestStateAddJobsCapacity(t *testing.T) {
+	state := NewState()
+	state.Begin()
+	state.AddHost(&host.Host{ID: "foo", Resources: &host.HostResources{
+		AllocatableMemory: 2*host.DefaultJobMemory + 1024,
+		AllocatableCPU:    1000,
+	}}, nil)
+	state.Commit()
+
+	addJob := func(id string, r host.JobResources) error {
+		state.Begin()
+		if err := state.AddJobs("foo", []*host.Job{{ID: id, Resources: r}}); err != nil {
+			state.Rollback()
+			return err
+		}
+		state.Commit()
+		return nil
+	}
+
+	if err := addJob("a", host.JobResources{Memory: host.DefaultJobMemory, CPUQuota: 500}); err != nil {
+		t.Fatal("Expected job 'a' to fit, got error:", err)
+	}
+	if err := addJob("b", host.JobResources{Memory: host.DefaultJobMemory}); err != nil {
+		t.Fatal("Expected job 'b' to fit, got error:", err)
+	}
+	if err := addJob("c", host.JobResources{Memory: 2048}); err == nil {
+		t.Error("Expected job 'c' to exceed the allocatable memory")
+	}
+	// jobs which don't request memory are not charged for it
+	if err := addJob("d", host.JobResources{}); err != nil {
+		t.Error("Expected job 'd' to fit, got error:", err)
+	}
+	if err := addJob("e", host.JobResources{Memory: 1024, CPUQuota: 600}); err == nil {
+		t.Error("Expected job 'e' to exceed the allocatable CPU")
+	}
+	if err := addJob("f", host.JobResources{Memory: 1024, CPUQuota: 500}); err != nil {
+		t.Error("Expected job 'f' to fit, got error:", err)
+	}
+	if n := len(state.Get()["foo"].Jobs); n != 4 {
+		t.Errorf("Expected 4 jobs on 'foo', got %d", n)
+	}
+}
+
+func TestStateAddJobsWithoutLimits(t *testing.T) {
+	// a host the size of the test cluster VMs
+	state := NewState()
+	state.Begin()
+	state.AddHost(&host.Host{ID: "foo", Resources: &host.HostResources{
+		AllocatableMemory: 2048 * 1024,
+		AllocatableCPU:    1000,
+	}}, nil)
+	state.Commit()
+
+	// more jobs without a memory limit than would fit at the default limit
+	for i := 0; i < 10; i++ {
+		state.Begin()
+		if err := state.AddJobs("foo", []*host.Job{{ID: fmt.Sprintf("job%d", i)}}); err != nil {
+			t.Fatalf("Expected job %d without a memory limit to fit, got error: %s", i, err)
+		}
+		state.Commit()
+	}
+	if n := len(state.Get()["foo"].Jobs); n != 10 {
+		t.Errorf("Expected 10 jobs on 'foo', got %d", n)
+	}
+
+	// jobs which request memory are still limited by the capacity
+	state.Begin()
+	if err := state.AddJobs("foo", []*host.Job{{ID: "big", Resources: host.JobResources{Memory: 4096 * 1024}}}); err == nil {
+		t.Error("Expected job 'big' to exceed the allocatable memory")
+	}
+	state.Rollback()
+}
@@ -32,7 +32,12 @@ func (MockBackend) Run(*host.Job) error                             { return nil
 func (MockBackend) Stop(string) error                               { return nil }
 func (MockBackend) Signal(string, int) error                        { return nil }
 func (MockBackend) ResizeTTY(id string, height, width uint16) error { return nil }
+func (MockBackend) Stats(string) (*host.JobStats, error)            { return nil, nil }
 func (MockBackend) Attach(*AttachRequest) error                     { return nil }
+func (MockBackend) ReadLog(string, bool, chan<- *host.LogEntry, <-chan struct{}) error {
+	return nil
+}
+func (MockBackend) Exec(*host.ExecReq) (ExecProcess, error)         { return nil, nil }
 func (MockBackend) Cleanup() error                                  { return nil }
 func (MockBackend) UnmarshalState(map[string]*host.ActiveJob, map[string][]byte, []byte) error {
 	return nil
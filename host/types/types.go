@@ -56,8 +56,32 @@ func (j *Job) Dup() *Job {
 	return &job
 }
 
+// DefaultJobMemory is the memory limit in KiB of jobs which don't set one.
+const DefaultJobMemory = 1024 * 1024
+
 type JobResources struct {
-	Memory int `json:"memory,omitempty"` // in KiB
+	Memory int `json:"memory,omitempty"` // in KiB, DefaultJobMemory if unset
+
+	// CPUShares is the job's share of CPU time relative to other jobs on
+	// the host when the CPUs are contended.  Jobs get 1024 by default.
+	CPUShares int `json:"cpu_shares,omitempty"`
+
+	// CPUQuota limits the job to this many thousandths of a CPU even when
+	// the CPUs are idle, e.g. 500 for half of one CPU or 2000 for two.
+	CPUQuota int `json:"cpu_quota,omitempty"`
+
+	// MaxProcesses limits the number of processes (and threads) which may
+	// run in the job at once.
+	MaxProcesses int `json:"max_processes,omitempty"`
+}
+
+// MemoryLimit returns the memory limit of the job in KiB, which is Memory or
+// DefaultJobMemory if it is unset.
+func (r JobResources) MemoryLimit() int {
+	if r.Memory > 0 {
+		return r.Memory
+	}
+	return DefaultJobMemory
 }
 
 type ContainerConfig struct {
@@ -177,6 +201,56 @@ type Host struct {
 
 	Jobs     []*Job            `json:"jobs,omitempty"`
 	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Resources is the capacity of the host, it is nil if the host does
+	// not report it.
+	Resources *HostResources `json:"resources,omitempty"`
+}
+
+// HostResources is the memory and CPU capacity of a host.
+type HostResources struct {
+	// Memory is the total memory of the host in KiB.
+	Memory int `json:"memory,omitempty"`
+
+	// AllocatableMemory is the memory in KiB which jobs may request, that is
+	// the total less the memory reserved for the host itself.
+	AllocatableMemory int `json:"allocatable_memory,omitempty"`
+
+	// CPU is the total CPU of the host in thousandths of a CPU.
+	CPU int `json:"cpu,omitempty"`
+
+	// AllocatableCPU is the CPU in thousandths of a CPU which jobs may
+	// request, that is the total less the CPU reserved for the host itself.
+	AllocatableCPU int `json:"allocatable_cpu,omitempty"`
+}
+
+// Allocated returns the resources explicitly requested by the jobs on the
+// host via Memory and CPUQuota. Jobs which don't set them are not charged, so
+// hosts are never considered full of jobs which don't request any resources.
+func (h *Host) Allocated() JobResources {
+	var r JobResources
+	for _, job := range h.Jobs {
+		r.Memory += job.Resources.Memory
+		r.CPUQuota += job.Resources.CPUQuota
+	}
+	return r
+}
+
+// Fits reports whether the host has enough unallocated capacity to run a job
+// requesting the given resources. Hosts which do not report their capacity
+// fit any job.
+func (h *Host) Fits(r JobResources) bool {
+	if h.Resources == nil {
+		return true
+	}
+	allocated := h.Allocated()
+	if r.Memory > 0 && allocated.Memory+r.Memory > h.Resources.AllocatableMemory {
+		return false
+	}
+	if r.CPUQuota > 0 && allocated.CPUQuota+r.CPUQuota > h.Resources.AllocatableCPU {
+		return false
+	}
+	return true
 }
 
 type Event struct {
@@ -204,6 +278,29 @@ type ActiveJob struct {
 	ManifestID  string    `json:"manifest_id,omitempty"`
 }
 
+// JobStats is a sample of a running job's resource usage, read from the
+// accounting of its cgroups.
+type JobStats struct {
+	JobID string    `json:"job_id,omitempty"`
+	Time  time.Time `json:"time,omitempty"`
+
+	MemoryUsage int64 `json:"memory_usage"`           // in bytes, including the page cache
+	MemoryLimit int64 `json:"memory_limit,omitempty"` // in bytes, zero if unlimited
+
+	// CPUTime is the total CPU time used by the job so far, so CPU usage
+	// over a period is the difference between two samples.
+	CPUTime time.Duration `json:"cpu_time"`
+
+	Processes int `json:"processes"` // zero if the kernel has no pids cgroup controller
+}
+
+// LogEntry is a chunk of a job's output, as written to the job's log.
+type LogEntry struct {
+	Stream    int       `json:"stream"` // 1 for stdout, 2 for stderr
+	Timestamp time.Time `json:"timestamp"`
+	Data      string    `json:"data"`
+}
+
 type AttachReq struct {
 	JobID  string     `json:"job_id,omitempty"`
 	Flags  AttachFlag `json:"flags,omitempty"`
@@ -211,6 +308,16 @@ type AttachReq struct {
 	Width  uint16     `json:"width,omitempty"`
 }
 
+// ExecReq is a request to run an additional process with a TTY in a running
+// job's container.  The connection then uses the same framing as attach.
+type ExecReq struct {
+	JobID  string            `json:"job_id,omitempty"`
+	Cmd    []string          `json:"cmd,omitempty"`
+	Env    map[string]string `json:"env,omitempty"`
+	Height uint16            `json:"height,omitempty"`
+	Width  uint16            `json:"width,omitempty"`
+}
+
 type AttachFlag uint8
 
 const (
@@ -3,7 +3,10 @@ package volumeapi
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/julienschmidt/httprouter"
 	"github.com/flynn/flynn/host/volume"
@@ -23,13 +26,17 @@ func NewHTTPAPI(vman *volumemanager.Manager) *HTTPAPI {
 func (api *HTTPAPI) RegisterRoutes(r *httprouter.Router) {
 	r.POST("/storage/providers", api.CreateProvider)
 	r.POST("/storage/providers/:provider_id/volumes", api.Create)
+	r.POST("/storage/providers/:provider_id/volumes/receive", api.Receive)
 	r.GET("/storage/volumes", api.List)
 	r.GET("/storage/volumes/:volume_id", api.Inspect)
+	r.DELETE("/storage/volumes/:volume_id", api.Destroy)
 	r.PUT("/storage/volumes/:volume_id/snapshot", api.Snapshot)
+	r.GET("/storage/volumes/:volume_id/send", api.Send)
+	r.GET("/storage/volumes/:volume_id/snapshots", api.ListSnapshots)
+	r.DELETE("/storage/volumes/:volume_id/snapshots/:snapshot_id", api.DestroySnapshot)
 }
 
 func (api *HTTPAPI) CreateProvider(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	var provider volume.Provider
 	pspec := &volume.ProviderSpec{}
 	if err := json.NewDecoder(r.Body).Decode(&pspec); err != nil {
 		httphelper.Error(w, err)
@@ -45,17 +52,14 @@ func (api *HTTPAPI) CreateProvider(w http.ResponseWriter, r *http.Request, ps ht
 		})
 		return
 	}
-	provider, err := volumemanager.NewProvider(pspec)
-	if err == volume.UnknownProviderKind {
-		httphelper.Error(w, httphelper.JSONError{
-			Code:    httphelper.ValidationError,
-			Message: fmt.Sprintf("volume provider kind %q is not known", pspec.Kind),
-		})
-		return
-	}
-
-	if err := api.vman.AddProvider(pspec.ID, provider); err != nil {
+	if err := api.vman.AddProvider(pspec); err != nil {
 		switch err {
+		case volume.UnknownProviderKind:
+			httphelper.Error(w, httphelper.JSONError{
+				Code:    httphelper.ValidationError,
+				Message: fmt.Sprintf("volume provider kind %q is not known", pspec.Kind),
+			})
+			return
 		case volumemanager.ProviderAlreadyExists:
 			httphelper.Error(w, httphelper.JSONError{
 				Code:    httphelper.ObjectExistsError,
@@ -74,13 +78,30 @@ func (api *HTTPAPI) CreateProvider(w http.ResponseWriter, r *http.Request, ps ht
 func (api *HTTPAPI) Create(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	providerID := ps.ByName("provider_id")
 
-	vol, err := api.vman.NewVolumeFromProvider(providerID)
+	// the body is optional, and may give a size limit for the volume
+	req := &volume.Info{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil && err != io.EOF {
+		httphelper.Error(w, err)
+		return
+	}
+	if req.Size < 0 {
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.ValidationError,
+			Message: "volume size must not be negative",
+		})
+		return
+	}
+
+	vol, err := api.vman.NewVolumeFromProvider(providerID, req.Size)
 	if err == volumemanager.NoSuchProvider {
 		httphelper.Error(w, httphelper.JSONError{
 			Code:    httphelper.ObjectNotFoundError,
 			Message: fmt.Sprintf("No volume provider by id %q", providerID),
 		})
 		return
+	} else if err != nil {
+		httphelper.Error(w, err)
+		return
 	}
 
 	httphelper.JSON(w, 200, vol.Info())
@@ -90,7 +111,7 @@ func (api *HTTPAPI) List(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	vols := api.vman.Volumes()
 	volList := make([]*volume.Info, 0, len(vols))
 	for _, v := range vols {
-		volList = append(volList, v.Info())
+		volList = append(volList, volumeInfo(v))
 	}
 	httphelper.JSON(w, 200, volList)
 }
@@ -106,9 +127,165 @@ func (api *HTTPAPI) Inspect(w http.ResponseWriter, r *http.Request, ps httproute
 		return
 	}
 
-	httphelper.JSON(w, 200, vol.Info())
+	httphelper.JSON(w, 200, volumeInfo(vol))
+}
+
+func (api *HTTPAPI) Destroy(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	volumeID := ps.ByName("volume_id")
+	if err := api.vman.DestroyVolume(volumeID); err != nil {
+		volumeError(w, volumeID, err)
+		return
+	}
+	w.WriteHeader(200)
 }
 
 func (api *HTTPAPI) Snapshot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	// TODO
+	volumeID := ps.ByName("volume_id")
+	snap, err := api.vman.CreateSnapshot(volumeID)
+	if err != nil {
+		volumeError(w, volumeID, err)
+		return
+	}
+	httphelper.JSON(w, 200, snap.Info())
+}
+
+func (api *HTTPAPI) ListSnapshots(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	volumeID := ps.ByName("volume_id")
+	snapshots, err := api.vman.ListSnapshots(volumeID)
+	if err != nil {
+		volumeError(w, volumeID, err)
+		return
+	}
+	snapList := make([]*volume.Info, 0, len(snapshots))
+	for _, v := range snapshots {
+		snapList = append(snapList, volumeInfo(v))
+	}
+	httphelper.JSON(w, 200, snapList)
+}
+
+func (api *HTTPAPI) DestroySnapshot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	volumeID := ps.ByName("volume_id")
+	snapshotID := ps.ByName("snapshot_id")
+	snap := api.vman.GetVolume(snapshotID)
+	if snap == nil || snap.Info().ParentID != volumeID {
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.ObjectNotFoundError,
+			Message: fmt.Sprintf("No snapshot by id %q of volume %q", snapshotID, volumeID),
+		})
+		return
+	}
+	if err := api.vman.DestroyVolume(snapshotID); err != nil {
+		volumeError(w, snapshotID, err)
+		return
+	}
+	w.WriteHeader(200)
+}
+
+func (api *HTTPAPI) Send(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	volumeID := ps.ByName("volume_id")
+	info, err := api.vman.StreamInfo(volumeID)
+	if err != nil {
+		volumeError(w, volumeID, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(volume.KindHeader, info.Kind)
+	w.Header().Set(volume.SizeHeader, strconv.FormatInt(info.Size, 10))
+	w.WriteHeader(200)
+	if err := api.vman.SendVolume(volumeID, w); err != nil {
+		// the status has already been sent, so close the connection
+		// without finishing the response to signal the stream is incomplete
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+			}
+		}
+	}
+}
+
+func (api *HTTPAPI) Receive(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	providerID := ps.ByName("provider_id")
+	info := &volume.StreamInfo{Kind: r.Header.Get(volume.KindHeader)}
+	if info.Kind == "" {
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.ValidationError,
+			Message: fmt.Sprintf("the %s header must not be blank", volume.KindHeader),
+		})
+		return
+	}
+	if s := r.Header.Get(volume.SizeHeader); s != "" {
+		var err error
+		if info.Size, err = strconv.ParseInt(s, 10, 64); err != nil || info.Size < 0 {
+			httphelper.Error(w, httphelper.JSONError{
+				Code:    httphelper.ValidationError,
+				Message: fmt.Sprintf("the %s header must be a size in bytes", volume.SizeHeader),
+			})
+			return
+		}
+	}
+
+	vol, err := api.vman.ReceiveVolume(providerID, info, r.Body)
+	switch err {
+	case nil:
+	case volumemanager.NoSuchProvider:
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.ObjectNotFoundError,
+			Message: fmt.Sprintf("No volume provider by id %q", providerID),
+		})
+		return
+	case volumemanager.IncompatibleVolumeKind:
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.ValidationError,
+			Message: fmt.Sprintf("volume provider %q cannot receive a volume of kind %q", providerID, info.Kind),
+		})
+		return
+	default:
+		httphelper.Error(w, err)
+		return
+	}
+
+	httphelper.JSON(w, 200, vol.Info())
+}
+
+/*
+	Returns a copy of the volume's info with its current usage and mounts
+	filled in.  Usage is best effort, and left blank if the provider can't
+	report it.
+*/
+func volumeInfo(vol volume.Volume) *volume.Info {
+	info := *vol.Info()
+	info.Used, info.Available, _ = vol.Usage()
+	for mount := range vol.Mounts() {
+		info.Mounts = append(info.Mounts, mount)
+	}
+	sort.Sort(mountsByJobID(info.Mounts))
+	return &info
+}
+
+type mountsByJobID []volume.VolumeMount
+
+func (m mountsByJobID) Len() int      { return len(m) }
+func (m mountsByJobID) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m mountsByJobID) Less(i, j int) bool {
+	if m[i].JobID == m[j].JobID {
+		return m[i].Location < m[j].Location
+	}
+	return m[i].JobID < m[j].JobID
+}
+
+func volumeError(w http.ResponseWriter, volumeID string, err error) {
+	switch err {
+	case volumemanager.NoSuchVolume:
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.ObjectNotFoundError,
+			Message: fmt.Sprintf("No volume by id %q", volumeID),
+		})
+	case volumemanager.VolumeMounted, volumemanager.VolumeHasSnapshots, volumemanager.VolumeBeingSent:
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.PreconditionFailedError,
+			Message: fmt.Sprintf("volume %q cannot be destroyed: %s", volumeID, err),
+		})
+	default:
+		httphelper.Error(w, err)
+	}
 }
@@ -0,0 +1,136 @@
+package volumeapi
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/boltdb/bolt"
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/julienschmidt/httprouter"
+	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/host/volume/directory"
+	"github.com/flynn/flynn/host/volume/manager"
+	"github.com/flynn/flynn/pkg/cluster"
+	hh "github.com/flynn/flynn/pkg/httphelper"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type S struct {
+	db   *bolt.DB
+	vman *volumemanager.Manager
+	srv  *httptest.Server
+	h    cluster.Host
+}
+
+var _ = Suite(&S{})
+
+func (s *S) SetUpTest(c *C) {
+	dir := c.MkDir()
+	var err error
+	s.db, err = bolt.Open(filepath.Join(dir, "state.bolt"), 0600, &bolt.Options{Timeout: 5 * time.Second})
+	c.Assert(err, IsNil)
+	s.vman, err = volumemanager.New(s.db, func() (volume.Provider, error) {
+		return directory.NewProvider(&directory.ProviderConfig{RootPath: filepath.Join(dir, "volumes")})
+	})
+	c.Assert(err, IsNil)
+
+	r := httprouter.New()
+	NewHTTPAPI(s.vman).RegisterRoutes(r)
+	s.srv = httptest.NewServer(r)
+	s.h = cluster.NewHostClient("host", s.srv.URL, nil)
+}
+
+func (s *S) TearDownTest(c *C) {
+	s.srv.Close()
+	s.db.Close()
+}
+
+func (s *S) TestVolumeLifecycle(c *C) {
+	vol, err := s.h.CreateVolume("default", 0)
+	c.Assert(err, IsNil)
+	c.Assert(vol.ID, Not(Equals), "")
+
+	snap, err := s.h.CreateSnapshot(vol.ID)
+	c.Assert(err, IsNil)
+	c.Assert(snap.ParentID, Equals, vol.ID)
+	snapshots, err := s.h.ListSnapshots(vol.ID)
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 1)
+	c.Assert(snapshots[0].ID, Equals, snap.ID)
+
+	// volumes with snapshots cannot be destroyed
+	err = s.h.DestroyVolume(vol.ID)
+	c.Assert(err, NotNil)
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.PreconditionFailedError)
+
+	// nor can mounted volumes
+	c.Assert(s.h.DestroyVolume(snap.ID), IsNil)
+	_, err = s.vman.GetVolume(vol.ID).Mount("job", "/data")
+	c.Assert(err, IsNil)
+	err = s.h.DestroyVolume(vol.ID)
+	c.Assert(err, NotNil)
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.PreconditionFailedError)
+	s.vman.GetVolume(vol.ID).Unmount("job", "/data")
+
+	c.Assert(s.h.DestroyVolume(vol.ID), IsNil)
+	err = s.h.DestroyVolume(vol.ID)
+	c.Assert(err, NotNil)
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.ObjectNotFoundError)
+	_, err = s.h.ListSnapshots(vol.ID)
+	c.Assert(err, NotNil)
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.ObjectNotFoundError)
+}
+
+func (s *S) TestSendReceive(c *C) {
+	vol, err := s.h.CreateVolume("default", 0)
+	c.Assert(err, IsNil)
+	path, err := s.vman.GetVolume(vol.ID).Mount("job", "/data")
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(path, "file"), []byte("data"), 0644), IsNil)
+
+	stream, info, err := s.h.SendVolume(vol.ID)
+	c.Assert(err, IsNil)
+	defer stream.Close()
+	c.Assert(*info, Equals, volume.StreamInfo{Kind: "directory"})
+
+	received, err := s.h.ReceiveVolume("default", info, stream)
+	c.Assert(err, IsNil)
+	c.Assert(received.ID, Not(Equals), vol.ID)
+	path, err = s.vman.GetVolume(received.ID).Mount("job", "/data")
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(path, "file"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data")
+
+	// streams can only be received by providers of the same kind
+	stream, _, err = s.h.SendVolume(vol.ID)
+	c.Assert(err, IsNil)
+	defer stream.Close()
+	_, err = s.h.ReceiveVolume("default", &volume.StreamInfo{Kind: "zfs"}, stream)
+	c.Assert(err, NotNil)
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.ValidationError)
+}
+
+func (s *S) TestVolumeUsage(c *C) {
+	vol, err := s.h.CreateVolume("default", 0)
+	c.Assert(err, IsNil)
+	path, err := s.vman.GetVolume(vol.ID).Mount("job", "/data")
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(path, "file"), make([]byte, 64*1024), 0644), IsNil)
+
+	vols, err := s.h.ListVolumes()
+	c.Assert(err, IsNil)
+	c.Assert(vols, HasLen, 1)
+	c.Assert(vols[0].ID, Equals, vol.ID)
+	c.Assert(vols[0].Used >= 64*1024, Equals, true)
+	c.Assert(vols[0].Available > 0, Equals, true)
+	c.Assert(vols[0].Mounts, DeepEquals, []volume.VolumeMount{{JobID: "job", Location: "/data"}})
+
+	_, err = s.h.CreateVolume("default", -1)
+	c.Assert(err, NotNil)
+	c.Assert(err.(hh.JSONError).Code, Equals, hh.ValidationError)
+}
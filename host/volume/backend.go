@@ -3,6 +3,7 @@ package volume
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 )
 
 /*
@@ -13,7 +14,30 @@ import (
 	configured for their final storage location.
 */
 type Provider interface {
-	NewVolume() (Volume, error)
+	// NewVolume creates an empty volume which may hold at most size bytes,
+	// or is only limited by the provider's storage if size is zero.
+	NewVolume(size int64) (Volume, error)
+
+	// DestroyVolume removes a volume and all of its data.
+	DestroyVolume(Volume) error
+
+	// MarshalVolumeState returns an opaque blob which RestoreVolumeState can
+	// use to reconstruct the volume, so that volumes are remembered across
+	// host restarts.
+	MarshalVolumeState(Volume) (json.RawMessage, error)
+	RestoreVolumeState(info *Info, data json.RawMessage) (Volume, error)
+
+	// Kind names the kind of provider, which determines the format of the
+	// streams written by SendSnapshot.
+	Kind() string
+
+	// SendSnapshot writes the contents of a volume to output as a stream
+	// which ReceiveSnapshot of any provider of the same kind can import.
+	SendSnapshot(vol Volume, output io.Writer) error
+
+	// ReceiveSnapshot creates a new volume from a stream written by
+	// SendSnapshot, which may hold at most size bytes as NewVolume.
+	ReceiveSnapshot(input io.Reader, size int64) (Volume, error)
 }
 
 type ProviderSpec struct {
@@ -29,4 +53,22 @@ type ProviderSpec struct {
 	Config json.RawMessage `json:"metadata,omitempty"`
 }
 
+// StreamInfo describes a volume stream written by SendSnapshot.
+type StreamInfo struct {
+	// Kind is the kind of provider which wrote the stream, which only
+	// providers of the same kind can receive.
+	Kind string
+
+	// Size is the size limit of the volume which was sent, which is applied
+	// to the volume it is received into.
+	Size int64
+}
+
+// KindHeader and SizeHeader are the HTTP headers sent with a volume stream
+// holding its StreamInfo.
+const (
+	KindHeader = "Flynn-Volume-Kind"
+	SizeHeader = "Flynn-Volume-Size"
+)
+
 var UnknownProviderKind error = fmt.Errorf("volume provider kind is not known")
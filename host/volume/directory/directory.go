@@ -0,0 +1,301 @@
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/pkg/random"
+)
+
+/*
+	The directory provider backs each volume with a plain directory.
+
+	It works on any filesystem, so it can be used on hosts without zfs (and in
+	tests), at the cost of snapshots being full copies (or reflinks, where the
+	filesystem supports them) rather than copy-on-write clones.
+
+	Size limits are enforced with XFS project quotas (set using `xfs_quota`,
+	which also supports ext4), so creating a volume with a size limit fails
+	unless project quotas are enabled for the filesystem holding the root path.
+*/
+type Provider struct {
+	config *ProviderConfig
+
+	// projects is the set of XFS project IDs used by volumes with size
+	// limits, which must be unique on the filesystem.
+	projectsMtx sync.Mutex
+	projects    map[uint32]struct{}
+}
+
+/*
+	Describes directory config used at provider setup time.
+
+	`volume.ProviderSpec.Config` is deserialized to this for directory.
+*/
+type ProviderConfig struct {
+	// RootPath is the directory this provider will create volumes in.
+	// It is created if it doesn't exist.
+	RootPath string `json:"root"`
+}
+
+type dirVolume struct {
+	provider  *Provider
+	info      *volume.Info
+	mounts    map[volume.VolumeMount]struct{}
+	path      string // The directory holding the volume's data.  Mounts into containers are bind-mounts pointing back out to this.
+	projectID uint32 // The XFS project ID enforcing the size limit, or zero if the volume is unlimited.
+}
+
+func NewProvider(config *ProviderConfig) (volume.Provider, error) {
+	if config.RootPath == "" {
+		return nil, fmt.Errorf("directory: the root path must not be blank")
+	}
+	if err := os.MkdirAll(config.RootPath, 0755); err != nil {
+		return nil, err
+	}
+	return &Provider{config: config, projects: make(map[uint32]struct{})}, nil
+}
+
+/*
+	Returns an XFS project ID which no other volume uses.  Project 0 is the
+	default project, which can't be limited.
+*/
+func (p *Provider) allocateProjectID() uint32 {
+	p.projectsMtx.Lock()
+	defer p.projectsMtx.Unlock()
+	for id := uint32(1); ; id++ {
+		if _, ok := p.projects[id]; !ok {
+			p.projects[id] = struct{}{}
+			return id
+		}
+	}
+}
+
+func (p *Provider) releaseProjectID(id uint32) {
+	p.projectsMtx.Lock()
+	defer p.projectsMtx.Unlock()
+	delete(p.projects, id)
+}
+
+func (p *Provider) Kind() string {
+	return "directory"
+}
+
+func (p *Provider) newVolume() (*dirVolume, error) {
+	id := random.UUID()
+	v := &dirVolume{
+		provider: p,
+		info:     &volume.Info{ID: id},
+		mounts:   make(map[volume.VolumeMount]struct{}),
+		path:     filepath.Join(p.config.RootPath, id),
+	}
+	if err := os.Mkdir(v.path, 0755); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (p *Provider) NewVolume(size int64) (volume.Volume, error) {
+	v, err := p.newVolume()
+	if err != nil {
+		return nil, err
+	}
+	if err := v.setSize(size); err != nil {
+		v.destroy()
+		return nil, err
+	}
+	return v, nil
+}
+
+func (p *Provider) DestroyVolume(vol volume.Volume) error {
+	v, ok := vol.(*dirVolume)
+	if !ok {
+		return fmt.Errorf("directory: cannot destroy volume %s from another provider", vol.Info().ID)
+	}
+	return v.destroy()
+}
+
+/*
+	Removes the volume's data and frees its project ID.
+*/
+func (v *dirVolume) destroy() error {
+	if err := os.RemoveAll(v.path); err != nil {
+		return err
+	}
+	if v.projectID != 0 {
+		// clear the limit so the project ID can be reused
+		xfsQuota(filepath.Dir(v.path), fmt.Sprintf("limit -p bhard=0 %d", v.projectID))
+		v.provider.releaseProjectID(v.projectID)
+		v.projectID = 0
+	}
+	return nil
+}
+
+// dirVolumeState is the persisted state of a directory volume.
+type dirVolumeState struct {
+	Path      string `json:"path"`
+	ProjectID uint32 `json:"project_id,omitempty"`
+}
+
+func (p *Provider) MarshalVolumeState(vol volume.Volume) (json.RawMessage, error) {
+	v, ok := vol.(*dirVolume)
+	if !ok {
+		return nil, fmt.Errorf("directory: cannot marshal volume %s from another provider", vol.Info().ID)
+	}
+	return json.Marshal(&dirVolumeState{Path: v.path, ProjectID: v.projectID})
+}
+
+func (p *Provider) RestoreVolumeState(info *volume.Info, data json.RawMessage) (volume.Volume, error) {
+	state := &dirVolumeState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(state.Path); err != nil {
+		return nil, err
+	}
+	if state.ProjectID != 0 {
+		p.projectsMtx.Lock()
+		p.projects[state.ProjectID] = struct{}{}
+		p.projectsMtx.Unlock()
+	}
+	return &dirVolume{
+		provider:  p,
+		info:      info,
+		mounts:    make(map[volume.VolumeMount]struct{}),
+		path:      state.Path,
+		projectID: state.ProjectID,
+	}, nil
+}
+
+/*
+	Sends the contents of the volume as a tar stream.
+*/
+func (p *Provider) SendSnapshot(vol volume.Volume, output io.Writer) error {
+	v, ok := vol.(*dirVolume)
+	if !ok {
+		return fmt.Errorf("directory: cannot send volume %s from another provider", vol.Info().ID)
+	}
+	return volume.SendTar(v.path, output)
+}
+
+/*
+	Receives a tar stream written by `SendSnapshot` into a new volume, which is
+	limited to size bytes before any data is written to it.
+*/
+func (p *Provider) ReceiveSnapshot(input io.Reader, size int64) (volume.Volume, error) {
+	v, err := p.newVolume()
+	if err != nil {
+		return nil, err
+	}
+	if err := v.setSize(size); err != nil {
+		v.destroy()
+		return nil, err
+	}
+	if err := volume.ReceiveTar(v.path, input); err != nil {
+		v.destroy()
+		return nil, err
+	}
+	return v, nil
+}
+
+func (v *dirVolume) Info() *volume.Info {
+	return v.info
+}
+
+func (v *dirVolume) Mounts() map[volume.VolumeMount]struct{} {
+	return v.mounts
+}
+
+func (v *dirVolume) Mount(jobId, path string) (string, error) {
+	v.mounts[volume.VolumeMount{JobID: jobId, Location: path}] = struct{}{}
+	return v.path, nil
+}
+
+func (v *dirVolume) Unmount(jobId, path string) {
+	delete(v.mounts, volume.VolumeMount{JobID: jobId, Location: path})
+}
+
+/*
+	Copies the volume's contents into a new directory, using reflinks where the
+	filesystem supports them so that unchanged data isn't duplicated.
+*/
+func (v1 *dirVolume) TakeSnapshot() (volume.Volume, error) {
+	id := random.UUID()
+	v2 := &dirVolume{
+		provider: v1.provider,
+		info:     &volume.Info{ID: id, ParentID: v1.info.ID},
+		mounts:   make(map[volume.VolumeMount]struct{}),
+		path:     filepath.Join(filepath.Dir(v1.path), id),
+	}
+	if out, err := exec.Command("cp", "-a", "--reflink=auto", v1.path, v2.path).CombinedOutput(); err != nil {
+		os.RemoveAll(v2.path)
+		return nil, fmt.Errorf("directory: error copying volume: %s: %s", err, out)
+	}
+	if err := v2.setSize(v1.info.Size); err != nil {
+		v2.destroy()
+		return nil, err
+	}
+	return v2, nil
+}
+
+/*
+	Reports the disk space used by the volume's files (as `du` would), and the
+	space left either before the size limit or on the filesystem, whichever is
+	less.
+*/
+func (v *dirVolume) Usage() (int64, int64, error) {
+	var used int64
+	if err := filepath.Walk(v.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			used += stat.Blocks * 512
+		}
+		return nil
+	}); err != nil {
+		return 0, 0, err
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(v.path, &fs); err != nil {
+		return 0, 0, err
+	}
+	available := int64(fs.Bavail) * int64(fs.Bsize)
+	if size := v.info.Size; size > 0 && size-used < available {
+		available = size - used
+		if available < 0 {
+			available = 0
+		}
+	}
+	return used, available, nil
+}
+
+/*
+	Limits the volume to size bytes using a project quota with a newly
+	allocated project ID.  A size of zero leaves the volume unlimited.
+*/
+func (v *dirVolume) setSize(size int64) error {
+	v.info.Size = size
+	if size == 0 {
+		return nil
+	}
+	v.projectID = v.provider.allocateProjectID()
+	if err := xfsQuota(v.path, fmt.Sprintf("project -s -p %s %d", v.path, v.projectID)); err != nil {
+		return err
+	}
+	return xfsQuota(v.path, fmt.Sprintf("limit -p bhard=%d %d", size, v.projectID))
+}
+
+func xfsQuota(path, cmd string) error {
+	if out, err := exec.Command("xfs_quota", "-x", "-c", cmd, path).CombinedOutput(); err != nil {
+		return fmt.Errorf("directory: error setting quota (are project quotas enabled?): %s: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package directory
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/pkg/testutils"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type DirectoryTests struct {
+	provider volume.Provider
+}
+
+var _ = Suite(&DirectoryTests{})
+
+func (s *DirectoryTests) SetUpTest(c *C) {
+	var err error
+	s.provider, err = NewProvider(&ProviderConfig{RootPath: c.MkDir()})
+	c.Assert(err, IsNil)
+}
+
+func writeFile(c *C, v volume.Volume, name string) {
+	c.Assert(ioutil.WriteFile(filepath.Join(v.(*dirVolume).path, name), []byte(name), 0644), IsNil)
+}
+
+func (s *DirectoryTests) TestSnapshotShouldCarryFiles(c *C) {
+	v, err := s.provider.NewVolume(0)
+	c.Assert(err, IsNil)
+
+	// a new volume should start out empty:
+	c.Assert(v.(*dirVolume).path, testutils.DirContains, []string{})
+
+	writeFile(c, v, "alpha")
+	v2, err := v.TakeSnapshot()
+	c.Assert(err, IsNil)
+	c.Assert(v2.Info().ParentID, Equals, v.Info().ID)
+
+	// the snapshot should have the same content:
+	c.Assert(v2.(*dirVolume).path, testutils.DirContains, []string{"alpha"})
+}
+
+func (s *DirectoryTests) TestSnapshotShouldIsolateChanges(c *C) {
+	v, err := s.provider.NewVolume(0)
+	c.Assert(err, IsNil)
+	writeFile(c, v, "alpha")
+
+	v2, err := v.TakeSnapshot()
+	c.Assert(err, IsNil)
+	writeFile(c, v, "beta")
+	writeFile(c, v2, "gamma")
+
+	c.Assert(v.(*dirVolume).path, testutils.DirContains, []string{"alpha", "beta"})
+	c.Assert(v2.(*dirVolume).path, testutils.DirContains, []string{"alpha", "gamma"})
+}
+
+func (s *DirectoryTests) TestSendReceiveShouldCarryFiles(c *C) {
+	v, err := s.provider.NewVolume(0)
+	c.Assert(err, IsNil)
+	writeFile(c, v, "alpha")
+
+	var stream bytes.Buffer
+	c.Assert(s.provider.SendSnapshot(v, &stream), IsNil)
+	v2, err := s.provider.ReceiveSnapshot(&stream, 0)
+	c.Assert(err, IsNil)
+	c.Assert(v2.Info().ID, Not(Equals), v.Info().ID)
+	c.Assert(v2.(*dirVolume).path, testutils.DirContains, []string{"alpha"})
+}
+
+func (s *DirectoryTests) TestRestoreAndDestroy(c *C) {
+	v, err := s.provider.NewVolume(0)
+	c.Assert(err, IsNil)
+	writeFile(c, v, "alpha")
+
+	state, err := s.provider.MarshalVolumeState(v)
+	c.Assert(err, IsNil)
+	restored, err := s.provider.RestoreVolumeState(v.Info(), state)
+	c.Assert(err, IsNil)
+	c.Assert(restored.(*dirVolume).path, testutils.DirContains, []string{"alpha"})
+
+	c.Assert(s.provider.DestroyVolume(restored), IsNil)
+	_, err = os.Stat(v.(*dirVolume).path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	// volumes whose data has gone can't be restored
+	_, err = s.provider.RestoreVolumeState(v.Info(), state)
+	c.Assert(err, NotNil)
+}
+
+func (s *DirectoryTests) TestUsage(c *C) {
+	v, err := s.provider.NewVolume(0)
+	c.Assert(err, IsNil)
+	used, available, err := v.Usage()
+	c.Assert(err, IsNil)
+	c.Assert(available > 0, Equals, true)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(v.(*dirVolume).path, "data"), make([]byte, 64*1024), 0644), IsNil)
+	used2, _, err := v.Usage()
+	c.Assert(err, IsNil)
+	c.Assert(used2-used >= 64*1024, Equals, true, Commentf("used %d bytes before writing, %d after", used, used2))
+
+	// the available space is capped by the size limit, which is otherwise
+	// enforced by a quota and can't be tested without one
+	v.(*dirVolume).info.Size = 128 * 1024
+	used, available, err = v.Usage()
+	c.Assert(err, IsNil)
+	c.Assert(available, Equals, 128*1024-used)
+}
+
+func (s *DirectoryTests) TestProjectIDs(c *C) {
+	p := s.provider.(*Provider)
+	c.Assert(p.allocateProjectID(), Equals, uint32(1))
+	c.Assert(p.allocateProjectID(), Equals, uint32(2))
+
+	// restored volumes keep their project IDs, which aren't reused
+	v, err := s.provider.NewVolume(0)
+	c.Assert(err, IsNil)
+	v.(*dirVolume).projectID = 3
+	state, err := s.provider.MarshalVolumeState(v)
+	c.Assert(err, IsNil)
+	p2, err := NewProvider(p.config)
+	c.Assert(err, IsNil)
+	restored, err := p2.RestoreVolumeState(v.Info(), state)
+	c.Assert(err, IsNil)
+	c.Assert(restored.(*dirVolume).projectID, Equals, uint32(3))
+	p2.(*Provider).releaseProjectID(1)
+	c.Assert(p2.(*Provider).allocateProjectID(), Equals, uint32(1))
+	c.Assert(p2.(*Provider).allocateProjectID(), Equals, uint32(2))
+	c.Assert(p2.(*Provider).allocateProjectID(), Equals, uint32(4))
+
+	// IDs are freed when volumes are destroyed
+	c.Assert(p2.DestroyVolume(restored), IsNil)
+	c.Assert(p2.(*Provider).allocateProjectID(), Equals, uint32(3))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/host/volume/directory"
 	"github.com/flynn/flynn/host/volume/zfs"
 )
 
@@ -18,6 +19,12 @@ func NewProvider(pspec *volume.ProviderSpec) (provider volume.Provider, err erro
 			return
 		}
 		return
+	case "directory":
+		config := &directory.ProviderConfig{}
+		if err := json.Unmarshal(pspec.Config, config); err != nil {
+			return nil, err
+		}
+		return directory.NewProvider(config)
 	default:
 		return nil, volume.UnknownProviderKind
 	}
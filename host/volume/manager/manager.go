@@ -1,10 +1,13 @@
 package volumemanager
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
 
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/boltdb/bolt"
 	"github.com/flynn/flynn/host/volume"
 )
 
@@ -12,6 +15,10 @@ import (
 	volume.Manager providers interfaces for both provisioning volume backends, and then creating volumes using them.
 
 	There is one volume.Manager per host daemon process.
+
+	The manager's knowledge of providers and volumes is persisted in the host's
+	state DB, so that volumes (and the names given to them) survive a restart of
+	the host daemon.
 */
 type Manager struct {
 	mutex sync.Mutex
@@ -26,15 +33,45 @@ type Manager struct {
 	// `map[volume.Id]volume`
 	volumes map[string]volume.Volume
 
+	// `map[volume.Id]providerName`
+	volumeProviders map[string]string
+
 	// `map[wellKnownName]volume.Id`
 	namedVolumes map[string]string
+
+	// `map[volume.Id]numberOfSends`
+	//
+	// Volumes which are being sent by `SendVolume`, which cannot be destroyed
+	// until the sends finish.
+	sending map[string]int
+
+	db *bolt.DB
 }
 
-func New(defProvFn func() (volume.Provider, error)) (*Manager, error) {
+var (
+	providersBucket    = []byte("volume-providers")
+	volumesBucket      = []byte("volumes")
+	namedVolumesBucket = []byte("named-volumes")
+)
+
+/*
+	Creates a Manager persisting its state to db, and restores any providers and
+	volumes which were persisted there previously.
+*/
+func New(db *bolt.DB, defProvFn func() (volume.Provider, error)) (*Manager, error) {
 	m := &Manager{
-		providers:    make(map[string]volume.Provider),
-		volumes:      make(map[string]volume.Volume),
-		namedVolumes: make(map[string]string),
+		providers:       make(map[string]volume.Provider),
+		volumes:         make(map[string]volume.Volume),
+		volumeProviders: make(map[string]string),
+		namedVolumes:    make(map[string]string),
+		sending:         make(map[string]int),
+		db:              db,
+	}
+	if err := m.initializePersistence(); err != nil {
+		return nil, err
+	}
+	if err := m.restoreProviders(); err != nil {
+		return nil, err
 	}
 	if _, ok := m.providers["default"]; !ok {
 		p, err := defProvFn()
@@ -43,19 +80,43 @@ func New(defProvFn func() (volume.Provider, error)) (*Manager, error) {
 		}
 		m.providers["default"] = p
 	}
+	if err := m.restoreVolumes(); err != nil {
+		return nil, err
+	}
 	return m, nil
 }
 
 var NoSuchProvider = errors.New("no such provider")
 var ProviderAlreadyExists = errors.New("that provider id already exists")
+var NoSuchVolume = errors.New("no such volume")
+var VolumeMounted = errors.New("volume is mounted")
+var VolumeHasSnapshots = errors.New("volume has snapshots")
+var VolumeBeingSent = errors.New("volume is being sent")
+var IncompatibleVolumeKind = errors.New("volume stream is not of the provider's kind")
 
-func (m *Manager) AddProvider(id string, p volume.Provider) error {
+/*
+	Creates a provider from pspec and adds it to the manager.
+*/
+func (m *Manager) AddProvider(pspec *volume.ProviderSpec) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	if _, ok := m.providers[id]; ok {
+	if _, ok := m.providers[pspec.ID]; ok {
 		return ProviderAlreadyExists
 	}
-	m.providers[id] = p
+	p, err := NewProvider(pspec)
+	if err != nil {
+		return err
+	}
+	if err := m.db.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(pspec)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(providersBucket).Put([]byte(pspec.ID), b)
+	}); err != nil {
+		return err
+	}
+	m.providers[pspec.ID] = p
 	return nil
 }
 
@@ -73,31 +134,55 @@ func (m *Manager) Volumes() map[string]volume.Volume {
 	volume.Manager implements the volume.Provider interface by
 	delegating NewVolume requests to the default Provider.
 */
-func (m *Manager) NewVolume() (volume.Volume, error) {
+func (m *Manager) NewVolume(size int64) (volume.Volume, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	return m.newVolumeFromProviderLocked("")
+	return m.newVolumeFromProviderLocked("", size)
 }
 
 /*
 	volume.Manager implements the volume.Provider interface by
 	delegating NewVolume requests to the named Provider.
 */
-func (m *Manager) NewVolumeFromProvider(providerID string) (volume.Volume, error) {
+func (m *Manager) NewVolumeFromProvider(providerID string, size int64) (volume.Volume, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	return m.newVolumeFromProviderLocked(providerID)
+	return m.newVolumeFromProviderLocked(providerID, size)
 }
 
-func (m *Manager) newVolumeFromProviderLocked(providerID string) (volume.Volume, error) {
+func (m *Manager) newVolumeFromProviderLocked(providerID string, size int64) (volume.Volume, error) {
 	if providerID == "" {
 		providerID = "default"
 	}
-	if p, ok := m.providers[providerID]; ok {
-		return managerProviderProxy{p, m}.NewVolume()
-	} else {
+	p, ok := m.providers[providerID]
+	if !ok {
 		return nil, NoSuchProvider
 	}
+	v, err := p.NewVolume(size)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.addVolumeLocked(v, providerID); err != nil {
+		p.DestroyVolume(v)
+		return nil, err
+	}
+	return v, nil
+}
+
+/*
+	Records a volume created by the given provider, making sure the manager
+	remains apprised of all volume lifecycle events.
+*/
+func (m *Manager) addVolumeLocked(v volume.Volume, providerID string) error {
+	id := v.Info().ID
+	m.volumes[id] = v
+	m.volumeProviders[id] = providerID
+	if err := m.persistVolumeLocked(id); err != nil {
+		delete(m.volumes, id)
+		delete(m.volumeProviders, id)
+		return err
+	}
+	return nil
 }
 
 func (m *Manager) GetVolume(id string) volume.Volume {
@@ -107,21 +192,170 @@ func (m *Manager) GetVolume(id string) volume.Volume {
 }
 
 /*
-	Proxies `volume.Provider` while making sure the manager remains
-	apprised of all volume lifecycle events.
+	Takes a snapshot of the volume with the given id, and records it with
+	the manager like any other volume.
+*/
+func (m *Manager) CreateSnapshot(id string) (volume.Volume, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v, ok := m.volumes[id]
+	if !ok {
+		return nil, NoSuchVolume
+	}
+	snap, err := v.TakeSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.addVolumeLocked(snap, m.volumeProviders[id]); err != nil {
+		m.providers[m.volumeProviders[id]].DestroyVolume(snap)
+		return nil, err
+	}
+	return snap, nil
+}
+
+/*
+	Returns the snapshots which have been taken of the volume with the given id.
 */
-type managerProviderProxy struct {
-	volume.Provider
-	m *Manager
+func (m *Manager) ListSnapshots(id string) ([]volume.Volume, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.volumes[id]; !ok {
+		return nil, NoSuchVolume
+	}
+	var snapshots []volume.Volume
+	for _, v := range m.volumes {
+		if v.Info().ParentID == id {
+			snapshots = append(snapshots, v)
+		}
+	}
+	return snapshots, nil
 }
 
-func (p managerProviderProxy) NewVolume() (volume.Volume, error) {
-	v, err := p.Provider.NewVolume()
+/*
+	Destroys the volume with the given id and all of its data.
+
+	Volumes which are mounted into a job, which have snapshots, or which are
+	being sent, cannot be destroyed.  Any names referring to the volume are
+	forgotten.
+*/
+func (m *Manager) DestroyVolume(id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v, ok := m.volumes[id]
+	if !ok {
+		return NoSuchVolume
+	}
+	if len(v.Mounts()) > 0 {
+		return VolumeMounted
+	}
+	if m.sending[id] > 0 {
+		return VolumeBeingSent
+	}
+	for _, other := range m.volumes {
+		if other.Info().ParentID == id {
+			return VolumeHasSnapshots
+		}
+	}
+	if err := m.providers[m.volumeProviders[id]].DestroyVolume(v); err != nil {
+		return err
+	}
+	delete(m.volumes, id)
+	delete(m.volumeProviders, id)
+	for name, volID := range m.namedVolumes {
+		if volID == id {
+			delete(m.namedVolumes, name)
+		}
+	}
+	return m.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(volumesBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		named := tx.Bucket(namedVolumesBucket)
+		return named.ForEach(func(k, v []byte) error {
+			if string(v) == id {
+				return named.Delete(k)
+			}
+			return nil
+		})
+	})
+}
+
+/*
+	Describes the stream `SendVolume` will write for the volume with the given
+	id: the kind of its provider, which names the format, and its size limit.
+*/
+func (m *Manager) StreamInfo(id string) (*volume.StreamInfo, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v, ok := m.volumes[id]
+	if !ok {
+		return nil, NoSuchVolume
+	}
+	return &volume.StreamInfo{
+		Kind: m.providers[m.volumeProviders[id]].Kind(),
+		Size: v.Info().Size,
+	}, nil
+}
+
+/*
+	Writes the contents of the volume with the given id to output, as a
+	stream which can be given to `ReceiveVolume` on another host.
+
+	The volume cannot be destroyed until the send finishes.
+*/
+func (m *Manager) SendVolume(id string, output io.Writer) error {
+	m.mutex.Lock()
+	v, ok := m.volumes[id]
+	if !ok {
+		m.mutex.Unlock()
+		return NoSuchVolume
+	}
+	p := m.providers[m.volumeProviders[id]]
+	m.sending[id]++
+	m.mutex.Unlock()
+
+	defer func() {
+		m.mutex.Lock()
+		if m.sending[id]--; m.sending[id] == 0 {
+			delete(m.sending, id)
+		}
+		m.mutex.Unlock()
+	}()
+
+	// the lock isn't held while sending, which may take a long time
+	return p.SendSnapshot(v, output)
+}
+
+/*
+	Creates a new volume using the named provider from a stream written by
+	`SendVolume`, described by info.  The kind of provider which wrote the
+	stream must match the kind of the receiving provider, and the new volume
+	has the same size limit as the one which was sent.
+*/
+func (m *Manager) ReceiveVolume(providerID string, info *volume.StreamInfo, input io.Reader) (volume.Volume, error) {
+	if providerID == "" {
+		providerID = "default"
+	}
+	m.mutex.Lock()
+	p, ok := m.providers[providerID]
+	m.mutex.Unlock()
+	if !ok {
+		return nil, NoSuchProvider
+	}
+	if p.Kind() != info.Kind {
+		return nil, IncompatibleVolumeKind
+	}
+	v, err := p.ReceiveSnapshot(input, info.Size)
 	if err != nil {
-		return v, err
+		return nil, err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := m.addVolumeLocked(v, providerID); err != nil {
+		p.DestroyVolume(v)
+		return nil, err
 	}
-	p.m.volumes[v.Info().ID] = v
-	return v, err
+	return v, nil
 }
 
 /*
@@ -135,10 +369,107 @@ func (m *Manager) CreateOrGetNamedVolume(name string, providerID string) (volume
 	if v, ok := m.namedVolumes[name]; ok {
 		return m.volumes[v], nil
 	}
-	v, err := m.newVolumeFromProviderLocked(providerID)
+	v, err := m.newVolumeFromProviderLocked(providerID, 0)
 	if err != nil {
 		return nil, err
 	}
+	if err := m.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(namedVolumesBucket).Put([]byte(name), []byte(v.Info().ID))
+	}); err != nil {
+		return nil, err
+	}
 	m.namedVolumes[name] = v.Info().ID
 	return v, nil
 }
+
+/*
+	`volumeRecord` is the persisted form of a volume.  The state blob is
+	opaque to the manager, and is handed back to the volume's provider on
+	restore.
+*/
+type volumeRecord struct {
+	Info       *volume.Info    `json:"info"`
+	ProviderID string          `json:"provider"`
+	Kind       string          `json:"kind"`
+	State      json.RawMessage `json:"state"`
+}
+
+func (m *Manager) initializePersistence() error {
+	return m.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{providersBucket, volumesBucket, namedVolumesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Manager) persistVolumeLocked(id string) error {
+	v := m.volumes[id]
+	providerID := m.volumeProviders[id]
+	p := m.providers[providerID]
+	state, err := p.MarshalVolumeState(v)
+	if err != nil {
+		return fmt.Errorf("failed to serialize volume state: %s", err)
+	}
+	b, err := json.Marshal(&volumeRecord{Info: v.Info(), ProviderID: providerID, Kind: p.Kind(), State: state})
+	if err != nil {
+		return err
+	}
+	return m.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(volumesBucket).Put([]byte(id), b)
+	})
+}
+
+func (m *Manager) restoreProviders() error {
+	return m.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(providersBucket).ForEach(func(k, v []byte) error {
+			pspec := &volume.ProviderSpec{}
+			if err := json.Unmarshal(v, pspec); err != nil {
+				return err
+			}
+			p, err := NewProvider(pspec)
+			if err != nil {
+				return fmt.Errorf("could not restore volume provider %s: %s", pspec.ID, err)
+			}
+			m.providers[pspec.ID] = p
+			return nil
+		})
+	})
+}
+
+func (m *Manager) restoreVolumes() error {
+	return m.db.View(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(volumesBucket).ForEach(func(k, v []byte) error {
+			record := &volumeRecord{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+			p, ok := m.providers[record.ProviderID]
+			if !ok {
+				return fmt.Errorf("could not restore volume %s: no such provider %q", k, record.ProviderID)
+			}
+			// the default provider is configured afresh at each start, so
+			// it may no longer be the kind which created the volume
+			if p.Kind() != record.Kind {
+				return fmt.Errorf("could not restore volume %s: provider %q is of kind %q, not %q", k, record.ProviderID, p.Kind(), record.Kind)
+			}
+			vol, err := p.RestoreVolumeState(record.Info, record.State)
+			if err != nil {
+				return fmt.Errorf("could not restore volume %s: %s", k, err)
+			}
+			m.volumes[string(k)] = vol
+			m.volumeProviders[string(k)] = record.ProviderID
+			return nil
+		}); err != nil {
+			return err
+		}
+		return tx.Bucket(namedVolumesBucket).ForEach(func(k, v []byte) error {
+			if _, ok := m.volumes[string(v)]; ok {
+				m.namedVolumes[string(k)] = string(v)
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,240 @@
+package volumemanager
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/boltdb/bolt"
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/host/volume"
+	"github.com/flynn/flynn/pkg/random"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+type mockProvider struct {
+	destroyed map[string]bool
+}
+
+func newMockProvider() (volume.Provider, error) {
+	return &mockProvider{destroyed: make(map[string]bool)}, nil
+}
+
+func (p *mockProvider) NewVolume(size int64) (volume.Volume, error) {
+	return newMockVolume(&volume.Info{ID: random.UUID(), Size: size}), nil
+}
+
+func (p *mockProvider) DestroyVolume(v volume.Volume) error {
+	p.destroyed[v.Info().ID] = true
+	return nil
+}
+
+func (p *mockProvider) Kind() string {
+	return "mock"
+}
+
+func (p *mockProvider) SendSnapshot(v volume.Volume, output io.Writer) error {
+	_, err := io.WriteString(output, v.(*mockVolume).data)
+	return err
+}
+
+func (p *mockProvider) ReceiveSnapshot(input io.Reader, size int64) (volume.Volume, error) {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	v := newMockVolume(&volume.Info{ID: random.UUID(), Size: size})
+	v.data = string(data)
+	return v, nil
+}
+
+func (p *mockProvider) MarshalVolumeState(v volume.Volume) (json.RawMessage, error) {
+	return json.Marshal(v.(*mockVolume).data)
+}
+
+func (p *mockProvider) RestoreVolumeState(info *volume.Info, data json.RawMessage) (volume.Volume, error) {
+	v := newMockVolume(info)
+	return v, json.Unmarshal(data, &v.data)
+}
+
+type mockVolume struct {
+	info   *volume.Info
+	mounts map[volume.VolumeMount]struct{}
+	data   string
+}
+
+func newMockVolume(info *volume.Info) *mockVolume {
+	return &mockVolume{info: info, mounts: make(map[volume.VolumeMount]struct{}), data: "data-" + info.ID}
+}
+
+func (v *mockVolume) Info() *volume.Info { return v.info }
+
+func (v *mockVolume) Mounts() map[volume.VolumeMount]struct{} { return v.mounts }
+
+func (v *mockVolume) Mount(jobId, path string) (string, error) {
+	v.mounts[volume.VolumeMount{JobID: jobId, Location: path}] = struct{}{}
+	return "/mnt/" + v.info.ID, nil
+}
+
+func (v *mockVolume) Unmount(jobId, path string) {
+	delete(v.mounts, volume.VolumeMount{JobID: jobId, Location: path})
+}
+
+func (v *mockVolume) TakeSnapshot() (volume.Volume, error) {
+	return newMockVolume(&volume.Info{ID: random.UUID(), ParentID: v.info.ID, Size: v.info.Size}), nil
+}
+
+func (v *mockVolume) Usage() (int64, int64, error) {
+	return int64(len(v.data)), v.info.Size - int64(len(v.data)), nil
+}
+
+func openDB(c *C, path string) *bolt.DB {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	c.Assert(err, IsNil)
+	return db
+}
+
+func (S) TestPersistence(c *C) {
+	path := filepath.Join(c.MkDir(), "state.bolt")
+	db := openDB(c, path)
+	m, err := New(db, newMockProvider)
+	c.Assert(err, IsNil)
+
+	named, err := m.CreateOrGetNamedVolume("postgres", "")
+	c.Assert(err, IsNil)
+	snap, err := m.CreateSnapshot(named.Info().ID)
+	c.Assert(err, IsNil)
+	sized, err := m.NewVolume(1024)
+	c.Assert(err, IsNil)
+	c.Assert(db.Close(), IsNil)
+
+	// volumes, snapshots and names are restored from the db
+	db = openDB(c, path)
+	defer db.Close()
+	m, err = New(db, newMockProvider)
+	c.Assert(err, IsNil)
+	c.Assert(m.Volumes(), HasLen, 3)
+	c.Assert(m.GetVolume(sized.Info().ID).Info().Size, Equals, int64(1024))
+	restored, err := m.CreateOrGetNamedVolume("postgres", "")
+	c.Assert(err, IsNil)
+	c.Assert(restored.Info().ID, Equals, named.Info().ID)
+	c.Assert(restored.(*mockVolume).data, Equals, named.(*mockVolume).data)
+	snapshots, err := m.ListSnapshots(named.Info().ID)
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 1)
+	c.Assert(snapshots[0].Info().ID, Equals, snap.Info().ID)
+	c.Assert(snapshots[0].Info().ParentID, Equals, named.Info().ID)
+}
+
+func (S) TestDestroyVolume(c *C) {
+	db := openDB(c, filepath.Join(c.MkDir(), "state.bolt"))
+	defer db.Close()
+	m, err := New(db, newMockProvider)
+	c.Assert(err, IsNil)
+	provider := m.providers["default"].(*mockProvider)
+
+	c.Assert(m.DestroyVolume("nonexistent"), Equals, NoSuchVolume)
+
+	vol, err := m.CreateOrGetNamedVolume("vol", "")
+	c.Assert(err, IsNil)
+	id := vol.Info().ID
+
+	// mounted volumes cannot be destroyed
+	_, err = vol.Mount("job", "/data")
+	c.Assert(err, IsNil)
+	c.Assert(m.DestroyVolume(id), Equals, VolumeMounted)
+	vol.Unmount("job", "/data")
+
+	// volumes with snapshots cannot be destroyed until the snapshots are
+	snap, err := m.CreateSnapshot(id)
+	c.Assert(err, IsNil)
+	c.Assert(m.DestroyVolume(id), Equals, VolumeHasSnapshots)
+	c.Assert(m.DestroyVolume(snap.Info().ID), IsNil)
+	c.Assert(provider.destroyed[snap.Info().ID], Equals, true)
+	snapshots, err := m.ListSnapshots(id)
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 0)
+
+	c.Assert(m.DestroyVolume(id), IsNil)
+	c.Assert(provider.destroyed[id], Equals, true)
+	c.Assert(m.GetVolume(id), IsNil)
+	c.Assert(m.Volumes(), HasLen, 0)
+
+	// the name is forgotten along with the volume
+	vol, err = m.CreateOrGetNamedVolume("vol", "")
+	c.Assert(err, IsNil)
+	c.Assert(vol.Info().ID, Not(Equals), id)
+}
+
+func (S) TestSendReceiveVolume(c *C) {
+	db := openDB(c, filepath.Join(c.MkDir(), "state.bolt"))
+	defer db.Close()
+	m, err := New(db, newMockProvider)
+	c.Assert(err, IsNil)
+
+	vol, err := m.NewVolume(1024)
+	c.Assert(err, IsNil)
+	info, err := m.StreamInfo(vol.Info().ID)
+	c.Assert(err, IsNil)
+	c.Assert(*info, Equals, volume.StreamInfo{Kind: "mock", Size: 1024})
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(m.SendVolume(vol.Info().ID, w))
+	}()
+	received, err := m.ReceiveVolume("", info, r)
+	c.Assert(err, IsNil)
+	c.Assert(received.Info().ID, Not(Equals), vol.Info().ID)
+	c.Assert(received.Info().Size, Equals, int64(1024))
+	c.Assert(received.(*mockVolume).data, Equals, vol.(*mockVolume).data)
+	c.Assert(m.GetVolume(received.Info().ID), Equals, received)
+
+	_, err = m.ReceiveVolume("", &volume.StreamInfo{Kind: "zfs"}, strings.NewReader("data"))
+	c.Assert(err, Equals, IncompatibleVolumeKind)
+	_, err = m.ReceiveVolume("nonexistent", info, strings.NewReader("data"))
+	c.Assert(err, Equals, NoSuchProvider)
+	c.Assert(m.SendVolume("nonexistent", ioutil.Discard), Equals, NoSuchVolume)
+}
+
+func (S) TestDestroyVolumeWhileSending(c *C) {
+	db := openDB(c, filepath.Join(c.MkDir(), "state.bolt"))
+	defer db.Close()
+	m, err := New(db, newMockProvider)
+	c.Assert(err, IsNil)
+
+	vol, err := m.NewVolume(0)
+	c.Assert(err, IsNil)
+	id := vol.Info().ID
+	vol.(*mockVolume).data = "data"
+
+	r, w := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- m.SendVolume(id, w)
+	}()
+
+	// the send blocks until the data is read, so it is in progress until then
+	buf := make([]byte, 1)
+	_, err = io.ReadFull(r, buf)
+	c.Assert(err, IsNil)
+	c.Assert(m.DestroyVolume(id), Equals, VolumeBeingSent)
+
+	_, err = ioutil.ReadAll(io.LimitReader(r, 3))
+	c.Assert(err, IsNil)
+	select {
+	case err := <-done:
+		c.Assert(err, IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("timed out waiting for send")
+	}
+	c.Assert(m.DestroyVolume(id), IsNil)
+}
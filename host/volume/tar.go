@@ -0,0 +1,30 @@
+package volume
+
+import (
+	"io"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/archive"
+)
+
+/*
+	SendTar writes the contents of dir to output as a tar stream.
+
+	Providers which have no native way to serialize their volumes can use this
+	(with `ReceiveTar`) to implement `SendSnapshot` and `ReceiveSnapshot`.
+*/
+func SendTar(dir string, output io.Writer) error {
+	tar, err := archive.TarWithOptions(dir, &archive.TarOptions{Compression: archive.Uncompressed})
+	if err != nil {
+		return err
+	}
+	defer tar.Close()
+	_, err = io.Copy(output, tar)
+	return err
+}
+
+/*
+	ReceiveTar unpacks a tar stream written by `SendTar` into dir.
+*/
+func ReceiveTar(dir string, input io.Reader) error {
+	return archive.Untar(input, dir, &archive.TarOptions{})
+}
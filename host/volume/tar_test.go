@@ -0,0 +1,40 @@
+package volume
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func (S) TestTarRoundTrip(c *C) {
+	src := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(src, "a", "b"), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(src, "a", "b", "file"), []byte("data"), 0600), IsNil)
+	c.Assert(os.Symlink("b/file", filepath.Join(src, "a", "link")), IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(SendTar(src, &buf), IsNil)
+
+	dst := c.MkDir()
+	c.Assert(ReceiveTar(dst, &buf), IsNil)
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "a", "b", "file"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data")
+	info, err := os.Stat(filepath.Join(dst, "a", "b", "file"))
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0600))
+	target, err := os.Readlink(filepath.Join(dst, "a", "link"))
+	c.Assert(err, IsNil)
+	c.Assert(target, Equals, "b/file")
+}
@@ -12,8 +12,10 @@ package volume
 	of mounts, and supplies this passively to the orchestration API.
 	The host service does *not* perform services such as garbage collection of unmounted
 	volumes (how is it to know whether you still want that data preserved for a future job?)
-	or transport and persistence of volumes between hosts (that should be orchestrated via
-	the API from a higher level service).
+	or decide when volumes should move between hosts (that should be orchestrated via
+	the API from a higher level service).  It does provide the means: a volume can be sent
+	as a stream by its provider, and received into a provider of the same kind on another
+	host (see `flynn-host volume migrate`).
 */
 type Volume interface {
 	Info() *Info
@@ -23,7 +25,15 @@ type Volume interface {
 	// Inform the volume that it is being mounted.  (The returned information is used by the host backend to create the mount.)
 	Mount(jobId, path string) (string, error)
 
+	// Inform the volume that a mount made by `Mount` has been removed.
+	Unmount(jobId, path string)
+
+	// TakeSnapshot creates a new volume with the current contents of this one.
+	// The snapshot's `Info.ParentID` is the ID of this volume, and it has the same size limit.
 	TakeSnapshot() (Volume, error)
+
+	// Usage returns the number of bytes used by the volume, and the number still available to it.
+	Usage() (used int64, available int64, err error)
 }
 
 /*
@@ -35,6 +45,24 @@ type Info struct {
 	// These are guid formatted (v4, random); selected by the server;
 	// and though not globally sync'd, entropy should be high enough to be unique.
 	ID string `json:"id"`
+
+	// ParentID is the ID of the volume this volume is a snapshot of, and is
+	// empty for volumes which are not snapshots.
+	ParentID string `json:"parent_id,omitempty"`
+
+	// Size is the maximum number of bytes the volume may hold, enforced by
+	// its provider, or zero if it is only limited by the provider's storage.
+	Size int64 `json:"size,omitempty"`
+
+	// Used and Available are the number of bytes used by the volume and
+	// still available to it.  They are filled in by the API when a volume is
+	// inspected, and are not otherwise kept up to date.
+	Used      int64 `json:"used,omitempty"`
+	Available int64 `json:"available,omitempty"`
+
+	// Mounts are the places the volume is mounted into jobs, filled in by
+	// the API like Used and Available.
+	Mounts []VolumeMount `json:"mounts,omitempty"`
 }
 
 /*
@@ -44,6 +72,6 @@ type Info struct {
 	may be mounted to many containers (or even multiple places within a single container).
 */
 type VolumeMount struct {
-	JobID    string // job which the volume is mounted to
-	Location string // path within the container where the mount shall appear
+	JobID    string `json:"job_id"`   // job which the volume is mounted to
+	Location string `json:"location"` // path within the container where the mount shall appear
 }
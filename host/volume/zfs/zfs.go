@@ -1,11 +1,14 @@
 package zfs
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -113,22 +116,147 @@ func NewProvider(config *ProviderConfig) (volume.Provider, error) {
 	}, nil
 }
 
-func (b Provider) NewVolume() (volume.Volume, error) {
+func (b Provider) NewVolume(size int64) (volume.Volume, error) {
 	id := random.UUID()
 	v := &zfsVolume{
-		info:      &volume.Info{ID: id},
+		info:      &volume.Info{ID: id, Size: size},
 		mounts:    make(map[volume.VolumeMount]struct{}),
 		poolName:  b.config.DatasetName,
 		basemount: filepath.Join("/var/lib/flynn/volumes/zfs/mnt/", id),
 	}
-	if _, err := zfs.CreateFilesystem(path.Join(v.poolName, id), map[string]string{
-		"mountpoint": v.basemount,
-	}); err != nil {
+	if _, err := zfs.CreateFilesystem(path.Join(v.poolName, id), datasetProperties(v.basemount, size)); err != nil {
 		return nil, err
 	}
 	return v, nil
 }
 
+/*
+	Returns the properties for a volume's dataset.  The size limit is enforced
+	with `refquota` rather than `quota`, so that the snapshots taken to send
+	a volume don't count against it.
+*/
+func datasetProperties(mountPath string, size int64) map[string]string {
+	properties := map[string]string{
+		"mountpoint": mountPath,
+	}
+	if size > 0 {
+		properties["refquota"] = strconv.FormatInt(size, 10)
+	}
+	return properties
+}
+
+func (b Provider) DestroyVolume(vol volume.Volume) error {
+	v, ok := vol.(*zfsVolume)
+	if !ok {
+		return fmt.Errorf("zfs: cannot destroy volume %s from another provider", vol.Info().ID)
+	}
+	dataset, err := zfs.GetDataset(path.Join(v.poolName, v.info.ID))
+	if err != nil {
+		return eunwrap(err)
+	}
+	if err := dataset.Destroy(zfs.DestroyDefault); err != nil {
+		return eunwrap(err)
+	}
+	return os.RemoveAll(v.basemount)
+}
+
+// zfsVolumeState is the persisted state of a zfs volume.
+type zfsVolumeState struct {
+	PoolName  string `json:"pool"`
+	BaseMount string `json:"mount"`
+}
+
+func (b Provider) MarshalVolumeState(vol volume.Volume) (json.RawMessage, error) {
+	v, ok := vol.(*zfsVolume)
+	if !ok {
+		return nil, fmt.Errorf("zfs: cannot marshal volume %s from another provider", vol.Info().ID)
+	}
+	return json.Marshal(&zfsVolumeState{PoolName: v.poolName, BaseMount: v.basemount})
+}
+
+func (b Provider) RestoreVolumeState(info *volume.Info, data json.RawMessage) (volume.Volume, error) {
+	state := &zfsVolumeState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return &zfsVolume{
+		info:      info,
+		mounts:    make(map[volume.VolumeMount]struct{}),
+		poolName:  state.PoolName,
+		basemount: state.BaseMount,
+	}, nil
+}
+
+func (b Provider) Kind() string {
+	return "zfs"
+}
+
+/*
+	Sends a zfs stream (as from `zfs send`) of a temporary snapshot of the volume.
+*/
+func (b Provider) SendSnapshot(vol volume.Volume, output io.Writer) error {
+	v, ok := vol.(*zfsVolume)
+	if !ok {
+		return fmt.Errorf("zfs: cannot send volume %s from another provider", vol.Info().ID)
+	}
+	dataset, err := zfs.GetDataset(path.Join(v.poolName, v.info.ID))
+	if err != nil {
+		return eunwrap(err)
+	}
+	snapshot, err := dataset.Snapshot(fmt.Sprintf("send-%d", time.Now().UnixNano()), false)
+	if err != nil {
+		return eunwrap(err)
+	}
+	defer snapshot.Destroy(zfs.DestroyDeferDeletion)
+	return eunwrap(snapshot.SendSnapshot(output))
+}
+
+/*
+	Receives a zfs stream written by `SendSnapshot` into a new dataset, with a
+	refquota of size bytes if size is not zero.
+*/
+func (b Provider) ReceiveSnapshot(input io.Reader, size int64) (volume.Volume, error) {
+	id := random.UUID()
+	v := &zfsVolume{
+		info:      &volume.Info{ID: id, Size: size},
+		mounts:    make(map[volume.VolumeMount]struct{}),
+		poolName:  b.config.DatasetName,
+		basemount: filepath.Join("/var/lib/flynn/volumes/zfs/mnt/", id),
+	}
+	dataset, err := zfs.ReceiveSnapshot(input, path.Join(v.poolName, id))
+	if err != nil {
+		return nil, eunwrap(err)
+	}
+	if err := receivedDataset(dataset, v.basemount, size); err != nil {
+		dataset.Destroy(zfs.DestroyRecursive)
+		return nil, err
+	}
+	return v, nil
+}
+
+/*
+	Mounts a dataset created by `zfs receive` and applies the size limit, then
+	destroys the snapshot it was received with so that the dataset can later
+	be destroyed on its own.
+*/
+func receivedDataset(dataset *zfs.Dataset, mountPath string, size int64) error {
+	for name, value := range datasetProperties(mountPath, size) {
+		if err := dataset.SetProperty(name, value); err != nil {
+			return eunwrap(err)
+		}
+	}
+	snapshots, err := dataset.Snapshots()
+	if err != nil {
+		return eunwrap(err)
+	}
+	for _, snapshot := range snapshots {
+		if err := snapshot.Destroy(zfs.DestroyDefault); err != nil {
+			return eunwrap(err)
+		}
+	}
+	return nil
+}
+
 func (v *zfsVolume) Info() *volume.Info {
 	return v.info
 }
@@ -149,21 +277,33 @@ func (v *zfsVolume) Mount(jobId, path string) (string, error) {
 	return v.basemount, nil
 }
 
+func (v *zfsVolume) Unmount(jobId, path string) {
+	delete(v.mounts, volume.VolumeMount{JobID: jobId, Location: path})
+}
+
+func (v *zfsVolume) Usage() (int64, int64, error) {
+	dataset, err := zfs.GetDataset(path.Join(v.poolName, v.info.ID))
+	if err != nil {
+		return 0, 0, eunwrap(err)
+	}
+	return int64(dataset.Used), int64(dataset.Avail), nil
+}
+
 func (v1 *zfsVolume) TakeSnapshot() (volume.Volume, error) {
 	id := random.UUID()
 	v2 := &zfsVolume{
-		info:      &volume.Info{ID: id},
+		info:      &volume.Info{ID: id, ParentID: v1.info.ID, Size: v1.info.Size},
 		mounts:    make(map[volume.VolumeMount]struct{}),
 		poolName:  v1.poolName,
 		basemount: filepath.Join("/var/lib/flynn/volumes/zfs/", id),
 	}
-	if err := cloneFilesystem(path.Join(v2.poolName, v2.info.ID), path.Join(v1.poolName, v1.info.ID), v2.basemount); err != nil {
+	if err := cloneFilesystem(path.Join(v2.poolName, v2.info.ID), path.Join(v1.poolName, v1.info.ID), datasetProperties(v2.basemount, v2.info.Size)); err != nil {
 		return nil, err
 	}
 	return v2, nil
 }
 
-func cloneFilesystem(newDatasetName string, parentDatasetName string, mountPath string) error {
+func cloneFilesystem(newDatasetName string, parentDatasetName string, properties map[string]string) error {
 	parentDataset, err := zfs.GetDataset(parentDatasetName)
 	if parentDataset == nil {
 		return err
@@ -174,9 +314,7 @@ func cloneFilesystem(newDatasetName string, parentDatasetName string, mountPath
 		return err
 	}
 
-	_, err = snapshot.Clone(newDatasetName, map[string]string{
-		"mountpoint": mountPath,
-	})
+	_, err = snapshot.Clone(newDatasetName, properties)
 	if err != nil {
 		snapshot.Destroy(zfs.DestroyDeferDeletion)
 		return err
@@ -1,6 +1,7 @@
 package zfs
 
 import (
+	"bytes"
 	"io/ioutil"
 	"math"
 	"os"
@@ -58,7 +59,7 @@ func (ZfsSnapshotTests) TestSnapshotShouldCarryFiles(c *C) {
 	provider, err := NewProvider(&ProviderConfig{DatasetName: "testpool"})
 	c.Assert(err, IsNil)
 
-	v, err := provider.NewVolume()
+	v, err := provider.NewVolume(0)
 	c.Assert(err, IsNil)
 
 	// a new volume should start out empty:
@@ -84,7 +85,7 @@ func (ZfsSnapshotTests) TestSnapshotShouldIsolateNewChangesToSource(c *C) {
 	provider, err := NewProvider(&ProviderConfig{DatasetName: "testpool"})
 	c.Assert(err, IsNil)
 
-	v, err := provider.NewVolume()
+	v, err := provider.NewVolume(0)
 	c.Assert(err, IsNil)
 
 	// a new volume should start out empty:
@@ -115,7 +116,7 @@ func (ZfsSnapshotTests) TestSnapshotShouldIsolateNewChangesToFork(c *C) {
 	provider, err := NewProvider(&ProviderConfig{DatasetName: "testpool"})
 	c.Assert(err, IsNil)
 
-	v, err := provider.NewVolume()
+	v, err := provider.NewVolume(0)
 	c.Assert(err, IsNil)
 
 	// a new volume should start out empty:
@@ -141,3 +142,54 @@ func (ZfsSnapshotTests) TestSnapshotShouldIsolateNewChangesToFork(c *C) {
 	// the snapshot should contain our changes:
 	c.Assert(v2.(*zfsVolume).basemount, testutils.DirContains, []string{"alpha", "beta"})
 }
+
+func (ZfsSnapshotTests) TestSendReceiveShouldCarryFiles(c *C) {
+	provider, err := NewProvider(&ProviderConfig{DatasetName: "testpool"})
+	c.Assert(err, IsNil)
+
+	v, err := provider.NewVolume(0)
+	c.Assert(err, IsNil)
+
+	f, err := os.Create(filepath.Join(v.(*zfsVolume).basemount, "alpha"))
+	c.Assert(err, IsNil)
+	f.Close()
+
+	var stream bytes.Buffer
+	c.Assert(provider.SendSnapshot(v, &stream), IsNil)
+
+	v2, err := provider.ReceiveSnapshot(&stream, 0)
+	c.Assert(err, IsNil)
+	c.Assert(v2.Info().ID, Not(Equals), v.Info().ID)
+
+	// the received volume should have the same content:
+	c.Assert(v2.(*zfsVolume).basemount, testutils.DirContains, []string{"alpha"})
+
+	// and be independent of the source, with no leftover snapshots:
+	c.Assert(provider.DestroyVolume(v2), IsNil)
+	c.Assert(provider.DestroyVolume(v), IsNil)
+}
+
+func (ZfsSnapshotTests) TestSizeLimit(c *C) {
+	provider, err := NewProvider(&ProviderConfig{DatasetName: "testpool"})
+	c.Assert(err, IsNil)
+
+	size := int64(4 * 1024 * 1024)
+	v, err := provider.NewVolume(size)
+	c.Assert(err, IsNil)
+	c.Assert(v.Info().Size, Equals, size)
+	_, available, err := v.Usage()
+	c.Assert(err, IsNil)
+	c.Assert(available <= size, Equals, true)
+
+	// writing more than the limit should fail:
+	err = ioutil.WriteFile(filepath.Join(v.(*zfsVolume).basemount, "alpha"), make([]byte, 2*size), 0644)
+	c.Assert(err, NotNil)
+
+	// snapshots should have the same limit:
+	v2, err := v.TakeSnapshot()
+	c.Assert(err, IsNil)
+	c.Assert(v2.Info().Size, Equals, size)
+	_, available, err = v2.Usage()
+	c.Assert(err, IsNil)
+	c.Assert(available <= size, Equals, true)
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/host/volume"
@@ -30,13 +33,52 @@ type Host interface {
 	// job ID.
 	StreamEvents(id string, ch chan<- *host.Event) (stream.Stream, error)
 
+	// GetJobStats returns a sample of a running job's resource usage.
+	GetJobStats(id string) (*host.JobStats, error)
+
+	// StreamJobStats sends samples of a running job's resource usage to ch
+	// every interval until the job stops.
+	StreamJobStats(id string, interval time.Duration, ch chan<- *host.JobStats) (stream.Stream, error)
+
+	// StreamJobLog sends the entries in a job's log which were written at or
+	// after since to ch, followed by new entries until the job exits if
+	// follow is set.
+	StreamJobLog(id string, since time.Time, follow bool, ch chan<- *host.LogEntry) (stream.Stream, error)
+
 	// Attach attaches to a job, optionally waiting for it to start before
 	// attaching.
 	Attach(req *host.AttachReq, wait bool) (AttachClient, error)
 
-	// Creates a new volume, returning its ID.
+	// Exec runs a command with a TTY in a running job's container, returning
+	// an attach client connected to it.
+	Exec(req *host.ExecReq) (AttachClient, error)
+
+	// Creates a new volume which may hold at most size bytes (or is
+	// unlimited if size is zero), returning its ID.
 	// When in doubt, use a providerId of "default".
-	CreateVolume(providerId string) (*volume.Info, error)
+	CreateVolume(providerId string, size int64) (*volume.Info, error)
+
+	// ListVolumes lists the volumes on the host, along with their usage.
+	ListVolumes() ([]*volume.Info, error)
+
+	// DestroyVolume destroys a volume which is not mounted and has no
+	// snapshots.
+	DestroyVolume(volumeID string) error
+
+	// CreateSnapshot takes a snapshot of a volume, returning the snapshot.
+	CreateSnapshot(volumeID string) (*volume.Info, error)
+
+	// ListSnapshots lists the snapshots taken of a volume.
+	ListSnapshots(volumeID string) ([]*volume.Info, error)
+
+	// SendVolume streams the contents of a volume, returning the stream and
+	// a description of it to pass to ReceiveVolume.
+	SendVolume(volumeID string) (io.ReadCloser, *volume.StreamInfo, error)
+
+	// ReceiveVolume creates a new volume using the given provider from a
+	// stream returned by SendVolume, with the same size limit as the volume
+	// which was sent.
+	ReceiveVolume(providerID string, info *volume.StreamInfo, input io.Reader) (*volume.Info, error)
 
 	// PullImages pulls images from a TUF repository using the local TUF file in tufDB
 	PullImages(repository, driver, root string, tufDB io.Reader, ch chan<- *layer.PullInfo) (stream.Stream, error)
@@ -91,9 +133,78 @@ func (c *hostClient) StreamEvents(id string, ch chan<- *host.Event) (stream.Stre
 	return c.c.Stream("GET", r, nil, ch)
 }
 
-func (c *hostClient) CreateVolume(providerId string) (*volume.Info, error) {
+func (c *hostClient) GetJobStats(id string) (*host.JobStats, error) {
+	var res host.JobStats
+	err := c.c.Get(fmt.Sprintf("/host/jobs/%s/stats", id), &res)
+	return &res, err
+}
+
+func (c *hostClient) StreamJobStats(id string, interval time.Duration, ch chan<- *host.JobStats) (stream.Stream, error) {
+	return c.c.Stream("GET", fmt.Sprintf("/host/jobs/%s/stats?interval=%s", id, interval), nil, ch)
+}
+
+func (c *hostClient) StreamJobLog(id string, since time.Time, follow bool, ch chan<- *host.LogEntry) (stream.Stream, error) {
+	q := make(url.Values)
+	if !since.IsZero() {
+		q.Set("since", since.Format(time.RFC3339Nano))
+	}
+	if follow {
+		q.Set("follow", "true")
+	}
+	return c.c.Stream("GET", fmt.Sprintf("/host/jobs/%s/log?%s", id, q.Encode()), nil, ch)
+}
+
+func (c *hostClient) CreateVolume(providerId string, size int64) (*volume.Info, error) {
+	var res volume.Info
+	err := c.c.Post(fmt.Sprintf("/storage/providers/%s/volumes", providerId), &volume.Info{Size: size}, &res)
+	return &res, err
+}
+
+func (c *hostClient) ListVolumes() ([]*volume.Info, error) {
+	var res []*volume.Info
+	err := c.c.Get("/storage/volumes", &res)
+	return res, err
+}
+
+func (c *hostClient) DestroyVolume(volumeID string) error {
+	return c.c.Delete(fmt.Sprintf("/storage/volumes/%s", volumeID))
+}
+
+func (c *hostClient) CreateSnapshot(volumeID string) (*volume.Info, error) {
+	var res volume.Info
+	err := c.c.Put(fmt.Sprintf("/storage/volumes/%s/snapshot", volumeID), nil, &res)
+	return &res, err
+}
+
+func (c *hostClient) ListSnapshots(volumeID string) ([]*volume.Info, error) {
+	var res []*volume.Info
+	err := c.c.Get(fmt.Sprintf("/storage/volumes/%s/snapshots", volumeID), &res)
+	return res, err
+}
+
+func (c *hostClient) SendVolume(volumeID string) (io.ReadCloser, *volume.StreamInfo, error) {
+	res, err := c.c.RawReq("GET", fmt.Sprintf("/storage/volumes/%s/send", volumeID), nil, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &volume.StreamInfo{Kind: res.Header.Get(volume.KindHeader)}
+	if s := res.Header.Get(volume.SizeHeader); s != "" {
+		if info.Size, err = strconv.ParseInt(s, 10, 64); err != nil {
+			res.Body.Close()
+			return nil, nil, err
+		}
+	}
+	return res.Body, info, nil
+}
+
+func (c *hostClient) ReceiveVolume(providerID string, info *volume.StreamInfo, input io.Reader) (*volume.Info, error) {
+	header := http.Header{
+		"Content-Type":    {"application/octet-stream"},
+		volume.KindHeader: {info.Kind},
+		volume.SizeHeader: {strconv.FormatInt(info.Size, 10)},
+	}
 	var res volume.Info
-	err := c.c.Post(fmt.Sprintf("/storage/providers/%s/volumes", providerId), nil, &res)
+	_, err := c.c.RawReq("POST", fmt.Sprintf("/storage/providers/%s/volumes/receive", providerID), header, input, &res)
 	return &res, err
 }
 
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 )
 
 type Resource struct {
@@ -28,3 +29,31 @@ func Provision(uri string, config []byte) (*Resource, error) {
 	}
 	return resource, nil
 }
+
+// Deprovision deletes the resource with the given ID using the provider at
+// uri, which is the same URI that was used to provision the resource. The
+// provider is sent a DELETE request with the resource ID in the id query
+// parameter.
+func Deprovision(uri, id string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("id", id)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("resource: unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
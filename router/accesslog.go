@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/gopkg.in/inconshreveable/log15.v2"
+)
+
+var logger = log15.New("app", "router")
+
+// accessLogWriter wraps an http.ResponseWriter to record the response status,
+// the number of body bytes written and the backend which served the request.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status  int
+	bytes   int64
+	backend string
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogWriter) SetBackend(addr string) {
+	w.backend = addr
+}
+
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *accessLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("router: response does not implement http.Hijacker")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// accessLogConn wraps a proxied net.Conn to record the number of bytes read
+// and written and the backend the connection was proxied to.
+type accessLogConn struct {
+	net.Conn
+	bytesIn  int64 // accessed atomically
+	bytesOut int64 // accessed atomically
+	backend  string
+}
+
+func (c *accessLogConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.bytesIn, int64(n))
+	return n, err
+}
+
+func (c *accessLogConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.bytesOut, int64(n))
+	return n, err
+}
+
+func (c *accessLogConn) SetBackend(addr string) {
+	c.backend = addr
+}
+
+func (c *accessLogConn) CloseNotify() <-chan bool {
+	return c.Conn.(http.CloseNotifier).CloseNotify()
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/coreos/go-etcd/etcd"
+	"github.com/flynn/flynn/router/acme"
+	"github.com/flynn/flynn/router/types"
+)
+
+// acmeManager obtains and renews certificates for the domains of HTTP routes
+// with ACME enabled. Certificates are written to the routes in the data store
+// so that every router instance loads them like any other route certificate,
+// and the account key, pending challenges and issuance locks are stored in
+// etcd so that any instance can answer a challenge.
+type acmeManager struct {
+	client acmeClient
+	email  string
+	etcd   EtcdClient
+	prefix string
+	ds     DataStore
+
+	regMtx     sync.Mutex
+	registered bool
+
+	// saved holds the certificates the manager has written to routes, by
+	// route ID, so that the writes don't trigger issuance again
+	savedMtx sync.Mutex
+	saved    map[string]string
+
+	// issued is notified with the domain after a certificate is saved and
+	// the issuance lock released, it is set in tests
+	issued chan<- string
+
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// now is overridden in tests
+	now func() time.Time
+}
+
+// acmeClient registers an ACME account and obtains certificates with it, it
+// is implemented by acmeAccount and replaced in tests.
+type acmeClient interface {
+	Register(key *ecdsa.PrivateKey, email string) error
+	ObtainCertificate(domain string, solver acme.ChallengeSolver) (certPEM, keyPEM []byte, err error)
+}
+
+// acmeAccount is an acmeClient using an acme.Client.
+type acmeAccount struct {
+	*acme.Client
+}
+
+// Register sets the client's account key and registers it.
+func (a acmeAccount) Register(key *ecdsa.PrivateKey, email string) error {
+	a.Key = key
+	return a.Client.Register(email)
+}
+
+const (
+	// certificates are renewed once less than 1/acmeRenewFraction of their
+	// lifetime remains, and at most acmeMaxRenewBefore before expiry
+	acmeRenewFraction  = 3
+	acmeMaxRenewBefore = 30 * 24 * time.Hour
+	acmeCheckInterval  = time.Hour
+
+	// acmeLockTTL is the TTL in seconds of the lock held while issuing a
+	// certificate and of pending challenge responses.
+	acmeLockTTL = 600
+)
+
+func newACMEManager(client acmeClient, email string, etcd EtcdClient, prefix string) *acmeManager {
+	return &acmeManager{
+		client: client,
+		email:  email,
+		etcd:   etcd,
+		prefix: prefix,
+		saved:  make(map[string]string),
+		stop:   make(chan struct{}),
+		now:    time.Now,
+	}
+}
+
+// Start starts periodically renewing the certificates of the ACME routes in
+// the data store.
+func (m *acmeManager) Start() {
+	go func() {
+		ticker := time.NewTicker(acmeCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.RenewAll()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (m *acmeManager) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// RenewAll obtains certificates for the domains of all ACME routes which
+// have no certificate or one which is due for renewal.
+func (m *acmeManager) RenewAll() {
+	routes, err := m.ds.List()
+	if err != nil {
+		logger.Error("error listing routes for ACME renewal", "err", err)
+		return
+	}
+	domains := make(map[string]struct{})
+	for _, data := range routes {
+		if r := data.HTTPRoute(); r.ACME {
+			domains[strings.ToLower(r.Domain)] = struct{}{}
+		}
+	}
+	for domain := range domains {
+		m.MaybeIssue(domain)
+	}
+}
+
+// MaybeIssue obtains a certificate for domain if any of its ACME routes have
+// a certificate which is missing or due for renewal, and saves it to all of
+// them. The routes for a domain share a certificate, so a route added to a
+// domain which already has a valid one is given that rather than triggering
+// another issuance.
+func (m *acmeManager) MaybeIssue(domain string) {
+	domain = strings.ToLower(domain)
+	log := logger.New("fn", "acme", "domain", domain)
+
+	routes, err := m.domainRoutes(domain)
+	if err != nil {
+		log.Error("error listing routes", "err", err)
+		return
+	}
+	if !m.anyNeedsCert(routes) {
+		return
+	}
+
+	var saved bool
+	if m.issued != nil {
+		defer func() {
+			if saved {
+				m.issued <- domain
+			}
+		}()
+	}
+
+	// only one router instance should issue a certificate at a time, the
+	// others will load it when it is written to the data store
+	lock := path.Join(m.prefix, "locks", domain)
+	if _, err := m.etcd.Create(lock, "", acmeLockTTL); err != nil {
+		if e, ok := err.(*etcd.EtcdError); !ok || e.ErrorCode != 105 {
+			log.Error("error acquiring lock", "err", err)
+		}
+		return
+	}
+	defer m.etcd.Delete(lock, false)
+
+	// get the routes again now that the lock is held, in case a certificate
+	// was saved since they were checked
+	routes, err = m.domainRoutes(domain)
+	if err != nil {
+		log.Error("error listing routes", "err", err)
+		return
+	}
+	if !m.anyNeedsCert(routes) {
+		return
+	}
+
+	certPEM, keyPEM := m.currentCert(routes)
+	if certPEM == "" {
+		if err := m.register(); err != nil {
+			log.Error("error registering ACME account", "err", err)
+			return
+		}
+		log.Info("obtaining certificate")
+		cert, key, err := m.client.ObtainCertificate(domain, m)
+		if err != nil {
+			log.Error("error obtaining certificate", "err", err)
+			return
+		}
+		certPEM, keyPEM = string(cert), string(key)
+
+		// get the routes again in case they changed while the certificate
+		// was being issued
+		routes, err = m.domainRoutes(domain)
+		if err != nil {
+			log.Error("error listing routes", "err", err)
+			return
+		}
+	}
+
+	now := m.now()
+	for _, r := range routes {
+		if r.TLSCert == certPEM {
+			continue
+		}
+		r.TLSCert = certPEM
+		r.TLSKey = keyPEM
+		r.UpdatedAt = &now
+		m.savedMtx.Lock()
+		m.saved[r.ID] = r.TLSCert
+		m.savedMtx.Unlock()
+		if err := m.ds.Set(r.ToRoute()); err != nil {
+			log.Error("error saving certificate", "route", r.ID, "err", err)
+			m.savedMtx.Lock()
+			delete(m.saved, r.ID)
+			m.savedMtx.Unlock()
+			continue
+		}
+		saved = true
+		log.Info("saved certificate", "route", r.ID)
+	}
+}
+
+// domainRoutes returns the routes for domain which have ACME enabled.
+func (m *acmeManager) domainRoutes(domain string) ([]*router.HTTPRoute, error) {
+	routes, err := m.ds.List()
+	if err != nil {
+		return nil, err
+	}
+	var res []*router.HTTPRoute
+	for _, data := range routes {
+		if r := data.HTTPRoute(); r.ACME && strings.ToLower(r.Domain) == domain {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+func (m *acmeManager) anyNeedsCert(routes []*router.HTTPRoute) bool {
+	for _, r := range routes {
+		if m.needsCert(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// currentCert returns a certificate of one of routes which is not due for
+// renewal, if there is one.
+func (m *acmeManager) currentCert(routes []*router.HTTPRoute) (certPEM, keyPEM string) {
+	for _, r := range routes {
+		if !m.needsCert(r) {
+			return r.TLSCert, r.TLSKey
+		}
+	}
+	return "", ""
+}
+
+// IsOwnWrite returns true if r has the certificate which the manager last
+// wrote to the route, in which case issuance does not need to be checked.
+func (m *acmeManager) IsOwnWrite(r *router.HTTPRoute) bool {
+	m.savedMtx.Lock()
+	defer m.savedMtx.Unlock()
+	cert, ok := m.saved[r.ID]
+	if !ok || cert != r.TLSCert {
+		return false
+	}
+	delete(m.saved, r.ID)
+	return true
+}
+
+// needsCert returns true if r has no valid certificate for its domain which
+// expires after its renewal window.
+func (m *acmeManager) needsCert(r *router.HTTPRoute) bool {
+	if r.TLSCert == "" || r.TLSKey == "" {
+		return true
+	}
+	pair, err := tls.X509KeyPair([]byte(r.TLSCert), []byte(r.TLSKey))
+	if err != nil {
+		return true
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return true
+	}
+	if cert.VerifyHostname(r.Domain) != nil {
+		return true
+	}
+	return m.now().Add(renewBefore(cert)).After(cert.NotAfter)
+}
+
+// renewBefore returns how long before expiry cert should be renewed, derived
+// from its lifetime so that short-lived certificates are not due as soon as
+// they are issued.
+func renewBefore(cert *x509.Certificate) time.Duration {
+	d := cert.NotAfter.Sub(cert.NotBefore) / acmeRenewFraction
+	if d > acmeMaxRenewBefore {
+		d = acmeMaxRenewBefore
+	}
+	return d
+}
+
+// register loads or creates the account key and registers it with the ACME
+// server if that has not already been done.
+func (m *acmeManager) register() error {
+	m.regMtx.Lock()
+	defer m.regMtx.Unlock()
+	if m.registered {
+		return nil
+	}
+	key, err := m.accountKey()
+	if err != nil {
+		return err
+	}
+	if err := m.client.Register(key, m.email); err != nil {
+		return err
+	}
+	m.registered = true
+	return nil
+}
+
+var errInvalidACMEKey = errors.New("router: invalid ACME account key")
+
+// accountKey returns the account key stored in etcd, generating and storing
+// a new one if there is none.
+func (m *acmeManager) accountKey() (*ecdsa.PrivateKey, error) {
+	keyPath := path.Join(m.prefix, "account_key")
+	res, err := m.etcd.Get(keyPath, false, false)
+	if e, ok := err.(*etcd.EtcdError); ok && e.ErrorCode == 100 {
+		key, err := acme.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		_, err = m.etcd.Create(keyPath, string(data), 0)
+		if err == nil {
+			return key, nil
+		} else if e, ok := err.(*etcd.EtcdError); !ok || e.ErrorCode != 105 {
+			return nil, err
+		}
+		// another instance created a key first, use that one
+		res, err = m.etcd.Get(keyPath, false, false)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(res.Node.Value))
+	if block == nil {
+		return nil, errInvalidACMEKey
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func (m *acmeManager) challengePath(token string) string {
+	return path.Join(m.prefix, "challenges", path.Base(token))
+}
+
+// Present implements acme.ChallengeSolver.
+func (m *acmeManager) Present(token, keyAuth string) error {
+	_, err := m.etcd.Set(m.challengePath(token), keyAuth, acmeLockTTL)
+	return err
+}
+
+// CleanUp implements acme.ChallengeSolver.
+func (m *acmeManager) CleanUp(token string) error {
+	_, err := m.etcd.Delete(m.challengePath(token), false)
+	return err
+}
+
+// ServeChallenge responds to an HTTP-01 challenge request, returning false if
+// the request is not for a pending challenge.
+func (m *acmeManager) ServeChallenge(w http.ResponseWriter, req *http.Request) bool {
+	if !strings.HasPrefix(req.URL.Path, acme.ChallengePath) {
+		return false
+	}
+	token := strings.TrimPrefix(req.URL.Path, acme.ChallengePath)
+	if token == "" || strings.Contains(token, "/") {
+		return false
+	}
+	res, err := m.etcd.Get(m.challengePath(token), false, false)
+	if err != nil {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(res.Node.Value))
+	return true
+}
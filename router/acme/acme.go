@@ -0,0 +1,493 @@
+// Package acme implements the subset of the ACME protocol (RFC 8555) needed
+// to obtain certificates for a single domain using HTTP-01 challenges.
+package acme
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/pkg/attempt"
+)
+
+// ChallengePath is the path prefix that HTTP-01 challenges are requested at.
+const ChallengePath = "/.well-known/acme-challenge/"
+
+// Error is an ACME problem document returned by the server.
+type Error struct {
+	Status int    `json:"status"`
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("acme: %s (%d): %s", e.Type, e.Status, e.Detail)
+}
+
+const errBadNonce = "urn:ietf:params:acme:error:badNonce"
+
+// ChallengeSolver makes HTTP-01 challenge responses available to the ACME
+// server, so that a request for ChallengePath+token returns keyAuth.
+type ChallengeSolver interface {
+	Present(token, keyAuth string) error
+	CleanUp(token string) error
+}
+
+// Client is an ACME client. It is safe for concurrent use once registered.
+type Client struct {
+	// DirectoryURL is the URL of the ACME server's directory resource.
+	DirectoryURL string
+
+	// Key is the account key, it must be an ECDSA P-256 key.
+	Key *ecdsa.PrivateKey
+
+	// HTTPClient is used for requests to the ACME server, it defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	// PollStrategy controls how long to wait for authorizations and orders
+	// to be processed.
+	PollStrategy attempt.Strategy
+
+	mtx    sync.Mutex
+	dir    *directory
+	kid    string
+	nonces []string
+}
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Error          *Error   `json:"error"`
+}
+
+type authorization struct {
+	Status     string      `json:"status"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type challenge struct {
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+	Token  string `json:"token"`
+	Status string `json:"status"`
+	Error  *Error `json:"error"`
+}
+
+var defaultPollStrategy = attempt.Strategy{
+	Total: 2 * time.Minute,
+	Delay: time.Second,
+}
+
+// GenerateKey generates a new account or certificate key.
+func GenerateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// Register creates an account on the ACME server for the client's key,
+// agreeing to the terms of service, or looks up the existing account for the
+// key.
+func (c *Client) Register(email string) error {
+	if err := c.discover(); err != nil {
+		return err
+	}
+	req := map[string]interface{}{"termsOfServiceAgreed": true}
+	if email != "" {
+		req["contact"] = []string{"mailto:" + email}
+	}
+	res, err := c.post(c.dir.NewAccount, req, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	kid := res.Header.Get("Location")
+	if kid == "" {
+		return errors.New("acme: account response missing Location header")
+	}
+	c.mtx.Lock()
+	c.kid = kid
+	c.mtx.Unlock()
+	return nil
+}
+
+// ObtainCertificate orders a certificate for domain, solving the HTTP-01
+// challenges using solver, and returns the PEM encoded certificate chain and
+// private key.
+func (c *Client) ObtainCertificate(domain string, solver ChallengeSolver) (certPEM, keyPEM []byte, err error) {
+	c.mtx.Lock()
+	registered := c.kid != ""
+	c.mtx.Unlock()
+	if !registered {
+		return nil, nil, errors.New("acme: client is not registered")
+	}
+
+	o := &order{}
+	res, err := c.post(c.dir.NewOrder, map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": domain}},
+	}, o)
+	if err != nil {
+		return nil, nil, err
+	}
+	orderURL := res.Header.Get("Location")
+
+	for _, authzURL := range o.Authorizations {
+		if err := c.authorize(authzURL, solver); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	key, err := GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := c.post(o.Finalize, map[string]string{"csr": b64(csr)}, o); err != nil {
+		return nil, nil, err
+	}
+	if err := c.poll(orderURL, o, func() (bool, error) {
+		switch o.Status {
+		case "valid":
+			return true, nil
+		case "invalid":
+			return false, orderError(o.Error)
+		}
+		return false, nil
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	res, err = c.post(o.Certificate, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM, err = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	return certPEM, keyPEM, nil
+}
+
+func orderError(e *Error) error {
+	if e != nil {
+		return e
+	}
+	return errors.New("acme: order is invalid")
+}
+
+// authorize completes the HTTP-01 challenge for the authorization at url.
+func (c *Client) authorize(url string, solver ChallengeSolver) error {
+	authz := &authorization{}
+	if _, err := c.post(url, nil, authz); err != nil {
+		return err
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+
+	var chal *challenge
+	for i, ch := range authz.Challenges {
+		if ch.Type == "http-01" {
+			chal = &authz.Challenges[i]
+			break
+		}
+	}
+	if chal == nil {
+		return errors.New("acme: server did not offer an http-01 challenge")
+	}
+
+	keyAuth, err := c.keyAuthorization(chal.Token)
+	if err != nil {
+		return err
+	}
+	if err := solver.Present(chal.Token, keyAuth); err != nil {
+		return err
+	}
+	defer solver.CleanUp(chal.Token)
+
+	res, err := c.post(chal.URL, struct{}{}, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return c.poll(url, authz, func() (bool, error) {
+		switch authz.Status {
+		case "valid":
+			return true, nil
+		case "pending", "processing":
+			return false, nil
+		}
+		for _, ch := range authz.Challenges {
+			if ch.Error != nil {
+				return false, ch.Error
+			}
+		}
+		return false, fmt.Errorf("acme: authorization is %s", authz.Status)
+	})
+}
+
+// poll fetches url into v until done returns true or an error.
+func (c *Client) poll(url string, v interface{}, done func() (bool, error)) error {
+	strategy := c.PollStrategy
+	if strategy.Total == 0 {
+		strategy = defaultPollStrategy
+	}
+	for a := strategy.Start(); a.Next(); {
+		ok, err := done()
+		if err != nil || ok {
+			return err
+		}
+		if _, err := c.post(url, nil, v); err != nil {
+			return err
+		}
+	}
+	if ok, err := done(); err != nil || ok {
+		return err
+	}
+	return fmt.Errorf("acme: timed out waiting for %s", url)
+}
+
+func (c *Client) keyAuthorization(token string) (string, error) {
+	thumbprint, err := jwkThumbprint(&c.Key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return token + "." + thumbprint, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) discover() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.dir != nil {
+		return nil
+	}
+	res, err := c.httpClient().Get(c.DirectoryURL)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return responseError(res)
+	}
+	dir := &directory{}
+	if err := json.NewDecoder(res.Body).Decode(dir); err != nil {
+		return err
+	}
+	c.dir = dir
+	return nil
+}
+
+func (c *Client) nonce() (string, error) {
+	c.mtx.Lock()
+	if n := len(c.nonces); n > 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		c.mtx.Unlock()
+		return nonce, nil
+	}
+	c.mtx.Unlock()
+
+	res, err := c.httpClient().Head(c.dir.NewNonce)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	nonce := res.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("acme: server did not return a nonce")
+	}
+	return nonce, nil
+}
+
+func (c *Client) saveNonce(res *http.Response) {
+	if nonce := res.Header.Get("Replay-Nonce"); nonce != "" {
+		c.mtx.Lock()
+		c.nonces = append(c.nonces, nonce)
+		c.mtx.Unlock()
+	}
+}
+
+// post sends a JWS signed request with payload to url, decoding a JSON
+// response into out if it is not nil. A nil payload sends a POST-as-GET
+// request. If out is nil the caller must close the response body.
+func (c *Client) post(url string, payload, out interface{}) (*http.Response, error) {
+	for retry := true; ; retry = false {
+		res, err := c.postOnce(url, payload)
+		if err != nil {
+			return nil, err
+		}
+		c.saveNonce(res)
+		if res.StatusCode >= 400 {
+			err := responseError(res)
+			res.Body.Close()
+			if e, ok := err.(*Error); ok && e.Type == errBadNonce && retry {
+				continue
+			}
+			return nil, err
+		}
+		if out != nil {
+			defer res.Body.Close()
+			if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+}
+
+func (c *Client) postOnce(url string, payload interface{}) (*http.Response, error) {
+	nonce, err := c.nonce()
+	if err != nil {
+		return nil, err
+	}
+	c.mtx.Lock()
+	kid := c.kid
+	c.mtx.Unlock()
+	body, err := signJWS(c.Key, kid, nonce, url, payload)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.httpClient().Post(url, "application/jose+json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func responseError(res *http.Response) error {
+	e := &Error{}
+	data, _ := ioutil.ReadAll(res.Body)
+	if err := json.Unmarshal(data, e); err != nil || e.Type == "" {
+		return fmt.Errorf("acme: unexpected response %s: %s", res.Status, data)
+	}
+	if e.Status == 0 {
+		e.Status = res.StatusCode
+	}
+	return e
+}
+
+type jwk struct {
+	Crv string `json:"crv"`
+	Kty string `json:"kty"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func newJWK(pub *ecdsa.PublicKey) *jwk {
+	return &jwk{
+		Crv: "P-256",
+		Kty: "EC",
+		X:   b64(padBytes(pub.X, 32)),
+		Y:   b64(padBytes(pub.Y, 32)),
+	}
+}
+
+// jwkThumbprint returns the RFC 7638 thumbprint of pub.
+func jwkThumbprint(pub *ecdsa.PublicKey) (string, error) {
+	// the fields of jwk are in lexicographic order as required
+	data, err := json.Marshal(newJWK(pub))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return b64(sum[:]), nil
+}
+
+// signJWS returns a flattened JSON JWS of payload, identifying the key by
+// kid if it is set and by the JWK otherwise.
+func signJWS(key *ecdsa.PrivateKey, kid, nonce, url string, payload interface{}) ([]byte, error) {
+	protected := map[string]interface{}{
+		"alg":   "ES256",
+		"nonce": nonce,
+		"url":   url,
+	}
+	if kid != "" {
+		protected["kid"] = kid
+	} else {
+		protected["jwk"] = newJWK(&key.PublicKey)
+	}
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	var encodedPayload string
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		encodedPayload = b64(data)
+	}
+
+	encodedHeader := b64(header)
+	digest := sha256.Sum256([]byte(encodedHeader + "." + encodedPayload))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := append(padBytes(r, 32), padBytes(s, 32)...)
+
+	return json.Marshal(map[string]string{
+		"protected": encodedHeader,
+		"payload":   encodedPayload,
+		"signature": b64(sig),
+	})
+}
+
+func padBytes(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+// b64 encodes data as unpadded base64url, as used throughout ACME and JWS.
+func b64(data []byte) string {
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(data), "=")
+}
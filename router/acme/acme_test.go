@@ -0,0 +1,124 @@
+package acme
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flynn/flynn/pkg/attempt"
+)
+
+// memorySolver serves HTTP-01 challenge responses from memory.
+type memorySolver struct {
+	mtx    sync.Mutex
+	tokens map[string]string
+}
+
+func (s *memorySolver) Present(token, keyAuth string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.tokens[token] = keyAuth
+	return nil
+}
+
+func (s *memorySolver) CleanUp(token string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.tokens, token)
+	return nil
+}
+
+func (s *memorySolver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mtx.Lock()
+	keyAuth, ok := s.tokens[strings.TrimPrefix(req.URL.Path, ChallengePath)]
+	s.mtx.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	w.Write([]byte(keyAuth))
+}
+
+func newClient(t *testing.T, srv *testServer) *Client {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{
+		DirectoryURL: srv.URL + "/directory",
+		Key:          key,
+		PollStrategy: attempt.Strategy{Total: 5 * time.Second, Delay: 10 * time.Millisecond},
+	}
+	if err := client.Register("admin@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestObtainCertificate(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	solver := &memorySolver{tokens: make(map[string]string)}
+	challenges := httptest.NewServer(solver)
+	defer challenges.Close()
+	srv.challengeAddr = challenges.Listener.Addr().String()
+
+	client := newClient(t, srv)
+	certPEM, keyPEM, err := client.ObtainCertificate("example.com", solver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(srv.ca.PEM))
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots}); err != nil {
+		t.Fatal(err)
+	}
+	if len(solver.tokens) != 0 {
+		t.Errorf("expected challenge tokens to be cleaned up, got %v", solver.tokens)
+	}
+}
+
+func TestObtainCertificateFailedChallenge(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	// serve 404s for every challenge
+	challenges := httptest.NewServer(http.NotFoundHandler())
+	defer challenges.Close()
+	srv.challengeAddr = challenges.Listener.Addr().String()
+
+	client := newClient(t, srv)
+	_, _, err := client.ObtainCertificate("example.com", &memorySolver{tokens: make(map[string]string)})
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %T: %v", err, err)
+	}
+	if e.Type != "urn:ietf:params:acme:error:unauthorized" {
+		t.Errorf("expected unauthorized error, got %q", e.Type)
+	}
+	if srv.issued != 0 {
+		t.Errorf("expected no certificates to be issued, got %d", srv.issued)
+	}
+}
+
+func TestObtainCertificateUnregistered(t *testing.T) {
+	client := &Client{DirectoryURL: "http://127.0.0.1:0/directory"}
+	if _, _, err := client.ObtainCertificate("example.com", nil); err == nil {
+		t.Fatal("expected an error for an unregistered client")
+	}
+}
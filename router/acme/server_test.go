@@ -0,0 +1,222 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flynn/flynn/pkg/certgen"
+	"github.com/flynn/flynn/pkg/random"
+)
+
+// testServer is a minimal ACME server for testing the client. It handles a
+// single order at a time, requesting its HTTP-01 challenge from
+// challengeAddr, and does not verify nonces or request signatures.
+type testServer struct {
+	*httptest.Server
+	ca            *certgen.Certificate
+	challengeAddr string
+
+	mtx        sync.Mutex
+	thumbprint string
+	domain     string
+	order      *order
+	authz      *authorization
+	cert       []byte
+	issued     int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	ca, err := certgen.Generate(certgen.Params{IsCA: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{ca: ca}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *testServer) serve(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Replay-Nonce", random.String(8))
+	switch req.URL.Path {
+	case "/directory":
+		writeJSON(w, &directory{
+			NewNonce:   s.URL + "/nonce",
+			NewAccount: s.URL + "/account",
+			NewOrder:   s.URL + "/order",
+		})
+		return
+	case "/nonce":
+		return
+	}
+
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	var header struct {
+		JWK *jwk `json:"jwk"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&jws); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	protected, _ := b64Decode(jws.Protected)
+	payload, _ := b64Decode(jws.Payload)
+	if err := json.Unmarshal(protected, &header); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	switch req.URL.Path {
+	case "/account":
+		data, _ := json.Marshal(header.JWK)
+		sum := sha256.Sum256(data)
+		s.thumbprint = b64(sum[:])
+		w.Header().Set("Location", s.URL+"/account/1")
+		w.WriteHeader(201)
+	case "/order":
+		var o struct {
+			Identifiers []struct {
+				Value string `json:"value"`
+			} `json:"identifiers"`
+		}
+		json.Unmarshal(payload, &o)
+		s.domain = o.Identifiers[0].Value
+		s.order = &order{
+			Status:         "pending",
+			Authorizations: []string{s.URL + "/authz"},
+			Finalize:       s.URL + "/finalize",
+		}
+		s.authz = &authorization{
+			Status: "pending",
+			Challenges: []challenge{{
+				Type:   "http-01",
+				URL:    s.URL + "/chal",
+				Token:  random.String(16),
+				Status: "pending",
+			}},
+		}
+		w.Header().Set("Location", s.URL+"/order/1")
+		writeJSON(w, s.order)
+	case "/order/1":
+		writeJSON(w, s.order)
+	case "/authz":
+		writeJSON(w, s.authz)
+	case "/chal":
+		s.validate()
+		writeJSON(w, &s.authz.Challenges[0])
+	case "/finalize":
+		if err := s.finalize(payload); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		writeJSON(w, s.order)
+	case "/cert":
+		w.Write(s.cert)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// validate requests the challenge response from challengeAddr, the caller
+// must hold s.mtx.
+func (s *testServer) validate() {
+	chal := &s.authz.Challenges[0]
+	err := func() error {
+		req, _ := http.NewRequest("GET", "http://"+s.challengeAddr+ChallengePath+chal.Token, nil)
+		req.Host = s.domain
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		if expected := chal.Token + "." + s.thumbprint; string(body) != expected {
+			return fmt.Errorf("expected key authorization %q, got %q", expected, body)
+		}
+		return nil
+	}()
+	if err != nil {
+		chal.Status = "invalid"
+		chal.Error = &Error{Status: 403, Type: "urn:ietf:params:acme:error:unauthorized", Detail: err.Error()}
+		s.authz.Status = "invalid"
+		s.order.Status = "invalid"
+		return
+	}
+	chal.Status = "valid"
+	s.authz.Status = "valid"
+	s.order.Status = "ready"
+}
+
+// finalize issues the certificate for the CSR in payload, the caller must
+// hold s.mtx.
+func (s *testServer) finalize(payload []byte) error {
+	if s.order.Status != "ready" {
+		return fmt.Errorf("order is %s", s.order.Status)
+	}
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	json.Unmarshal(payload, &req)
+	der, err := b64Decode(req.CSR)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return err
+	}
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != s.domain {
+		return fmt.Errorf("CSR is not for %s", s.domain)
+	}
+	ca, err := x509.ParseCertificate(s.ca.DER)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(int64(s.issued + 1)),
+		Subject:      pkix.Name{CommonName: s.domain},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, csr.PublicKey, s.ca.Key)
+	if err != nil {
+		return err
+	}
+	s.cert = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), s.ca.PEM...)
+	s.issued++
+	s.order.Status = "valid"
+	s.order.Certificate = s.URL + "/cert"
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// b64Decode decodes unpadded base64url data.
+func b64Decode(s string) ([]byte, error) {
+	if n := len(s) % 4; n != 0 {
+		s += strings.Repeat("=", 4-n)
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/pkg/attempt"
+	"github.com/flynn/flynn/pkg/certgen"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/flynn/flynn/router/acme"
+	"github.com/flynn/flynn/router/types"
+)
+
+// testACMEClient issues certificates signed by a test CA once the router
+// serves the HTTP-01 challenge response for the domain, in place of an ACME
+// server.
+type testACMEClient struct {
+	ca       *certgen.Certificate
+	addr     string
+	lifetime time.Duration
+
+	mtx    sync.Mutex
+	issued int
+}
+
+func newTestACMEClient(c *C) *testACMEClient {
+	ca, err := certgen.Generate(certgen.Params{IsCA: true})
+	c.Assert(err, IsNil)
+	return &testACMEClient{ca: ca, lifetime: 90 * 24 * time.Hour}
+}
+
+func (t *testACMEClient) Register(key *ecdsa.PrivateKey, email string) error {
+	return nil
+}
+
+func (t *testACMEClient) ObtainCertificate(domain string, solver acme.ChallengeSolver) ([]byte, []byte, error) {
+	token, keyAuth := random.String(16), random.String(16)
+	if err := solver.Present(token, keyAuth); err != nil {
+		return nil, nil, err
+	}
+	defer solver.CleanUp(token)
+	req, _ := http.NewRequest("GET", "http://"+t.addr+acme.ChallengePath+token, nil)
+	req.Host = domain
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != keyAuth {
+		return nil, nil, fmt.Errorf("expected key authorization %q, got %q", keyAuth, body)
+	}
+
+	key, err := acme.GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(t.ca.DER)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.issued++
+	cert, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(int64(t.issued)),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(t.lifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, &key.PublicKey, t.ca.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), t.ca.PEM...)
+	return certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// Issued returns the number of certificates which have been issued.
+func (t *testACMEClient) Issued() int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.issued
+}
+
+// newACMEListener starts a listener using client to issue certificates,
+// calling configure (if not nil) on the ACME manager before the listener
+// starts.
+func (s *S) newACMEListener(c *C, client *testACMEClient, configure func(*acmeManager)) *HTTPListener {
+	prefix := random.String(8)
+	l := &HTTPListener{
+		Addr:      "127.0.0.1:0",
+		TLSAddr:   "127.0.0.1:0",
+		ds:        NewEtcdDataStore(s.etcd, fmt.Sprintf("/router/http/%s/", prefix)),
+		discoverd: s.discoverd,
+		acme:      newACMEManager(client, "admin@example.com", s.etcd, fmt.Sprintf("/router/acme/%s", prefix)),
+	}
+	if configure != nil {
+		configure(l.acme)
+	}
+	if err := l.Start(); err != nil {
+		c.Fatal(err)
+	}
+	client.addr = l.Addr
+	return l
+}
+
+// waitForCert waits for the TLS certificate of the route for domain to be
+// replaced with one other than prev.
+func waitForCert(c *C, l *HTTPListener, domain string, prev *tls.Certificate) *tls.Certificate {
+	for a := (attempt.Strategy{Total: 10 * time.Second, Delay: 50 * time.Millisecond}).Start(); a.Next(); {
+		if routes := l.findRoutesForHost(domain); len(routes) > 0 {
+			l.mtx.RLock()
+			kp := routes[0].keypair
+			l.mtx.RUnlock()
+			if kp != nil && kp != prev {
+				return kp
+			}
+		}
+	}
+	c.Fatalf("timed out waiting for certificate for %s", domain)
+	return nil
+}
+
+func assertACMECert(c *C, l *HTTPListener, client *testACMEClient, domain string) *x509.Certificate {
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(client.ca.PEM))
+	conn, err := tls.Dial("tcp", l.TLSAddr, &tls.Config{ServerName: domain, RootCAs: roots})
+	c.Assert(err, IsNil)
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	c.Assert(certs, Not(HasLen), 0)
+	return certs[0]
+}
+
+func (s *S) TestACMECertificate(c *C) {
+	client := newTestACMEClient(c)
+
+	l := s.newACMEListener(c, client, nil)
+	defer l.Close()
+
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "acme.example.com",
+		Service: "test",
+		ACME:    true,
+	}).ToRoute())
+
+	waitForCert(c, l, "acme.example.com", nil)
+	cert := assertACMECert(c, l, client, "acme.example.com")
+	c.Assert(cert.DNSNames, DeepEquals, []string{"acme.example.com"})
+	c.Assert(client.Issued(), Equals, 1)
+
+	// the certificate is stored in the route
+	route, err := l.Get(md5sum("acme.example.com"))
+	c.Assert(err, IsNil)
+	c.Assert(route.HTTPRoute().TLSCert, Not(Equals), "")
+
+	// checking again does not issue another certificate
+	l.acme.RenewAll()
+	c.Assert(client.Issued(), Equals, 1)
+}
+
+// waitForIssue waits for the ACME manager to save a certificate for domain.
+func waitForIssue(c *C, issued <-chan string, domain string) {
+	select {
+	case issuedDomain := <-issued:
+		c.Assert(issuedDomain, Equals, domain)
+	case <-time.After(10 * time.Second):
+		c.Fatalf("timed out waiting for certificate to be issued for %s", domain)
+	}
+}
+
+func (s *S) TestACMERenewal(c *C) {
+	client := newTestACMEClient(c)
+
+	var clockMtx sync.Mutex
+	var offset time.Duration
+	issued := make(chan string, 1)
+	l := s.newACMEListener(c, client, func(m *acmeManager) {
+		m.issued = issued
+		m.now = func() time.Time {
+			clockMtx.Lock()
+			defer clockMtx.Unlock()
+			return time.Now().Add(offset)
+		}
+	})
+	defer l.Close()
+
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "renew.example.com",
+		Service: "test",
+		ACME:    true,
+	}).ToRoute())
+	waitForIssue(c, issued, "renew.example.com")
+	prev := waitForCert(c, l, "renew.example.com", nil)
+	first := assertACMECert(c, l, client, "renew.example.com")
+
+	// move forward to within the renewal window of the certificate
+	clockMtx.Lock()
+	offset = client.lifetime - client.lifetime/acmeRenewFraction + time.Hour
+	clockMtx.Unlock()
+	l.acme.RenewAll()
+	waitForIssue(c, issued, "renew.example.com")
+	c.Assert(client.Issued(), Equals, 2)
+
+	waitForCert(c, l, "renew.example.com", prev)
+	second := assertACMECert(c, l, client, "renew.example.com")
+	c.Assert(second.SerialNumber.Cmp(first.SerialNumber), Not(Equals), 0)
+}
+
+func (s *S) TestACMEShortLivedCertificate(c *C) {
+	client := newTestACMEClient(c)
+	client.lifetime = 7 * 24 * time.Hour
+
+	issued := make(chan string, 1)
+	l := s.newACMEListener(c, client, func(m *acmeManager) { m.issued = issued })
+	defer l.Close()
+
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "short.example.com",
+		Service: "test",
+		ACME:    true,
+	}).ToRoute())
+	waitForIssue(c, issued, "short.example.com")
+	waitForCert(c, l, "short.example.com", nil)
+
+	// a certificate with a lifetime shorter than the maximum renewal window
+	// is not due for renewal as soon as it is issued
+	l.acme.RenewAll()
+	c.Assert(client.Issued(), Equals, 1)
+}
+
+func (s *S) TestACMESharedDomain(c *C) {
+	client := newTestACMEClient(c)
+	var clockMtx sync.Mutex
+	var offset time.Duration
+	issued := make(chan string, 1)
+	l := s.newACMEListener(c, client, func(m *acmeManager) {
+		m.issued = issued
+		m.now = func() time.Time {
+			clockMtx.Lock()
+			defer clockMtx.Unlock()
+			return time.Now().Add(offset)
+		}
+	})
+	defer l.Close()
+
+	first := addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "shared.example.com",
+		Service: "test",
+		ACME:    true,
+	}).ToRoute())
+	waitForIssue(c, issued, "shared.example.com")
+
+	// a route added to the domain is given its certificate
+	second := addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "Shared.example.com",
+		Path:    "/api/",
+		Service: "test",
+		ACME:    true,
+	}).ToRoute())
+	waitForIssue(c, issued, "shared.example.com")
+	c.Assert(client.Issued(), Equals, 1)
+
+	firstRoute, err := l.Get(first.ID)
+	c.Assert(err, IsNil)
+	secondRoute, err := l.Get(second.ID)
+	c.Assert(err, IsNil)
+	c.Assert(secondRoute.HTTPRoute().TLSCert, Equals, firstRoute.HTTPRoute().TLSCert)
+
+	// and both are renewed with one certificate
+	clockMtx.Lock()
+	offset = client.lifetime
+	clockMtx.Unlock()
+	l.acme.RenewAll()
+	waitForIssue(c, issued, "shared.example.com")
+	c.Assert(client.Issued(), Equals, 2)
+	firstRoute, err = l.Get(first.ID)
+	c.Assert(err, IsNil)
+	secondRoute, err = l.Get(second.ID)
+	c.Assert(err, IsNil)
+	c.Assert(firstRoute.HTTPRoute().TLSCert, Not(Equals), "")
+	c.Assert(secondRoute.HTTPRoute().TLSCert, Equals, firstRoute.HTTPRoute().TLSCert)
+}
+
+func (s *S) TestACMEWildcardDomain(c *C) {
+	err := validateHTTPRoute(&router.HTTPRoute{Domain: "*.example.com", Service: "test", ACME: true})
+	c.Assert(err, Equals, errACMEWildcard)
+}
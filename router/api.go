@@ -12,6 +12,7 @@ import (
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/go-martini/martini"
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/martini-contrib/binding"
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/martini-contrib/render"
+	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/pkg/pprof"
 	"github.com/flynn/flynn/router/types"
 )
@@ -30,7 +31,10 @@ func apiHandler(rtr *Router) http.Handler {
 	r.Put("/routes", binding.Bind(router.Route{}), createOrReplaceRoute)
 	r.Get("/routes", getRoutes)
 	r.Get("/routes/:route_type/:route_id", getRoute)
+	r.Get("/routes/:route_type/:route_id/backends", getRouteBackends)
+	r.Get("/routes/:route_type/:route_id/stats", getRouteStats)
 	r.Delete("/routes/:route_type/:route_id", deleteRoute)
+	r.Get("/metrics", metricsHandler(rtr))
 	r.Any("/debug/**", pprof.Handler.ServeHTTP)
 	return m
 }
@@ -45,8 +49,16 @@ func createRoute(req *http.Request, route router.Route, router *Router, r render
 		r.JSON(400, "Invalid route type")
 		return
 	}
+	if err := validateRoute(&route); err != nil {
+		r.JSON(400, httphelper.JSONError{Code: httphelper.ValidationError, Message: err.Error()})
+		return
+	}
 
 	if err := l.AddRoute(&route); err != nil {
+		if err == ErrExists {
+			r.JSON(409, httphelper.JSONError{Code: httphelper.ObjectExistsError, Message: "a route already exists for this domain and path"})
+			return
+		}
 		log.Println(err)
 		r.JSON(500, "unknown error")
 		return
@@ -65,6 +77,10 @@ func createOrReplaceRoute(req *http.Request, route router.Route, router *Router,
 		r.JSON(400, "Invalid route type")
 		return
 	}
+	if err := validateRoute(&route); err != nil {
+		r.JSON(400, httphelper.JSONError{Code: httphelper.ValidationError, Message: err.Error()})
+		return
+	}
 
 	if err := l.SetRoute(&route); err != nil {
 		log.Println(err)
@@ -75,6 +91,16 @@ func createOrReplaceRoute(req *http.Request, route router.Route, router *Router,
 	r.JSON(200, res)
 }
 
+func validateRoute(r *router.Route) error {
+	switch r.Type {
+	case "http":
+		return validateHTTPRoute(r.HTTPRoute())
+	case "tcp":
+		return validateTCPRoute(r.TCPRoute())
+	}
+	return nil
+}
+
 func listenerFor(router *Router, typ string) Listener {
 	switch typ {
 	case "http":
@@ -159,6 +185,48 @@ func getRoute(params martini.Params, router *Router, r render.Render) {
 	r.JSON(200, formatRoute(route))
 }
 
+func getRouteBackends(params martini.Params, router *Router, r render.Render) {
+	l := listenerFor(router, params["route_type"])
+	if l == nil {
+		r.JSON(404, "not found")
+		return
+	}
+
+	backends, err := l.Backends(params["route_id"])
+	if err == ErrNotFound {
+		r.JSON(404, "not found")
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		r.JSON(500, "unknown error")
+		return
+	}
+
+	r.JSON(200, backends)
+}
+
+func getRouteStats(params martini.Params, router *Router, r render.Render) {
+	l := listenerFor(router, params["route_type"])
+	if l == nil {
+		r.JSON(404, "not found")
+		return
+	}
+
+	stats, err := l.Stats(params["route_id"])
+	if err == ErrNotFound {
+		r.JSON(404, "not found")
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		r.JSON(500, "unknown error")
+		return
+	}
+
+	r.JSON(200, stats)
+}
+
 func deleteRoute(params martini.Params, router *Router, r render.Render) {
 	l := listenerFor(router, params["route_type"])
 	if l == nil {
@@ -5,6 +5,7 @@ import (
 
 	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
 	"github.com/flynn/flynn/discoverd/testutil/etcdrunner"
+	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/router/client"
 	"github.com/flynn/flynn/router/types"
 )
@@ -101,6 +102,59 @@ func (s *S) TestAPIAddHTTPRoute(c *C) {
 	c.Assert(err, Equals, client.ErrNotFound)
 }
 
+func (s *S) TestAPIAddHTTPRouteWithPath(c *C) {
+	srv := s.newTestAPIServer(c)
+	defer srv.Close()
+
+	r0 := (&router.HTTPRoute{Domain: "example.com", Service: "web"}).ToRoute()
+	c.Assert(srv.CreateRoute(r0), IsNil)
+
+	r1 := (&router.HTTPRoute{Domain: "example.com", Path: "/api", Service: "api"}).ToRoute()
+	c.Assert(srv.CreateRoute(r1), IsNil)
+	c.Assert(r1.ID, Not(Equals), r0.ID)
+	c.Assert(r1.HTTPRoute().Path, Equals, "/api")
+
+	// a route for the same domain and path conflicts
+	r2 := (&router.HTTPRoute{Domain: "example.com", Path: "/api/", Service: "other"}).ToRoute()
+	err := srv.CreateRoute(r2)
+	c.Assert(err, NotNil)
+	c.Assert(err.(httphelper.JSONError).Code, Equals, httphelper.ObjectExistsError)
+
+	// paths must be absolute
+	r3 := (&router.HTTPRoute{Domain: "example.com", Path: "api", Service: "api"}).ToRoute()
+	err = srv.CreateRoute(r3)
+	c.Assert(err, NotNil)
+	c.Assert(err.(httphelper.JSONError).Code, Equals, httphelper.ValidationError)
+}
+
+func (s *S) TestAPIAddRouteWithLoadBalancer(c *C) {
+	srv := s.newTestAPIServer(c)
+	defer srv.Close()
+
+	r0 := (&router.HTTPRoute{Domain: "example.com", Service: "web", LoadBalancer: router.LoadBalancerRoundRobin}).ToRoute()
+	c.Assert(srv.CreateRoute(r0), IsNil)
+	c.Assert(r0.HTTPRoute().LoadBalancer, Equals, router.LoadBalancerRoundRobin)
+
+	assertInvalid := func(r *router.Route) {
+		err := srv.CreateRoute(r)
+		c.Assert(err, NotNil)
+		c.Assert(err.(httphelper.JSONError).Code, Equals, httphelper.ValidationError)
+	}
+
+	// unknown policies are rejected
+	assertInvalid((&router.HTTPRoute{Domain: "foo.example.com", Service: "web", LoadBalancer: "fastest"}).ToRoute())
+
+	// header-hash requires a header
+	assertInvalid((&router.HTTPRoute{Domain: "foo.example.com", Service: "web", LoadBalancer: router.LoadBalancerHeaderHash}).ToRoute())
+	r1 := (&router.HTTPRoute{Domain: "foo.example.com", Service: "web", LoadBalancer: router.LoadBalancerHeaderHash, HashHeader: "X-User-Id"}).ToRoute()
+	c.Assert(srv.CreateRoute(r1), IsNil)
+
+	// TCP routes have no headers to hash
+	assertInvalid((&router.TCPRoute{Service: "tcp", LoadBalancer: router.LoadBalancerHeaderHash}).ToRoute())
+	r2 := (&router.TCPRoute{Service: "tcp", LoadBalancer: router.LoadBalancerLeastRequests}).ToRoute()
+	c.Assert(srv.CreateRoute(r2), IsNil)
+}
+
 func (s *S) TestAPISetHTTPRoute(c *C) {
 	srv := s.newTestAPIServer(c)
 	defer srv.Close()
@@ -60,6 +60,12 @@ type Client interface {
 	// ListRoutes returns a list of routes. If parentRef is not empty, routes
 	// are filtered by the reference (ex: "controller/apps/myapp").
 	ListRoutes(parentRef string) ([]*router.Route, error)
+	// ListBackends returns the outlier detection state of the backends of
+	// the service for the route with the specified id.
+	ListBackends(id string) ([]*router.Backend, error)
+	// GetRouteStats returns the counters for the limits configured on the
+	// route with the specified id.
+	GetRouteStats(id string) (*router.RouteStats, error)
 }
 
 func (c *client) CreateRoute(r *router.Route) error {
@@ -91,3 +97,15 @@ func (c *client) ListRoutes(parentRef string) ([]*router.Route, error) {
 	err := c.Get(path, &res)
 	return res, err
 }
+
+func (c *client) ListBackends(id string) ([]*router.Backend, error) {
+	var res []*router.Backend
+	err := c.Get("/routes/"+id+"/backends", &res)
+	return res, err
+}
+
+func (c *client) GetRouteStats(id string) (*router.RouteStats, error) {
+	res := &router.RouteStats{}
+	err := c.Get("/routes/"+id+"/stats", res)
+	return res, err
+}
@@ -43,7 +43,7 @@ func (d *discoverdServiceCache) start(s discoverd.Service) (err error) {
 				d.Lock()
 				d.addrs[event.Instance.Addr] = struct{}{}
 				d.Unlock()
-			case discoverd.EventKindDown:
+			case discoverd.EventKindDown, discoverd.EventKindExpired:
 				d.Lock()
 				delete(d.addrs, event.Instance.Addr)
 				d.Unlock()
@@ -7,9 +7,11 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/kavu/go_reuseport"
@@ -30,7 +32,7 @@ type HTTPListener struct {
 	TLSAddr string
 
 	mtx      sync.RWMutex
-	domains  map[string]*httpRoute
+	domains  map[string][]*httpRoute // sorted by path, longest first
 	routes   map[string]*httpRoute
 	services map[string]*httpService
 
@@ -43,6 +45,8 @@ type HTTPListener struct {
 	closed      bool
 	cookieKey   *[32]byte
 	keypair     tls.Certificate
+	acme        *acmeManager
+	passthrough sniRouter
 }
 
 type DiscoverdClient interface {
@@ -58,6 +62,9 @@ func (s *HTTPListener) Close() error {
 	s.listener.Close()
 	s.tlsListener.Close()
 	s.ds.StopSync()
+	if s.acme != nil {
+		s.acme.Stop()
+	}
 	s.closed = true
 	return nil
 }
@@ -77,13 +84,17 @@ func (s *HTTPListener) Start() error {
 	s.DataStoreReader = s.ds
 
 	s.routes = make(map[string]*httpRoute)
-	s.domains = make(map[string]*httpRoute)
+	s.domains = make(map[string][]*httpRoute)
 	s.services = make(map[string]*httpService)
 
 	if s.cookieKey == nil {
 		s.cookieKey = &[32]byte{}
 	}
 
+	if s.acme != nil {
+		s.acme.ds = s.ds
+	}
+
 	started := make(chan error)
 
 	go s.ds.Sync(&httpSyncHandler{l: s}, started)
@@ -104,6 +115,10 @@ func (s *HTTPListener) Start() error {
 	}
 	s.TLSAddr = s.tlsListener.Addr().String()
 
+	if s.acme != nil {
+		s.acme.Start()
+	}
+
 	return nil
 }
 
@@ -115,7 +130,7 @@ func (s *HTTPListener) AddRoute(r *router.Route) error {
 	if s.closed {
 		return ErrClosed
 	}
-	r.ID = md5sum(r.HTTPRoute().Domain)
+	r.ID = httpRouteID(r.HTTPRoute())
 	return s.ds.Add(r)
 }
 
@@ -125,7 +140,7 @@ func (s *HTTPListener) SetRoute(r *router.Route) error {
 	if s.closed {
 		return ErrClosed
 	}
-	r.ID = md5sum(r.HTTPRoute().Domain)
+	r.ID = httpRouteID(r.HTTPRoute())
 	return s.ds.Set(r)
 }
 
@@ -134,6 +149,103 @@ func md5sum(data string) string {
 	return hex.EncodeToString(digest[:])
 }
 
+// httpRouteID returns the ID of an HTTP route, which is derived from its
+// domain and path so that there can only be one route for each combination.
+// Domains are case-insensitive so they are lowercased first, and routes for
+// the root path keep the domain-only ID.
+func httpRouteID(r *router.HTTPRoute) string {
+	domain := strings.ToLower(r.Domain)
+	path := normalizePath(r.Path)
+	if path == "/" {
+		return md5sum(domain)
+	}
+	return md5sum(domain + path)
+}
+
+// normalizePath returns a route path prefix with leading and trailing
+// slashes, so that "/api" matches "/api" and "/api/users" but not "/apiary".
+func normalizePath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return path
+}
+
+func matchPath(prefix, path string) bool {
+	return strings.HasPrefix(path+"/", prefix)
+}
+
+var errInvalidPath = errors.New("router: route path must begin with / and must not contain a query or fragment")
+var errInvalidLoadBalancer = errors.New("router: unknown load balancer")
+var errMissingHashHeader = errors.New("router: the header-hash load balancer requires a hash header")
+var errInvalidRateLimit = errors.New("router: rate limit rate must be positive and burst must not be negative")
+var errACMEWildcard = errors.New("router: ACME certificates cannot be obtained for wildcard domains")
+
+func validateHTTPRoute(r *router.HTTPRoute) error {
+	if r.Path != "" && (!strings.HasPrefix(r.Path, "/") || strings.ContainsAny(r.Path, "?#")) {
+		return errInvalidPath
+	}
+	switch r.LoadBalancer {
+	case "", router.LoadBalancerRandom, router.LoadBalancerRoundRobin, router.LoadBalancerLeastRequests:
+	case router.LoadBalancerHeaderHash:
+		if r.HashHeader == "" {
+			return errMissingHashHeader
+		}
+	default:
+		return errInvalidLoadBalancer
+	}
+	if l := r.RateLimit; l != nil && (l.Rate <= 0 || l.Burst < 0) {
+		return errInvalidRateLimit
+	}
+	if r.ACME && strings.HasPrefix(r.Domain, "*.") {
+		return errACMEWildcard
+	}
+	return nil
+}
+
+// Backends returns the outlier detection state of the backends of the
+// service for the route with the given id.
+func (s *HTTPListener) Backends(id string) ([]*router.Backend, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	r, ok := s.routes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.service.outliers.Status(r.service.sc.Addrs()), nil
+}
+
+// Metrics returns the metrics for each route.
+func (s *HTTPListener) Metrics() []*routeMetrics {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	metrics := make([]*routeMetrics, 0, len(s.routes))
+	for _, r := range s.routes {
+		metrics = append(metrics, r.metrics)
+	}
+	return metrics
+}
+
+// Stats returns the counters for the route with the given id.
+func (s *HTTPListener) Stats(id string) (*router.RouteStats, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	r, ok := s.routes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &router.RouteStats{RateLimited: atomic.LoadUint64(r.rateLimited)}, nil
+}
+
 func (s *HTTPListener) RemoveRoute(id string) error {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
@@ -149,7 +261,13 @@ type httpSyncHandler struct {
 
 func (h *httpSyncHandler) Set(data *router.Route) error {
 	route := data.HTTPRoute()
-	r := &httpRoute{HTTPRoute: route}
+	r := &httpRoute{
+		HTTPRoute: route,
+		path:      normalizePath(route.Path),
+	}
+	if r.RateLimit != nil {
+		r.limiter = newRateLimiter(r.RateLimit)
+	}
 
 	if r.TLSCert != "" && r.TLSKey != "" {
 		kp, err := tls.X509KeyPair([]byte(r.TLSCert), []byte(r.TLSKey))
@@ -167,6 +285,16 @@ func (h *httpSyncHandler) Set(data *router.Route) error {
 		return nil
 	}
 
+	// keep the counters and metrics of the route if it is being updated
+	if old, ok := h.l.routes[data.ID]; ok {
+		r.rateLimited = old.rateLimited
+		r.metrics = old.metrics
+		r.metrics.setService(r.Service)
+	} else {
+		r.rateLimited = new(uint64)
+		r.metrics = newRouteMetrics("http", data.ID, r.Service)
+	}
+
 	service := h.l.services[r.Service]
 	if service != nil && service.name != r.Service {
 		service.refs--
@@ -182,16 +310,24 @@ func (h *httpSyncHandler) Set(data *router.Route) error {
 			return err
 		}
 		service = &httpService{
-			name: r.Service,
-			sc:   sc,
-			rp:   proxy.NewReverseProxy(sc.Addrs, h.l.cookieKey, r.Sticky),
+			name:     r.Service,
+			sc:       sc,
+			outliers: proxy.NewOutlierDetector(),
 		}
 		h.l.services[r.Service] = service
 	}
 	service.refs++
 	r.service = service
+	r.rp = proxy.NewReverseProxy(service.sc.Addrs, h.l.cookieKey, r.Sticky, proxy.LoadBalancer{
+		Policy:     r.LoadBalancer,
+		HashHeader: r.HashHeader,
+	}, service.outliers)
 	h.l.routes[data.ID] = r
-	h.l.domains[strings.ToLower(r.Domain)] = r
+	h.l.addDomainRoute(r)
+
+	if r.ACME && h.l.acme != nil && !h.l.acme.IsOwnWrite(r.HTTPRoute) {
+		go h.l.acme.MaybeIssue(r.Domain)
+	}
 
 	go h.l.wm.Send(&router.Event{Event: "set", ID: r.Domain})
 	return nil
@@ -215,11 +351,49 @@ func (h *httpSyncHandler) Remove(id string) error {
 	}
 
 	delete(h.l.routes, id)
-	delete(h.l.domains, r.Domain)
+	h.l.removeDomainRoute(r)
 	go h.l.wm.Send(&router.Event{Event: "remove", ID: id})
 	return nil
 }
 
+// addDomainRoute adds r to the routes for its domain, replacing any existing
+// route with the same path. The caller must hold s.mtx.
+func (s *HTTPListener) addDomainRoute(r *httpRoute) {
+	domain := strings.ToLower(r.Domain)
+	routes := make([]*httpRoute, 0, len(s.domains[domain])+1)
+	for _, existing := range s.domains[domain] {
+		if existing.path != r.path {
+			routes = append(routes, existing)
+		}
+	}
+	routes = append(routes, r)
+	sort.Sort(httpRoutesByPath(routes))
+	s.domains[domain] = routes
+}
+
+// removeDomainRoute removes r from the routes for its domain. The caller must
+// hold s.mtx.
+func (s *HTTPListener) removeDomainRoute(r *httpRoute) {
+	domain := strings.ToLower(r.Domain)
+	routes := make([]*httpRoute, 0, len(s.domains[domain]))
+	for _, existing := range s.domains[domain] {
+		if existing != r {
+			routes = append(routes, existing)
+		}
+	}
+	if len(routes) == 0 {
+		delete(s.domains, domain)
+		return
+	}
+	s.domains[domain] = routes
+}
+
+type httpRoutesByPath []*httpRoute
+
+func (p httpRoutesByPath) Len() int           { return len(p) }
+func (p httpRoutesByPath) Less(i, j int) bool { return len(p[i].path) > len(p[j].path) }
+func (p httpRoutesByPath) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
 func (s *HTTPListener) listenAndServe() error {
 	var err error
 	s.listener, err = reuseport.NewReusablePortListener("tcp4", s.Addr)
@@ -245,11 +419,18 @@ var errMissingTLS = errors.New("router: route not found or TLS not configured")
 
 func (s *HTTPListener) listenAndServeTLS() error {
 	certForHandshake := func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
-		r := s.findRouteForHost(hello.ServerName)
-		if r == nil {
+		routes := s.findRoutesForHost(hello.ServerName)
+		if routes == nil {
 			return nil, errMissingTLS
 		}
-		return r.keypair, nil
+		// the certificate is per-domain, so use the first one configured on
+		// any of the domain's paths
+		for _, r := range routes {
+			if r.keypair != nil {
+				return r.keypair, nil
+			}
+		}
+		return nil, nil
 	}
 	tlsConfig := tlsconfig.SecureCiphers(&tls.Config{
 		GetCertificate: certForHandshake,
@@ -260,6 +441,9 @@ func (s *HTTPListener) listenAndServeTLS() error {
 	if err != nil {
 		return err
 	}
+	if s.passthrough != nil {
+		l = newSNIListener(l, s.passthrough)
+	}
 	s.tlsListener = tls.NewListener(l, tlsConfig)
 
 	server := &http.Server{
@@ -276,22 +460,52 @@ func (s *HTTPListener) listenAndServeTLS() error {
 	return nil
 }
 
-func (s *HTTPListener) findRouteForHost(host string) *httpRoute {
+// findRoutesForHost returns the routes for the most specific domain matching
+// host.
+func (s *HTTPListener) findRoutesForHost(host string) []*httpRoute {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for _, domain := range lookupDomains(normalizeHost(host)) {
+		if routes, ok := s.domains[domain]; ok {
+			return routes
+		}
+	}
+	return nil
+}
+
+// normalizeHost lowercases host and strips any port from it.
+func normalizeHost(host string) string {
 	host = strings.ToLower(host)
 	if strings.Contains(host, ":") {
 		host, _, _ = net.SplitHostPort(host)
 	}
-	s.mtx.RLock()
-	defer s.mtx.RUnlock()
-	if backend, ok := s.domains[host]; ok {
-		return backend
-	}
-	// handle wildcard domains up to 5 subdomains deep, from most-specific to
-	// least-specific
+	return host
+}
+
+// lookupDomains returns the domains to look up the routes for host under,
+// from most-specific to least-specific: host itself followed by wildcard
+// domains up to 5 subdomains deep.
+func lookupDomains(host string) []string {
 	d := strings.SplitN(host, ".", 5)
+	domains := make([]string, 0, len(d)+1)
+	domains = append(domains, host)
 	for i := len(d); i > 0; i-- {
-		if backend, ok := s.domains["*."+strings.Join(d[len(d)-i:], ".")]; ok {
-			return backend
+		domains = append(domains, "*."+strings.Join(d[len(d)-i:], "."))
+	}
+	return domains
+}
+
+// findRoute returns the route with the longest path prefix matching path for
+// the most specific domain matching host, falling back to less specific
+// wildcard domains if none of a domain's paths match.
+func (s *HTTPListener) findRoute(host, path string) *httpRoute {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for _, domain := range lookupDomains(normalizeHost(host)) {
+		for _, r := range s.domains[domain] {
+			if matchPath(r.path, path) {
+				return r
+			}
 		}
 	}
 	return nil
@@ -310,15 +524,28 @@ func fail(w http.ResponseWriter, code int) {
 }
 
 func (s *HTTPListener) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
 	ctx := context.Background()
-	ctx = ctxhelper.NewContextStartTime(ctx, time.Now())
-	r := s.findRouteForHost(req.Host)
+	ctx = ctxhelper.NewContextStartTime(ctx, start)
+	if s.acme != nil && s.acme.ServeChallenge(w, req) {
+		return
+	}
+	r := s.findRoute(req.Host, req.URL.Path)
 	if r == nil {
 		fail(w, 404)
 		return
 	}
 
-	r.service.ServeHTTP(ctx, w, req)
+	lw := &accessLogWriter{ResponseWriter: w}
+	defer r.logRequest(lw, req, start)
+
+	if r.limiter != nil && !r.limiter.Allow(req) {
+		atomic.AddUint64(r.rateLimited, 1)
+		fail(lw, 429)
+		return
+	}
+
+	r.ServeHTTP(ctx, lw, req)
 }
 
 // A domain served by a listener, associated TLS certs,
@@ -326,8 +553,47 @@ func (s *HTTPListener) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 type httpRoute struct {
 	*router.HTTPRoute
 
+	path    string // normalized path prefix
 	keypair *tls.Certificate
 	service *httpService
+	rp      *proxy.ReverseProxy
+	limiter *rateLimiter
+	metrics *routeMetrics
+
+	// rateLimited is shared by each version of the route so that it is not
+	// reset when the route is updated, accessed atomically
+	rateLimited *uint64
+}
+
+func (r *httpRoute) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	start, _ := ctxhelper.StartTimeFromContext(ctx)
+	req.Header.Set("X-Request-Start", strconv.FormatInt(start.UnixNano()/int64(time.Millisecond), 10))
+	req.Header.Set("X-Request-Id", random.UUID())
+
+	r.rp.ServeHTTP(w, req)
+}
+
+// logRequest records the request in the route metrics and the access log.
+func (r *httpRoute) logRequest(w *accessLogWriter, req *http.Request, start time.Time) {
+	duration := time.Since(start)
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	r.metrics.Observe(statusClass(status), duration)
+	logger.Info(
+		"request",
+		"route", r.metrics.route,
+		"service", r.Service,
+		"backend", w.backend,
+		"request_id", req.Header.Get("X-Request-Id"),
+		"method", req.Method,
+		"host", req.Host,
+		"path", req.URL.Path,
+		"status", status,
+		"bytes", w.bytes,
+		"duration", duration,
+	)
 }
 
 // A service definition: name, and set of backends.
@@ -336,15 +602,7 @@ type httpService struct {
 	sc   DiscoverdServiceCache
 	refs int
 
-	rp *proxy.ReverseProxy
-}
-
-func (s *httpService) ServeHTTP(ctx context.Context, w http.ResponseWriter, req *http.Request) {
-	start, _ := ctxhelper.StartTimeFromContext(ctx)
-	req.Header.Set("X-Request-Start", strconv.FormatInt(start.UnixNano()/int64(time.Millisecond), 10))
-	req.Header.Set("X-Request-Id", random.UUID())
-
-	s.rp.ServeHTTP(w, req)
+	outliers *proxy.OutlierDetector
 }
 
 func mustPortFromAddr(addr string) string {
@@ -231,6 +231,110 @@ func (s *S) TestWildcardRouting(c *C) {
 	assertGet(c, "http://"+l.Addr, "dev.foo.bar", "3")
 }
 
+func (s *S) TestHTTPBackendEjection(c *C) {
+	srv1 := httptest.NewServer(httpTestHandler("1"))
+	srv2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer srv1.Close()
+	defer srv2.Close()
+
+	l := s.newHTTPListener(c)
+	defer l.Close()
+
+	r := addRoute(c, l, (&router.HTTPRoute{
+		Domain:       "example.com",
+		Service:      "test",
+		LoadBalancer: router.LoadBalancerRoundRobin,
+	}).ToRoute())
+	discoverdRegisterHTTP(c, l, srv1.Listener.Addr().String())
+	discoverdRegisterHTTP(c, l, srv2.Listener.Addr().String())
+
+	for i := 0; i < 20; i++ {
+		res, err := newHTTPClient("example.com").Do(newReq("http://"+l.Addr, "example.com"))
+		c.Assert(err, IsNil)
+		res.Body.Close()
+	}
+
+	backends, err := l.Backends(r.ID)
+	c.Assert(err, IsNil)
+	c.Assert(backends, HasLen, 2)
+	for _, b := range backends {
+		if b.Addr == srv2.Listener.Addr().String() {
+			c.Assert(b.Ejected, Equals, true)
+			c.Assert(b.LastError, Equals, "500 Internal Server Error")
+		} else {
+			c.Assert(b.Ejected, Equals, false)
+		}
+	}
+
+	// the ejected backend no longer receives requests
+	for i := 0; i < 10; i++ {
+		assertGet(c, "http://"+l.Addr, "example.com", "1")
+	}
+
+	_, err = l.Backends("nonexistent")
+	c.Assert(err, Equals, ErrNotFound)
+}
+
+func (s *S) TestHTTPRouteID(c *C) {
+	// domains are case-insensitive, paths are not
+	c.Assert(httpRouteID(&router.HTTPRoute{Domain: "Example.com"}), Equals, md5sum("example.com"))
+	c.Assert(httpRouteID(&router.HTTPRoute{Domain: "Example.com", Path: "/API"}), Equals, md5sum("example.com/API/"))
+}
+
+func (s *S) TestPathRouting(c *C) {
+	srv1 := httptest.NewServer(httpTestHandler("1"))
+	srv2 := httptest.NewServer(httpTestHandler("2"))
+	srv3 := httptest.NewServer(httpTestHandler("3"))
+	defer srv1.Close()
+	defer srv2.Close()
+	defer srv3.Close()
+
+	l := s.newHTTPListener(c)
+	defer l.Close()
+
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "foo.bar",
+		Service: "1",
+	}).ToRoute())
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "foo.bar",
+		Path:    "/api",
+		Service: "2",
+	}).ToRoute())
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "foo.bar",
+		Path:    "/api/v2/",
+		Service: "3",
+	}).ToRoute())
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "*.foo.bar",
+		Service: "1",
+	}).ToRoute())
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "dev.foo.bar",
+		Path:    "/api",
+		Service: "2",
+	}).ToRoute())
+
+	discoverdRegisterHTTPService(c, l, "1", srv1.Listener.Addr().String())
+	discoverdRegisterHTTPService(c, l, "2", srv2.Listener.Addr().String())
+	discoverdRegisterHTTPService(c, l, "3", srv3.Listener.Addr().String())
+
+	assertGet(c, "http://"+l.Addr, "foo.bar", "1")
+	assertGet(c, "http://"+l.Addr+"/apiary", "foo.bar", "1")
+	assertGet(c, "http://"+l.Addr+"/api", "foo.bar", "2")
+	assertGet(c, "http://"+l.Addr+"/api/v1/users", "foo.bar", "2")
+	assertGet(c, "http://"+l.Addr+"/api/v2", "foo.bar", "3")
+	assertGet(c, "http://"+l.Addr+"/api/v2/users", "foo.bar", "3")
+
+	// paths not routed for a domain fall back to the wildcard domain
+	assertGet(c, "http://"+l.Addr+"/api", "dev.foo.bar", "2")
+	assertGet(c, "http://"+l.Addr, "dev.foo.bar", "1")
+	assertGet(c, "http://"+l.Addr+"/users", "dev.foo.bar", "1")
+}
+
 func (s *S) TestHTTPInitialSync(c *C) {
 	l := s.newHTTPListenerPrefix(c, "initial")
 	addHTTPRoute(c, l)
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the request and
+// connection duration histogram buckets.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// routeMetrics counts the requests or connections handled by a route, by
+// status class for HTTP routes, along with a histogram of their durations.
+type routeMetrics struct {
+	typ   string
+	route string
+
+	mtx      sync.Mutex
+	service  string
+	counts   map[string]uint64 // by status class, "" for TCP
+	buckets  []uint64          // non-cumulative, the last is +Inf
+	sum      float64
+	observed uint64
+}
+
+func newRouteMetrics(typ, id, service string) *routeMetrics {
+	return &routeMetrics{
+		typ:     typ,
+		route:   typ + "/" + id,
+		service: service,
+		counts:  make(map[string]uint64),
+		buckets: make([]uint64, len(latencyBuckets)+1),
+	}
+}
+
+// setService changes the service label of the metrics, which is kept when a
+// route is updated to point at a different service.
+func (m *routeMetrics) setService(service string) {
+	m.mtx.Lock()
+	m.service = service
+	m.mtx.Unlock()
+}
+
+// statusClass returns the class of an HTTP status code, for example "5xx".
+func statusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// Observe records a request with the given status class, or a connection if
+// class is empty, which took d to complete.
+func (m *routeMetrics) Observe(class string, d time.Duration) {
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+
+	m.mtx.Lock()
+	m.counts[class]++
+	m.buckets[i]++
+	m.sum += seconds
+	m.observed++
+	m.mtx.Unlock()
+}
+
+type metricsSnapshot struct {
+	*routeMetrics
+	service  string
+	counts   map[string]uint64
+	buckets  []uint64
+	sum      float64
+	observed uint64
+}
+
+func (m *routeMetrics) snapshot() *metricsSnapshot {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	s := &metricsSnapshot{
+		routeMetrics: m,
+		service:      m.service,
+		counts:       make(map[string]uint64, len(m.counts)),
+		buckets:      make([]uint64, len(m.buckets)),
+		sum:          m.sum,
+		observed:     m.observed,
+	}
+	for k, v := range m.counts {
+		s.counts[k] = v
+	}
+	copy(s.buckets, m.buckets)
+	return s
+}
+
+func (s *metricsSnapshot) labels(extra ...string) string {
+	labels := []string{
+		fmt.Sprintf("route=%q", s.route),
+		fmt.Sprintf("service=%q", s.service),
+	}
+	labels = append(labels, extra...)
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// writeMetrics writes the metrics for the given routes to w in the Prometheus
+// text exposition format.
+func writeMetrics(w io.Writer, metrics []*routeMetrics) {
+	snapshots := make(map[string][]*metricsSnapshot)
+	for _, m := range metrics {
+		snapshots[m.typ] = append(snapshots[m.typ], m.snapshot())
+	}
+	for _, s := range snapshots {
+		sort.Sort(snapshotsByRoute(s))
+	}
+
+	if httpSnapshots := snapshots["http"]; len(httpSnapshots) > 0 {
+		fmt.Fprintln(w, "# HELP router_http_requests_total Number of HTTP requests by route and status class.")
+		fmt.Fprintln(w, "# TYPE router_http_requests_total counter")
+		for _, s := range httpSnapshots {
+			classes := make([]string, 0, len(s.counts))
+			for class := range s.counts {
+				classes = append(classes, class)
+			}
+			sort.Strings(classes)
+			for _, class := range classes {
+				fmt.Fprintf(w, "router_http_requests_total%s %d\n", s.labels(fmt.Sprintf("code=%q", class)), s.counts[class])
+			}
+		}
+		writeHistogram(w, "router_http_request_duration_seconds", "HTTP request latencies in seconds by route.", httpSnapshots)
+	}
+	if tcpSnapshots := snapshots["tcp"]; len(tcpSnapshots) > 0 {
+		fmt.Fprintln(w, "# HELP router_tcp_connections_total Number of TCP connections by route.")
+		fmt.Fprintln(w, "# TYPE router_tcp_connections_total counter")
+		for _, s := range tcpSnapshots {
+			fmt.Fprintf(w, "router_tcp_connections_total%s %d\n", s.labels(), s.observed)
+		}
+		writeHistogram(w, "router_tcp_connection_duration_seconds", "TCP connection durations in seconds by route.", tcpSnapshots)
+	}
+}
+
+func writeHistogram(w io.Writer, name, help string, snapshots []*metricsSnapshot) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, s := range snapshots {
+		var cumulative uint64
+		for i, count := range s.buckets {
+			cumulative += count
+			le := "+Inf"
+			if i < len(latencyBuckets) {
+				le = strconv.FormatFloat(latencyBuckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, s.labels(fmt.Sprintf("le=%q", le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, s.labels(), strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, s.labels(), s.observed)
+	}
+}
+
+type snapshotsByRoute []*metricsSnapshot
+
+func (p snapshotsByRoute) Len() int           { return len(p) }
+func (p snapshotsByRoute) Less(i, j int) bool { return p[i].route < p[j].route }
+func (p snapshotsByRoute) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+func metricsHandler(rtr *Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, append(rtr.HTTP.Metrics(), rtr.TCP.Metrics()...))
+	}
+}
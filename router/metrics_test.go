@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/Godeps/_workspace/src/gopkg.in/inconshreveable/log15.v2"
+	"github.com/flynn/flynn/router/types"
+)
+
+func (s *S) TestWriteMetrics(c *C) {
+	h := newRouteMetrics("http", "1", "web")
+	h.Observe("2xx", 3*time.Millisecond)
+	h.Observe("2xx", 200*time.Millisecond)
+	h.Observe("5xx", 20*time.Second)
+	t := newRouteMetrics("tcp", "2", "db")
+	t.Observe("", time.Second)
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, []*routeMetrics{t, h})
+	out := buf.String()
+
+	for _, line := range []string{
+		"# TYPE router_http_requests_total counter",
+		`router_http_requests_total{route="http/1",service="web",code="2xx"} 2`,
+		`router_http_requests_total{route="http/1",service="web",code="5xx"} 1`,
+		"# TYPE router_http_request_duration_seconds histogram",
+		`router_http_request_duration_seconds_bucket{route="http/1",service="web",le="0.005"} 1`,
+		`router_http_request_duration_seconds_bucket{route="http/1",service="web",le="0.25"} 2`,
+		`router_http_request_duration_seconds_bucket{route="http/1",service="web",le="10"} 2`,
+		`router_http_request_duration_seconds_bucket{route="http/1",service="web",le="+Inf"} 3`,
+		`router_http_request_duration_seconds_count{route="http/1",service="web"} 3`,
+		`router_tcp_connections_total{route="tcp/2",service="db"} 1`,
+		`router_tcp_connection_duration_seconds_bucket{route="tcp/2",service="db",le="1"} 1`,
+		`router_tcp_connection_duration_seconds_sum{route="tcp/2",service="db"} 1`,
+	} {
+		c.Assert(strings.Contains(out, line+"\n"), Equals, true, Commentf("missing %q in:\n%s", line, out))
+	}
+}
+
+func (s *S) TestAccessLogAndMetrics(c *C) {
+	srv := httptest.NewServer(httpTestHandler("1"))
+	defer srv.Close()
+
+	records := make(chan *log15.Record, 10)
+	defer func(l log15.Logger) { logger = l }(logger)
+	logger = log15.New()
+	logger.SetHandler(log15.ChannelHandler(records))
+
+	apiSrv := s.newTestAPIServer(c)
+	defer apiSrv.Close()
+	l := apiSrv.listeners[0].(*HTTPListener)
+
+	r := addRoute(c, l, (&router.HTTPRoute{Domain: "example.com", Service: "test"}).ToRoute())
+	discoverdRegisterHTTP(c, l, srv.Listener.Addr().String())
+
+	assertGet(c, "http://"+l.Addr, "example.com", "1")
+
+	select {
+	case rec := <-records:
+		c.Assert(rec.Msg, Equals, "request")
+		ctx := make(map[string]interface{})
+		for i := 0; i < len(rec.Ctx); i += 2 {
+			ctx[rec.Ctx[i].(string)] = rec.Ctx[i+1]
+		}
+		c.Assert(ctx["route"], Equals, "http/"+r.ID)
+		c.Assert(ctx["service"], Equals, "test")
+		c.Assert(ctx["backend"], Equals, srv.Listener.Addr().String())
+		c.Assert(ctx["status"], Equals, 200)
+		c.Assert(ctx["bytes"], Equals, int64(1))
+	case <-time.After(time.Second):
+		c.Fatal("timed out waiting for access log")
+	}
+
+	res, err := http.Get(apiSrv.URL + "/metrics")
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+	c.Assert(res.StatusCode, Equals, 200)
+	body, err := ioutil.ReadAll(res.Body)
+	c.Assert(err, IsNil)
+	line := fmt.Sprintf(`router_http_requests_total{route="http/%s",service="test",code="2xx"} 1`, r.ID)
+	c.Assert(strings.Contains(string(body), line), Equals, true, Commentf("missing %q in:\n%s", line, body))
+
+	// updating the route keeps the metrics, with the new service label
+	wait := waitForEvent(c, l, "set", "")
+	updated := r.HTTPRoute()
+	updated.Service = "test2"
+	c.Assert(l.SetRoute(updated.ToRoute()), IsNil)
+	wait()
+	var buf bytes.Buffer
+	writeMetrics(&buf, l.Metrics())
+	line = fmt.Sprintf(`router_http_requests_total{route="http/%s",service="test2",code="2xx"} 1`, r.ID)
+	c.Assert(strings.Contains(buf.String(), line), Equals, true, Commentf("missing %q in:\n%s", line, buf.String()))
+}
@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/router/types"
+)
+
+const (
+	defaultMaxFailures      = 5
+	defaultBaseEjectionTime = 30 * time.Second
+	defaultMaxEjectionTime  = 5 * time.Minute
+)
+
+// OutlierDetector passively tracks request failures for backend addresses and
+// temporarily ejects backends which fail repeatedly, so that they are not
+// tried until their ejection period has passed.
+//
+// A failure is a dial error, a proxy error or a 5xx response. A backend is
+// ejected for BaseEjectionTime after MaxFailures consecutive failures. If it
+// fails again once the ejection period is over it is ejected immediately for
+// twice as long as the previous time, up to MaxEjectionTime. A successful
+// request resets the backend's state.
+type OutlierDetector struct {
+	MaxFailures      int
+	BaseEjectionTime time.Duration
+	MaxEjectionTime  time.Duration
+
+	mtx      sync.Mutex
+	backends map[string]*backendHealth
+
+	// now is overridden in tests
+	now func() time.Time
+}
+
+type backendHealth struct {
+	failures     int
+	ejections    int
+	ejectedUntil time.Time
+	lastErr      string
+}
+
+// NewOutlierDetector returns an OutlierDetector with the default thresholds.
+func NewOutlierDetector() *OutlierDetector {
+	return &OutlierDetector{
+		MaxFailures:      defaultMaxFailures,
+		BaseEjectionTime: defaultBaseEjectionTime,
+		MaxEjectionTime:  defaultMaxEjectionTime,
+		backends:         make(map[string]*backendHealth),
+		now:              time.Now,
+	}
+}
+
+// Filter returns addrs with any currently ejected backends removed. If every
+// backend is ejected then addrs is returned unchanged, as failing requests are
+// preferable to not trying at all.
+func (d *OutlierDetector) Filter(addrs []string) []string {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.prune(addrs)
+	if len(d.backends) == 0 {
+		return addrs
+	}
+	now := d.now()
+	filtered := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if h, ok := d.backends[addr]; ok && now.Before(h.ejectedUntil) {
+			continue
+		}
+		filtered = append(filtered, addr)
+	}
+	if len(filtered) == 0 {
+		return addrs
+	}
+	return filtered
+}
+
+// prune forgets the state of backends which are no longer in addrs. The
+// caller must hold d.mtx.
+func (d *OutlierDetector) prune(addrs []string) {
+	if len(d.backends) <= len(addrs) {
+		return
+	}
+	current := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		current[addr] = struct{}{}
+	}
+	for addr := range d.backends {
+		if _, ok := current[addr]; !ok {
+			delete(d.backends, addr)
+		}
+	}
+}
+
+// Success records a successful request to addr.
+func (d *OutlierDetector) Success(addr string) {
+	d.mtx.Lock()
+	delete(d.backends, addr)
+	d.mtx.Unlock()
+}
+
+// Failure records a failed request to addr, ejecting it if it has reached the
+// maximum number of consecutive failures.
+func (d *OutlierDetector) Failure(addr string, err error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	h, ok := d.backends[addr]
+	if !ok {
+		h = &backendHealth{}
+		d.backends[addr] = h
+	}
+	h.failures++
+	if err != nil {
+		h.lastErr = err.Error()
+	}
+
+	now := d.now()
+	if now.Before(h.ejectedUntil) {
+		return
+	}
+	if h.failures < d.MaxFailures && h.ejections == 0 {
+		return
+	}
+	ejection := d.BaseEjectionTime << uint(h.ejections)
+	if ejection > d.MaxEjectionTime || ejection <= 0 {
+		ejection = d.MaxEjectionTime
+	}
+	h.ejections++
+	h.failures = 0
+	h.ejectedUntil = now.Add(ejection)
+}
+
+// Status returns the state of each of addrs, sorted by address.
+func (d *OutlierDetector) Status(addrs []string) []*router.Backend {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	now := d.now()
+	backends := make([]*router.Backend, len(addrs))
+	for i, addr := range addrs {
+		b := &router.Backend{Addr: addr}
+		if h, ok := d.backends[addr]; ok {
+			b.ConsecutiveFailures = h.failures
+			b.Ejections = h.ejections
+			b.LastError = h.lastErr
+			if now.Before(h.ejectedUntil) {
+				until := h.ejectedUntil
+				b.Ejected = true
+				b.EjectedUntil = &until
+			}
+		}
+		backends[i] = b
+	}
+	sort.Sort(backendsByAddr(backends))
+	return backends
+}
+
+type backendsByAddr []*router.Backend
+
+func (p backendsByAddr) Len() int           { return len(p) }
+func (p backendsByAddr) Less(i, j int) bool { return p[i].Addr < p[j].Addr }
+func (p backendsByAddr) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flynn/flynn/router/types"
+)
+
+func newTestOutlierDetector() (*OutlierDetector, *time.Time) {
+	now := time.Unix(0, 0)
+	d := NewOutlierDetector()
+	d.now = func() time.Time { return now }
+	return d, &now
+}
+
+func TestOutlierDetectorEjection(t *testing.T) {
+	d, now := newTestOutlierDetector()
+	addrs := []string{"10.0.0.1:80", "10.0.0.2:80"}
+	bad := addrs[0]
+	errBad := errors.New("connection refused")
+
+	for i := 0; i < d.MaxFailures-1; i++ {
+		d.Failure(bad, errBad)
+	}
+	if filtered := d.Filter(addrs); len(filtered) != 2 {
+		t.Fatalf("expected no backends to be ejected before %d failures, got %v", d.MaxFailures, filtered)
+	}
+
+	d.Failure(bad, errBad)
+	filtered := d.Filter(addrs)
+	if len(filtered) != 1 || filtered[0] != addrs[1] {
+		t.Fatalf("expected %s to be ejected, got %v", bad, filtered)
+	}
+
+	status := d.Status(addrs)
+	if !status[0].Ejected || status[0].Ejections != 1 || status[0].LastError != errBad.Error() {
+		t.Errorf("unexpected status for ejected backend: %+v", status[0])
+	}
+	if expected := now.Add(d.BaseEjectionTime); status[0].EjectedUntil == nil || !status[0].EjectedUntil.Equal(expected) {
+		t.Errorf("expected backend to be ejected until %s, got %v", expected, status[0].EjectedUntil)
+	}
+	if status[1].Ejected || status[1].ConsecutiveFailures != 0 {
+		t.Errorf("unexpected status for healthy backend: %+v", status[1])
+	}
+
+	// the backend is tried again after the ejection period, and a single
+	// failure ejects it for twice as long
+	*now = now.Add(d.BaseEjectionTime)
+	if filtered := d.Filter(addrs); len(filtered) != 2 {
+		t.Fatalf("expected ejection to have expired, got %v", filtered)
+	}
+	d.Failure(bad, errBad)
+	status = d.Status(addrs)
+	if expected := now.Add(2 * d.BaseEjectionTime); !status[0].Ejected || !status[0].EjectedUntil.Equal(expected) {
+		t.Errorf("expected backend to be ejected until %s, got %+v", expected, status[0])
+	}
+
+	// the ejection period is capped
+	for i := 0; i < 10; i++ {
+		*now = *status[0].EjectedUntil
+		d.Failure(bad, errBad)
+		status = d.Status(addrs)
+	}
+	if expected := now.Add(d.MaxEjectionTime); !status[0].EjectedUntil.Equal(expected) {
+		t.Errorf("expected backend to be ejected until %s, got %s", expected, status[0].EjectedUntil)
+	}
+
+	// a successful request resets the backend
+	d.Success(bad)
+	status = d.Status(addrs)
+	if status[0].Ejected || status[0].Ejections != 0 || status[0].ConsecutiveFailures != 0 {
+		t.Errorf("expected backend to be reset, got %+v", status[0])
+	}
+}
+
+func TestOutlierDetectorAllEjected(t *testing.T) {
+	d, _ := newTestOutlierDetector()
+	addrs := []string{"10.0.0.1:80", "10.0.0.2:80"}
+	for _, addr := range addrs {
+		for i := 0; i < d.MaxFailures; i++ {
+			d.Failure(addr, nil)
+		}
+	}
+	if filtered := d.Filter(addrs); len(filtered) != 2 {
+		t.Fatalf("expected all backends when every backend is ejected, got %v", filtered)
+	}
+
+	// state for backends which have gone away is discarded
+	d.Filter(addrs[1:])
+	if _, ok := d.backends[addrs[0]]; ok {
+		t.Errorf("expected state for %s to be discarded", addrs[0])
+	}
+}
+
+func TestTransportEjectsFailingBackend(t *testing.T) {
+	var failing int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(500)
+		}
+	}))
+	defer srv.Close()
+
+	// other tests replace the dialer
+	defer func(d backendDialer) { dialer = d }(dialer)
+	dialer = &net.Dialer{}
+
+	good := srv.Listener.Addr().String()
+	d, _ := newTestOutlierDetector()
+	tr := &transport{
+		getBackends: func() []string { return []string{good, "127.0.0.1:0"} },
+		outliers:    d,
+		// try each backend first in turn
+		lb: LoadBalancer{Policy: router.LoadBalancerRoundRobin},
+	}
+	roundTrip := func() {
+		req, _ := http.NewRequest("GET", srv.URL, strings.NewReader(""))
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	// the unreachable backend is ejected after failing to dial
+	for i := 0; i < 20; i++ {
+		roundTrip()
+	}
+	status := d.Status(tr.getBackends())
+	if !status[0].Ejected {
+		t.Errorf("expected unreachable backend to be ejected, got %+v", status[0])
+	}
+	if status[1].Ejected || status[1].ConsecutiveFailures != 0 {
+		t.Errorf("expected working backend not to be ejected, got %+v", status[1])
+	}
+
+	// 5xx responses count as failures
+	atomic.StoreInt32(&failing, 1)
+	for i := 0; i < d.MaxFailures; i++ {
+		roundTrip()
+	}
+	status = d.Status(tr.getBackends())
+	if !status[1].Ejected || status[1].LastError != "500 Internal Server Error" {
+		t.Errorf("expected failing backend to be ejected, got %+v", status[1])
+	}
+}
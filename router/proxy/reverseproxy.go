@@ -58,15 +58,31 @@ type ReverseProxy struct {
 	ErrorLog *log.Logger
 }
 
+// BackendSetter is implemented by http.ResponseWriters and net.Conns passed
+// to ReverseProxy which need to know the address of the backend that was
+// chosen, for example to log it.
+type BackendSetter interface {
+	SetBackend(addr string)
+}
+
+func setBackend(v interface{}, addr string) {
+	if s, ok := v.(BackendSetter); ok {
+		s.SetBackend(addr)
+	}
+}
+
 // NewReverseProxy initializes a new ReverseProxy with a callback to get
-// backends, a stickyKey for encrypting sticky session cookies, and a flag
-// sticky to enable sticky sessions.
-func NewReverseProxy(bf BackendListFunc, stickyKey *[32]byte, sticky bool) *ReverseProxy {
+// backends, a stickyKey for encrypting sticky session cookies, a flag sticky
+// to enable sticky sessions, the load balancing policy used to choose between
+// backends, and an optional OutlierDetector used to eject failing backends.
+func NewReverseProxy(bf BackendListFunc, stickyKey *[32]byte, sticky bool, lb LoadBalancer, od *OutlierDetector) *ReverseProxy {
 	return &ReverseProxy{
 		transport: &transport{
 			getBackends:       bf,
 			stickyCookieKey:   stickyKey,
 			useStickySessions: sticky,
+			lb:                lb,
+			outliers:          od,
 		},
 		FlushInterval: 10 * time.Millisecond,
 	}
@@ -94,6 +110,7 @@ func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 	defer res.Body.Close()
+	setBackend(rw, res.Request.URL.Host)
 
 	prepareResponseHeaders(res)
 	p.writeResponse(rw, res)
@@ -125,6 +142,7 @@ func (p *ReverseProxy) ServeConn(ctx context.Context, dconn net.Conn) {
 		return
 	}
 	defer uconn.Close()
+	setBackend(dconn, uconn.RemoteAddr().String())
 
 	joinConns(uconn, dconn)
 }
@@ -143,6 +161,7 @@ func (p *ReverseProxy) serveUpgrade(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 	defer uconn.Close()
+	setBackend(rw, req.URL.Host)
 
 	prepareResponseHeaders(res)
 	if res.StatusCode != 101 {
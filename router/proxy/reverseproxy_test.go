@@ -31,7 +31,7 @@ func TestServeConnClientGone(t *testing.T) {
 	})
 
 	fn := func() []string { return []string{"127.0.0.1:0", "127.0.0.1:0"} }
-	prox := NewReverseProxy(fn, nil, false)
+	prox := NewReverseProxy(fn, nil, false, LoadBalancer{}, nil)
 
 	prox.ServeConn(context.Background(), cnConn)
 }
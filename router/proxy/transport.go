@@ -5,14 +5,19 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"hash/fnv"
 	"io"
 	"net"
 	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/golang.org/x/crypto/nacl/secretbox"
 	"github.com/flynn/flynn/Godeps/_workspace/src/golang.org/x/net/context"
 	"github.com/flynn/flynn/pkg/random"
+	"github.com/flynn/flynn/router/types"
 )
 
 type backendDialer interface {
@@ -38,16 +43,68 @@ var (
 // BackendListFunc returns a slice of backend hosts (hostname:port).
 type BackendListFunc func() []string
 
+// LoadBalancer configures how a ReverseProxy chooses between backends.
+type LoadBalancer struct {
+	// Policy is one of the router.LoadBalancer* policies, it defaults to
+	// router.LoadBalancerRandom.
+	Policy string
+
+	// HashHeader is the request header hashed by the
+	// router.LoadBalancerHeaderHash policy.
+	HashHeader string
+}
+
 type transport struct {
 	getBackends BackendListFunc
 
 	stickyCookieKey   *[32]byte
 	useStickySessions bool
+
+	lb       LoadBalancer
+	outliers *OutlierDetector
+
+	// next is the round-robin counter
+	next uint64
+
+	// inFlight counts the outstanding requests and connections for each
+	// backend, it is only maintained for the least-requests policy
+	inFlightMtx sync.Mutex
+	inFlight    map[string]int
 }
 
-func (t *transport) getOrderedBackends(stickyBackend string) []string {
+// getOrderedBackends returns the backends in the order they should be tried,
+// as determined by the load balancing policy. req is nil for TCP connections.
+func (t *transport) getOrderedBackends(stickyBackend string, req *http.Request) []string {
 	backends := t.getBackends()
-	shuffle(backends)
+	if t.outliers != nil {
+		backends = t.outliers.Filter(backends)
+	}
+
+	switch t.lb.Policy {
+	case router.LoadBalancerRoundRobin:
+		// backends are not returned in a stable order, so sort them before
+		// rotating
+		sort.Strings(backends)
+		rotate(backends, int(atomic.AddUint64(&t.next, 1)-1))
+	case router.LoadBalancerLeastRequests:
+		// shuffle first so that ties are broken randomly
+		shuffle(backends)
+		t.inFlightMtx.Lock()
+		sort.Stable(backendsByCount{backends, t.inFlight})
+		t.inFlightMtx.Unlock()
+	case router.LoadBalancerHeaderHash:
+		var key string
+		if req != nil && t.lb.HashHeader != "" {
+			key = req.Header.Get(t.lb.HashHeader)
+		}
+		if key == "" {
+			shuffle(backends)
+			break
+		}
+		sortByHash(backends, key)
+	default:
+		shuffle(backends)
+	}
 
 	if stickyBackend != "" {
 		swapToFront(backends, stickyBackend)
@@ -55,6 +112,117 @@ func (t *transport) getOrderedBackends(stickyBackend string) []string {
 	return backends
 }
 
+func (t *transport) success(backend string) {
+	if t.outliers != nil {
+		t.outliers.Success(backend)
+	}
+}
+
+func (t *transport) failure(backend string, err error) {
+	if t.outliers != nil {
+		t.outliers.Failure(backend, err)
+	}
+}
+
+func (t *transport) trackInFlight() bool {
+	return t.lb.Policy == router.LoadBalancerLeastRequests
+}
+
+func (t *transport) beginRequest(backend string) {
+	if !t.trackInFlight() {
+		return
+	}
+	t.inFlightMtx.Lock()
+	if t.inFlight == nil {
+		t.inFlight = make(map[string]int)
+	}
+	t.inFlight[backend]++
+	t.inFlightMtx.Unlock()
+}
+
+func (t *transport) endRequest(backend string) {
+	if !t.trackInFlight() {
+		return
+	}
+	t.inFlightMtx.Lock()
+	if t.inFlight[backend] <= 1 {
+		delete(t.inFlight, backend)
+	} else {
+		t.inFlight[backend]--
+	}
+	t.inFlightMtx.Unlock()
+}
+
+// trackConn wraps conn so that the request to backend ends when it is closed.
+func (t *transport) trackConn(conn net.Conn, backend string) net.Conn {
+	if !t.trackInFlight() {
+		return conn
+	}
+	return &trackedConn{Conn: conn, done: func() { t.endRequest(backend) }}
+}
+
+type trackedConn struct {
+	net.Conn
+	once sync.Once
+	done func()
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(c.done)
+	return c.Conn.Close()
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *trackedBody) Close() error {
+	b.once.Do(b.done)
+	return b.ReadCloser.Close()
+}
+
+type backendsByCount struct {
+	backends []string
+	counts   map[string]int
+}
+
+func (b backendsByCount) Len() int { return len(b.backends) }
+func (b backendsByCount) Less(i, j int) bool {
+	return b.counts[b.backends[i]] < b.counts[b.backends[j]]
+}
+func (b backendsByCount) Swap(i, j int) {
+	b.backends[i], b.backends[j] = b.backends[j], b.backends[i]
+}
+
+// sortByHash orders backends using rendezvous hashing, so that a key maps to
+// the same backend for as long as it is available, and only keys mapped to a
+// removed backend move elsewhere.
+func sortByHash(backends []string, key string) {
+	weights := make(map[string]uint64, len(backends))
+	for _, b := range backends {
+		h := fnv.New64a()
+		io.WriteString(h, key)
+		io.WriteString(h, b)
+		weights[b] = h.Sum64()
+	}
+	sort.Sort(backendsByWeight{backends, weights})
+}
+
+type backendsByWeight struct {
+	backends []string
+	weights  map[string]uint64
+}
+
+func (b backendsByWeight) Len() int { return len(b.backends) }
+func (b backendsByWeight) Less(i, j int) bool {
+	return b.weights[b.backends[i]] > b.weights[b.backends[j]]
+}
+func (b backendsByWeight) Swap(i, j int) {
+	b.backends[i], b.backends[j] = b.backends[j], b.backends[i]
+}
+
 func (t *transport) getStickyBackend(req *http.Request) string {
 	if t.useStickySessions {
 		return getStickyCookieBackend(req, *t.stickyCookieKey)
@@ -77,14 +245,26 @@ func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	defer req.Body.(*fakeCloseReadCloser).RealClose()
 
 	stickyBackend := t.getStickyBackend(req)
-	backends := t.getOrderedBackends(stickyBackend)
+	backends := t.getOrderedBackends(stickyBackend, req)
 	for _, backend := range backends {
 		req.URL.Host = backend
+		t.beginRequest(backend)
 		res, err := httpTransport.RoundTrip(req)
 		if err == nil {
+			if res.StatusCode >= 500 {
+				t.failure(backend, errors.New(res.Status))
+			} else {
+				t.success(backend)
+			}
+			if t.trackInFlight() {
+				backend := backend
+				res.Body = &trackedBody{ReadCloser: res.Body, done: func() { t.endRequest(backend) }}
+			}
 			t.setStickyBackend(res, stickyBackend)
 			return res, nil
 		}
+		t.endRequest(backend)
+		t.failure(backend, err)
 		if _, ok := err.(dialErr); !ok {
 			return nil, err
 		}
@@ -94,18 +274,24 @@ func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 func (t *transport) Connect(ctx context.Context) (net.Conn, error) {
-	backends := t.getOrderedBackends("")
-	conn, _, err := dialTCP(ctx, backends)
-	return conn, err
+	backends := t.getOrderedBackends("", nil)
+	conn, addr, err := t.dialTCP(ctx, backends)
+	if err != nil {
+		return nil, err
+	}
+	t.beginRequest(addr)
+	return t.trackConn(conn, addr), nil
 }
 
 func (t *transport) UpgradeHTTP(req *http.Request) (*http.Response, net.Conn, error) {
 	stickyBackend := t.getStickyBackend(req)
-	backends := t.getOrderedBackends(stickyBackend)
-	upconn, addr, err := dialTCP(context.Background(), backends)
+	backends := t.getOrderedBackends(stickyBackend, req)
+	upconn, addr, err := t.dialTCP(context.Background(), backends)
 	if err != nil {
 		return nil, nil, err
 	}
+	t.beginRequest(addr)
+	upconn = t.trackConn(upconn, addr)
 	conn := &streamConn{bufio.NewReader(upconn), upconn}
 	req.URL.Host = addr
 
@@ -122,7 +308,7 @@ func (t *transport) UpgradeHTTP(req *http.Request) (*http.Response, net.Conn, er
 	return res, conn, nil
 }
 
-func dialTCP(ctx context.Context, addrs []string) (net.Conn, string, error) {
+func (t *transport) dialTCP(ctx context.Context, addrs []string) (net.Conn, string, error) {
 	donec := ctx.Done()
 	for _, addr := range addrs {
 		select {
@@ -131,9 +317,12 @@ func dialTCP(ctx context.Context, addrs []string) (net.Conn, string, error) {
 		default:
 		}
 
-		if conn, err := dialer.Dial("tcp", addr); err == nil {
+		conn, err := dialer.Dial("tcp", addr)
+		if err == nil {
+			t.success(addr)
 			return conn, addr, nil
 		}
+		t.failure(addr, err)
 	}
 	return nil, "", errNoBackends
 }
@@ -172,6 +361,17 @@ func shuffle(s []string) {
 	}
 }
 
+func rotate(s []string, n int) {
+	if len(s) == 0 {
+		return
+	}
+	n %= len(s)
+	rotated := make([]string, 0, len(s))
+	rotated = append(rotated, s[n:]...)
+	rotated = append(rotated, s[:n]...)
+	copy(s, rotated)
+}
+
 func swapToFront(ss []string, s string) {
 	for i := range ss {
 		if ss[i] == s {
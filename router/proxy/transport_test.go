@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flynn/flynn/router/types"
+)
+
+var testBackends = []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"}
+
+func newTestTransport(lb LoadBalancer) *transport {
+	return &transport{
+		getBackends: func() []string {
+			backends := make([]string, len(testBackends))
+			// return the backends in a different order each time, like the
+			// discoverd service cache can
+			copy(backends, testBackends)
+			shuffle(backends)
+			return backends
+		},
+		lb: lb,
+	}
+}
+
+func firstBackends(t *transport, n int, req func(int) *http.Request) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		backends := t.getOrderedBackends("", req(i))
+		if len(backends) != len(testBackends) {
+			panic(fmt.Sprintf("expected %d backends, got %d", len(testBackends), len(backends)))
+		}
+		counts[backends[0]]++
+	}
+	return counts
+}
+
+func noRequest(int) *http.Request { return nil }
+
+func TestRandomDistribution(t *testing.T) {
+	tr := newTestTransport(LoadBalancer{})
+	counts := firstBackends(tr, 3000, noRequest)
+	for _, b := range testBackends {
+		// allow for plenty of variance, this is only checking that every
+		// backend is chosen a reasonable proportion of the time
+		if counts[b] < 700 {
+			t.Errorf("expected backend %s to be chosen at least 700 times, got %d", b, counts[b])
+		}
+	}
+}
+
+func TestRoundRobinDistribution(t *testing.T) {
+	tr := newTestTransport(LoadBalancer{Policy: router.LoadBalancerRoundRobin})
+
+	var prev string
+	for i := 0; i < 300; i++ {
+		first := tr.getOrderedBackends("", nil)[0]
+		if first == prev {
+			t.Fatalf("expected a different backend to the previous request, got %s twice", first)
+		}
+		prev = first
+	}
+
+	counts := firstBackends(tr, 300, noRequest)
+	for _, b := range testBackends {
+		if counts[b] != 100 {
+			t.Errorf("expected backend %s to be chosen 100 times, got %d", b, counts[b])
+		}
+	}
+}
+
+func TestLeastRequestsDistribution(t *testing.T) {
+	tr := newTestTransport(LoadBalancer{Policy: router.LoadBalancerLeastRequests})
+
+	tr.beginRequest(testBackends[0])
+	tr.beginRequest(testBackends[0])
+	tr.beginRequest(testBackends[1])
+
+	for i := 0; i < 100; i++ {
+		backends := tr.getOrderedBackends("", nil)
+		expected := []string{testBackends[2], testBackends[1], testBackends[0]}
+		for j := range expected {
+			if backends[j] != expected[j] {
+				t.Fatalf("expected backends %v, got %v", expected, backends)
+			}
+		}
+	}
+
+	// once every backend has the same number of outstanding requests they
+	// should all be chosen
+	tr.endRequest(testBackends[0])
+	tr.beginRequest(testBackends[2])
+	counts := firstBackends(tr, 3000, noRequest)
+	for _, b := range testBackends {
+		if counts[b] < 700 {
+			t.Errorf("expected backend %s to be chosen at least 700 times, got %d", b, counts[b])
+		}
+	}
+
+	tr.endRequest(testBackends[0])
+	tr.endRequest(testBackends[1])
+	tr.endRequest(testBackends[2])
+	if len(tr.inFlight) != 0 {
+		t.Errorf("expected no outstanding requests, got %v", tr.inFlight)
+	}
+}
+
+func TestHeaderHashDistribution(t *testing.T) {
+	tr := newTestTransport(LoadBalancer{Policy: router.LoadBalancerHeaderHash, HashHeader: "X-User-Id"})
+	reqForUser := func(i int) *http.Request {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		req.Header.Set("X-User-Id", fmt.Sprintf("user-%d", i))
+		return req
+	}
+
+	// the same header value always maps to the same backend
+	assigned := make(map[int]string, 3000)
+	for i := 0; i < 3000; i++ {
+		for j := 0; j < 5; j++ {
+			first := tr.getOrderedBackends("", reqForUser(i))[0]
+			if j == 0 {
+				assigned[i] = first
+			} else if first != assigned[i] {
+				t.Fatalf("expected user-%d to map to %s, got %s", i, assigned[i], first)
+			}
+		}
+	}
+
+	// different header values are spread across the backends
+	counts := firstBackends(tr, 3000, reqForUser)
+	for _, b := range testBackends {
+		if counts[b] < 700 {
+			t.Errorf("expected backend %s to be chosen at least 700 times, got %d", b, counts[b])
+		}
+	}
+
+	// removing a backend only moves the values which were mapped to it
+	removed := testBackends[0]
+	tr.getBackends = func() []string { return []string{testBackends[1], testBackends[2]} }
+	for i := 0; i < 3000; i++ {
+		first := tr.getOrderedBackends("", reqForUser(i))[0]
+		if assigned[i] != removed && first != assigned[i] {
+			t.Fatalf("expected user-%d to stay on %s, got %s", i, assigned[i], first)
+		}
+	}
+
+	// requests without the header fall back to a random backend
+	tr.getBackends = newTestTransport(LoadBalancer{}).getBackends
+	counts = firstBackends(tr, 3000, func(int) *http.Request {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		return req
+	})
+	for _, b := range testBackends {
+		if counts[b] < 700 {
+			t.Errorf("expected backend %s to be chosen at least 700 times, got %d", b, counts[b])
+		}
+	}
+}
+
+func TestLeastRequestsReleasedOnBodyClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	// other tests replace the dialer
+	defer func(d backendDialer) { dialer = d }(dialer)
+	dialer = &net.Dialer{}
+
+	backend := srv.Listener.Addr().String()
+	tr := &transport{
+		getBackends: func() []string { return []string{backend} },
+		lb:          LoadBalancer{Policy: router.LoadBalancerLeastRequests},
+	}
+
+	// requests from the server always have a body
+	req, _ := http.NewRequest("GET", srv.URL, strings.NewReader(""))
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := tr.inFlight[backend]; n != 1 {
+		t.Errorf("expected 1 outstanding request before the body is closed, got %d", n)
+	}
+	ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body.Close()
+	if n := tr.inFlight[backend]; n != 0 {
+		t.Errorf("expected no outstanding requests after the body is closed, got %d", n)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/router/types"
+)
+
+// rateLimiter is a set of token buckets, one per client key, which each fill
+// at rate tokens per second up to burst tokens.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	header string
+
+	mtx       sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+
+	// now is overridden in tests
+	now func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(conf *router.RateLimit) *rateLimiter {
+	burst := conf.Burst
+	if burst == 0 {
+		burst = int(math.Max(1, math.Ceil(conf.Rate)))
+	}
+	return &rateLimiter{
+		rate:    conf.Rate,
+		burst:   float64(burst),
+		header:  conf.Header,
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// key returns the key identifying the client which sent req, either the value
+// of the configured header or the client IP.
+func (l *rateLimiter) key(req *http.Request) string {
+	if l.header != "" {
+		if v := req.Header.Get(l.header); v != "" {
+			return v
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// Allow takes a token from the bucket for the client which sent req,
+// returning false if there are none left.
+func (l *rateLimiter) Allow(req *http.Request) bool {
+	key := l.key(req)
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	now := l.now()
+	l.prune(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune removes buckets which have refilled completely, as they are
+// equivalent to a new bucket. It runs at most once per refill period. The
+// caller must hold l.mtx.
+func (l *rateLimiter) prune(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastPrune) < refill {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/router/types"
+)
+
+func (s *S) TestRateLimiter(c *C) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(&router.RateLimit{Rate: 2, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	req := func(addr string) *http.Request {
+		return &http.Request{RemoteAddr: addr, Header: make(http.Header)}
+	}
+	client1, client2 := req("10.0.0.1:1234"), req("10.0.0.2:1234")
+
+	// a client may make burst requests at once
+	for i := 0; i < 3; i++ {
+		c.Assert(l.Allow(client1), Equals, true)
+	}
+	c.Assert(l.Allow(client1), Equals, false)
+
+	// clients are limited separately, and by IP rather than address
+	c.Assert(l.Allow(client2), Equals, true)
+	c.Assert(l.Allow(req("10.0.0.1:5678")), Equals, false)
+
+	// tokens are added at the configured rate
+	now = now.Add(500 * time.Millisecond)
+	c.Assert(l.Allow(client1), Equals, true)
+	c.Assert(l.Allow(client1), Equals, false)
+
+	// and are capped at burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		c.Assert(l.Allow(client1), Equals, true)
+	}
+	c.Assert(l.Allow(client1), Equals, false)
+
+	// full buckets are pruned
+	c.Assert(l.buckets, HasLen, 1)
+}
+
+func (s *S) TestRateLimiterHeader(c *C) {
+	l := newRateLimiter(&router.RateLimit{Rate: 1, Header: "X-Api-Key"})
+	c.Assert(l.burst, Equals, float64(1))
+
+	req := func(key string) *http.Request {
+		r := &http.Request{RemoteAddr: "10.0.0.1:1234", Header: make(http.Header)}
+		if key != "" {
+			r.Header.Set("X-Api-Key", key)
+		}
+		return r
+	}
+	c.Assert(l.Allow(req("a")), Equals, true)
+	c.Assert(l.Allow(req("a")), Equals, false)
+	c.Assert(l.Allow(req("b")), Equals, true)
+
+	// requests without the header are limited by IP
+	c.Assert(l.Allow(req("")), Equals, true)
+	c.Assert(l.Allow(req("")), Equals, false)
+}
+
+func (s *S) TestHTTPRateLimit(c *C) {
+	srv := httptest.NewServer(httpTestHandler("1"))
+	defer srv.Close()
+
+	l := s.newHTTPListener(c)
+	defer l.Close()
+
+	r := addRoute(c, l, (&router.HTTPRoute{
+		Domain:    "example.com",
+		Service:   "test",
+		RateLimit: &router.RateLimit{Rate: 0.1, Burst: 2},
+	}).ToRoute())
+	discoverdRegisterHTTP(c, l, srv.Listener.Addr().String())
+
+	assertGet(c, "http://"+l.Addr, "example.com", "1")
+	assertGet(c, "http://"+l.Addr, "example.com", "1")
+
+	res, err := newHTTPClient("example.com").Do(newReq("http://"+l.Addr, "example.com"))
+	c.Assert(err, IsNil)
+	res.Body.Close()
+	c.Assert(res.StatusCode, Equals, 429)
+
+	stats, err := l.Stats(r.ID)
+	c.Assert(err, IsNil)
+	c.Assert(stats.RateLimited, Equals, uint64(1))
+
+	// updating the route keeps the counter
+	wait := waitForEvent(c, l, "set", "")
+	updated := r.HTTPRoute()
+	updated.RateLimit = &router.RateLimit{Rate: 0.1, Burst: 1}
+	c.Assert(l.SetRoute(updated.ToRoute()), IsNil)
+	wait()
+	stats, err = l.Stats(r.ID)
+	c.Assert(err, IsNil)
+	c.Assert(stats.RateLimited, Equals, uint64(1))
+}
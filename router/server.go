@@ -2,9 +2,11 @@ package main
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
@@ -14,6 +16,7 @@ import (
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/kavu/go_reuseport"
 	"github.com/flynn/flynn/discoverd/client"
 	"github.com/flynn/flynn/pkg/shutdown"
+	"github.com/flynn/flynn/router/acme"
 	"github.com/flynn/flynn/router/types"
 )
 
@@ -23,6 +26,9 @@ type Listener interface {
 	AddRoute(*router.Route) error
 	SetRoute(*router.Route) error
 	RemoveRoute(id string) error
+	Backends(id string) ([]*router.Backend, error)
+	Stats(id string) (*router.RouteStats, error)
+	Metrics() []*routeMetrics
 	Watcher
 	DataStoreReader
 }
@@ -100,22 +106,47 @@ func main() {
 	if prefix == "" {
 		prefix = "/router"
 	}
+	tcpListener := &TCPListener{
+		IP:        *tcpIP,
+		startPort: *tcpRangeStart,
+		endPort:   *tcpRangeEnd,
+		ds:        NewEtcdDataStore(etcdc, path.Join(prefix, "tcp/")),
+		discoverd: discoverd.DefaultClient,
+	}
+	httpListener := &HTTPListener{
+		Addr:      *httpAddr,
+		TLSAddr:   *httpsAddr,
+		cookieKey: cookieKey,
+		keypair:   keypair,
+		ds:        NewEtcdDataStore(etcdc, path.Join(prefix, "http/")),
+		discoverd: discoverd.DefaultClient,
+		// TLS connections for TCP passthrough routes share the HTTPS port
+		passthrough: tcpListener,
+	}
+
+	// obtain certificates for routes with ACME enabled from the ACME server
+	// at ACME_DIRECTORY_URL, trusting the optional CA in ACME_CA_FILE
+	if dirURL := os.Getenv("ACME_DIRECTORY_URL"); dirURL != "" {
+		client := &acme.Client{DirectoryURL: dirURL}
+		if caFile := os.Getenv("ACME_CA_FILE"); caFile != "" {
+			ca, err := ioutil.ReadFile(caFile)
+			if err != nil {
+				shutdown.Fatal("error reading ACME_CA_FILE:", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				shutdown.Fatal("error parsing ACME_CA_FILE")
+			}
+			client.HTTPClient = &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			}}
+		}
+		httpListener.acme = newACMEManager(acmeAccount{client}, os.Getenv("ACME_EMAIL"), etcdc, path.Join(prefix, "acme"))
+	}
+
 	r := Router{
-		TCP: &TCPListener{
-			IP:        *tcpIP,
-			startPort: *tcpRangeStart,
-			endPort:   *tcpRangeEnd,
-			ds:        NewEtcdDataStore(etcdc, path.Join(prefix, "tcp/")),
-			discoverd: discoverd.DefaultClient,
-		},
-		HTTP: &HTTPListener{
-			Addr:      *httpAddr,
-			TLSAddr:   *httpsAddr,
-			cookieKey: cookieKey,
-			keypair:   keypair,
-			ds:        NewEtcdDataStore(etcdc, path.Join(prefix, "http/")),
-			discoverd: discoverd.DefaultClient,
-		},
+		TCP:  tcpListener,
+		HTTP: httpListener,
 	}
 
 	if err := r.Start(); err != nil {
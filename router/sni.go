@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// sniPeekTimeout is how long to wait for the TLS ClientHello of a connection
+// to the TLS listener.
+const sniPeekTimeout = 10 * time.Second
+
+// maxClientHelloSize is the maximum size of a ClientHello handshake message
+// that will be read to find the server name.
+const maxClientHelloSize = 1 << 16
+
+var errNotClientHello = errors.New("router: connection did not start with a TLS ClientHello")
+
+// sniRouter finds the TCP route for TLS connections which should be passed
+// through to a backend without being terminated.
+type sniRouter interface {
+	findSNIRoute(serverName string) *tcpRoute
+}
+
+// sniListener wraps the raw listener of the TLS listener, passing
+// connections with a server name matching a TLS passthrough route directly
+// to that route instead of returning them from Accept.
+type sniListener struct {
+	net.Listener
+	passthrough sniRouter
+
+	conns chan net.Conn
+	errs  chan error
+	done  chan struct{}
+	err   error
+}
+
+func newSNIListener(l net.Listener, passthrough sniRouter) *sniListener {
+	s := &sniListener{
+		Listener:    l,
+		passthrough: passthrough,
+		conns:       make(chan net.Conn),
+		errs:        make(chan error),
+		done:        make(chan struct{}),
+	}
+	go s.acceptLoop()
+	return s
+}
+
+func (l *sniListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *sniListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				select {
+				case l.errs <- err:
+				case <-l.done:
+				}
+				continue
+			}
+			l.err = err
+			close(l.done)
+			return
+		}
+		go l.route(conn)
+	}
+}
+
+// route reads the ClientHello from conn and either passes it to the matching
+// TLS passthrough route or returns it from Accept to be terminated.
+func (l *sniListener) route(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(sniPeekTimeout))
+	serverName, data, err := readClientHello(conn)
+	conn.SetReadDeadline(time.Time{})
+
+	// replay the ClientHello to whichever side handles the connection
+	pc := &peekedConn{Conn: conn, r: io.MultiReader(bytes.NewReader(data), conn)}
+	if err == nil && serverName != "" {
+		if r := l.passthrough.findSNIRoute(serverName); r != nil {
+			r.handle(pc)
+			return
+		}
+	}
+	select {
+	case l.conns <- pc:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+// peekedConn is a net.Conn with data that has already been read from it
+// placed back in front of the remaining data.
+type peekedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// readClientHello reads a TLS ClientHello from r and returns the SNI server
+// name, which is empty if the client did not send one, along with all of the
+// data that was read.
+func readClientHello(r io.Reader) (serverName string, data []byte, err error) {
+	var buf bytes.Buffer
+	var hello []byte
+	for buf.Len() < 2*maxClientHelloSize {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(io.TeeReader(r, &buf), header); err != nil {
+			return "", buf.Bytes(), err
+		}
+		// handshake record
+		if header[0] != 0x16 {
+			return "", buf.Bytes(), errNotClientHello
+		}
+		record := make([]byte, int(header[3])<<8|int(header[4]))
+		if _, err := io.ReadFull(io.TeeReader(r, &buf), record); err != nil {
+			return "", buf.Bytes(), err
+		}
+		hello = append(hello, record...)
+
+		// the ClientHello may span several records
+		if len(hello) < 4 {
+			continue
+		}
+		if hello[0] != 1 {
+			return "", buf.Bytes(), errNotClientHello
+		}
+		length := int(hello[1])<<16 | int(hello[2])<<8 | int(hello[3])
+		if length > maxClientHelloSize {
+			return "", buf.Bytes(), errNotClientHello
+		}
+		if len(hello) >= 4+length {
+			return parseServerName(hello[4 : 4+length]), buf.Bytes(), nil
+		}
+	}
+	return "", buf.Bytes(), errNotClientHello
+}
+
+// parseServerName returns the server name from the SNI extension of a
+// ClientHello message body, or an empty string if there is none.
+func parseServerName(hello []byte) string {
+	p := &helloParser{data: hello}
+	p.skip(2 + 32)   // version and random
+	p.skip(p.int(1)) // session id
+	p.skip(p.int(2)) // cipher suites
+	p.skip(p.int(1)) // compression methods
+	exts := p.next(p.int(2))
+	if p.err || exts == nil {
+		return ""
+	}
+
+	p = &helloParser{data: exts}
+	for len(p.data) > 0 && !p.err {
+		typ := p.int(2)
+		ext := p.next(p.int(2))
+		// server_name extension
+		if typ != 0 || p.err {
+			continue
+		}
+		names := &helloParser{data: ext}
+		list := &helloParser{data: names.next(names.int(2))}
+		for len(list.data) > 0 && !list.err {
+			nameType := list.int(1)
+			name := list.next(list.int(2))
+			// host_name
+			if nameType == 0 && !list.err {
+				return string(name)
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// helloParser reads length-prefixed fields from a TLS handshake message,
+// setting err if the message is truncated.
+type helloParser struct {
+	data []byte
+	err  bool
+}
+
+func (p *helloParser) next(n int) []byte {
+	if p.err || n > len(p.data) {
+		p.err = true
+		return nil
+	}
+	b := p.data[:n]
+	p.data = p.data[n:]
+	return b
+}
+
+func (p *helloParser) skip(n int) {
+	p.next(n)
+}
+
+func (p *helloParser) int(size int) int {
+	var n int
+	for _, b := range p.next(size) {
+		n = n<<8 | int(b)
+	}
+	return n
+}
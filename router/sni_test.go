@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/flynn/flynn/router/types"
+)
+
+func readTestClientHello(c *C, config *tls.Config) (string, []byte, error) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		tls.Client(client, config).Handshake()
+		client.Close()
+	}()
+	return readClientHello(server)
+}
+
+func (s *S) TestReadClientHello(c *C) {
+	serverName, data, err := readTestClientHello(c, &tls.Config{ServerName: "db.example.com"})
+	c.Assert(err, IsNil)
+	c.Assert(serverName, Equals, "db.example.com")
+	c.Assert(data[0], Equals, byte(0x16))
+
+	// no SNI is sent for IP addresses
+	serverName, _, err = readTestClientHello(c, &tls.Config{ServerName: "127.0.0.1"})
+	c.Assert(err, IsNil)
+	c.Assert(serverName, Equals, "")
+
+	// the data read from other protocols is returned
+	req := []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	_, data, err = readClientHello(bytes.NewReader(req))
+	c.Assert(err, Equals, errNotClientHello)
+	c.Assert(data, DeepEquals, req[:5])
+}
+
+func (s *S) TestTLSPassthrough(c *C) {
+	backend := httptest.NewTLSServer(httpTestHandler("passthrough"))
+	defer backend.Close()
+	srv := httptest.NewServer(httpTestHandler("terminated"))
+	defer srv.Close()
+
+	tcpListener := s.newTCPListener(c)
+	defer tcpListener.Close()
+	pair, err := tls.X509KeyPair(localhostCert, localhostKey)
+	c.Assert(err, IsNil)
+	l := &HTTPListener{
+		Addr:        "127.0.0.1:0",
+		TLSAddr:     "127.0.0.1:0",
+		keypair:     pair,
+		ds:          NewEtcdDataStore(s.etcd, fmt.Sprintf("/router/http/%s/", random.String(8))),
+		discoverd:   s.discoverd,
+		passthrough: tcpListener,
+	}
+	c.Assert(l.Start(), IsNil)
+	defer l.Close()
+
+	addHTTPRoute(c, l)
+	discoverdRegisterHTTP(c, l, srv.Listener.Addr().String())
+
+	route := addRoute(c, tcpListener, (&router.TCPRoute{
+		Service: "passthrough",
+		Domain:  "passthrough.example.com",
+	}).ToRoute())
+	c.Assert(route.ID, Equals, md5sum("passthrough.example.com"))
+
+	// the route ID does not depend on the case of the domain
+	c.Assert(tcpListener.SetRoute((&router.TCPRoute{
+		Service: "passthrough",
+		Domain:  "Passthrough.example.com",
+	}).ToRoute()), IsNil)
+	updated, err := tcpListener.Get(route.ID)
+	c.Assert(err, IsNil)
+	c.Assert(updated.TCPRoute().Domain, Equals, "Passthrough.example.com")
+	discoverdRegisterTCPService(c, tcpListener, "passthrough", backend.Listener.Addr().String())
+
+	// connections for the passthrough domain are terminated by the backend
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{ServerName: "passthrough.example.com", InsecureSkipVerify: true},
+	}}
+	res, err := client.Do(newReq("https://"+l.TLSAddr, "passthrough.example.com"))
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "passthrough")
+	c.Assert(res.TLS.PeerCertificates[0].Raw, DeepEquals, backend.TLS.Certificates[0].Certificate[0])
+
+	// other domains are still terminated by the router
+	assertGet(c, "https://"+l.TLSAddr, "example.com", "terminated")
+
+	// removing the route stops passing connections through
+	wait := waitForEvent(c, tcpListener, "remove", route.ID)
+	c.Assert(tcpListener.RemoveRoute(route.ID), IsNil)
+	wait()
+	c.Assert(tcpListener.findSNIRoute("passthrough.example.com"), IsNil)
+}
+
+func (s *S) TestTLSPassthroughPort(c *C) {
+	err := validateTCPRoute(&router.TCPRoute{Service: "test", Domain: "db.example.com", Port: 443})
+	c.Assert(err, Equals, errSNIRoutePort)
+}
@@ -6,7 +6,10 @@ import (
 	"log"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/kavu/go_reuseport"
 	"github.com/flynn/flynn/Godeps/_workspace/src/golang.org/x/net/context"
@@ -28,11 +31,12 @@ type TCPListener struct {
 	endPort   int
 	listeners map[int]net.Listener
 
-	mtx      sync.RWMutex
-	services map[string]*tcpService
-	routes   map[string]*tcpRoute
-	ports    map[int]*tcpRoute
-	closed   bool
+	mtx       sync.RWMutex
+	services  map[string]*tcpService
+	routes    map[string]*tcpRoute
+	ports     map[int]*tcpRoute
+	sniRoutes map[string]*tcpRoute
+	closed    bool
 }
 
 func (l *TCPListener) AddRoute(route *router.Route) error {
@@ -42,6 +46,10 @@ func (l *TCPListener) AddRoute(route *router.Route) error {
 	if l.closed {
 		return ErrClosed
 	}
+	if r.Domain != "" {
+		route.ID = md5sum(strings.ToLower(r.Domain))
+		return l.ds.Add(route)
+	}
 	if r.Port == 0 {
 		return l.addWithAllocatedPort(route)
 	}
@@ -56,6 +64,10 @@ func (l *TCPListener) SetRoute(route *router.Route) error {
 	if l.closed {
 		return ErrClosed
 	}
+	if r.Domain != "" {
+		route.ID = md5sum(strings.ToLower(r.Domain))
+		return l.ds.Set(route)
+	}
 	if r.Port == 0 {
 		return errors.New("router: a port number needs to be specified")
 	}
@@ -65,6 +77,25 @@ func (l *TCPListener) SetRoute(route *router.Route) error {
 
 var ErrNoPorts = errors.New("router: no ports available")
 
+var errInvalidMaxConns = errors.New("router: max conns must not be negative")
+var errSNIRoutePort = errors.New("router: TLS passthrough routes are served on the TLS port and cannot have a port")
+
+func validateTCPRoute(r *router.TCPRoute) error {
+	switch r.LoadBalancer {
+	case "", router.LoadBalancerRandom, router.LoadBalancerRoundRobin, router.LoadBalancerLeastRequests:
+	default:
+		// header-hash is not supported as there are no headers to hash
+		return errInvalidLoadBalancer
+	}
+	if r.MaxConns < 0 {
+		return errInvalidMaxConns
+	}
+	if r.Domain != "" && r.Port != 0 {
+		return errSNIRoutePort
+	}
+	return nil
+}
+
 func (l *TCPListener) addWithAllocatedPort(route *router.Route) error {
 	r := route.TCPRoute()
 	l.mtx.RLock()
@@ -89,6 +120,49 @@ func (l *TCPListener) RemoveRoute(id string) error {
 	return l.ds.Remove(id)
 }
 
+// Backends returns the outlier detection state of the backends of the
+// service for the route with the given id.
+func (l *TCPListener) Backends(id string) ([]*router.Backend, error) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	if l.closed {
+		return nil, ErrClosed
+	}
+	r, ok := l.routes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.service.outliers.Status(r.service.sc.Addrs()), nil
+}
+
+// Metrics returns the metrics for each route.
+func (l *TCPListener) Metrics() []*routeMetrics {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	metrics := make([]*routeMetrics, 0, len(l.routes))
+	for _, r := range l.routes {
+		metrics = append(metrics, r.metrics)
+	}
+	return metrics
+}
+
+// Stats returns the counters for the route with the given id.
+func (l *TCPListener) Stats(id string) (*router.RouteStats, error) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	if l.closed {
+		return nil, ErrClosed
+	}
+	r, ok := l.routes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &router.RouteStats{
+		ActiveConns:   atomic.LoadInt64(&r.conns.active),
+		RejectedConns: atomic.LoadUint64(&r.conns.rejected),
+	}, nil
+}
+
 func (l *TCPListener) Start() error {
 	if l.Watcher != nil {
 		return errors.New("router: tcp listener already started")
@@ -106,6 +180,7 @@ func (l *TCPListener) Start() error {
 	l.services = make(map[string]*tcpService)
 	l.routes = make(map[string]*tcpRoute)
 	l.ports = make(map[int]*tcpRoute)
+	l.sniRoutes = make(map[string]*tcpRoute)
 	l.listeners = make(map[int]net.Listener)
 
 	started := make(chan error)
@@ -157,6 +232,16 @@ func (h *tcpSyncHandler) Set(data *router.Route) error {
 		return nil
 	}
 
+	// keep the counters and metrics of the route if it is being updated
+	if old, ok := h.l.routes[data.ID]; ok {
+		r.conns = old.conns
+		r.metrics = old.metrics
+		r.metrics.setService(r.Service)
+	} else {
+		r.conns = &connCounters{}
+		r.metrics = newRouteMetrics("tcp", data.ID, r.Service)
+	}
+
 	service := h.l.services[r.Service]
 	if service != nil && service.name != r.Service {
 		service.refs--
@@ -172,28 +257,35 @@ func (h *tcpSyncHandler) Set(data *router.Route) error {
 			return err
 		}
 		service = &tcpService{
-			name: r.Service,
-			sc:   sc,
-			rp:   proxy.NewReverseProxy(sc.Addrs, nil, false),
+			name:     r.Service,
+			sc:       sc,
+			outliers: proxy.NewOutlierDetector(),
 		}
 		h.l.services[r.Service] = service
 	}
 	r.service = service
-	if listener, ok := h.l.listeners[r.Port]; ok {
-		r.l = listener
-		delete(h.l.listeners, r.Port)
-	}
-	started := make(chan error)
-	go r.Serve(started)
-	if err := <-started; err != nil {
-		if r.l != nil {
-			h.l.listeners[r.Port] = r.l
+	r.rp = proxy.NewReverseProxy(service.sc.Addrs, nil, false, proxy.LoadBalancer{Policy: r.LoadBalancer}, service.outliers)
+	if r.Domain != "" {
+		// TLS passthrough routes are served by the HTTP listener's TLS
+		// port rather than a port of their own
+		h.l.sniRoutes[strings.ToLower(r.Domain)] = r
+	} else {
+		if listener, ok := h.l.listeners[r.Port]; ok {
+			r.l = listener
+			delete(h.l.listeners, r.Port)
+		}
+		started := make(chan error)
+		go r.Serve(started)
+		if err := <-started; err != nil {
+			if r.l != nil {
+				h.l.listeners[r.Port] = r.l
+			}
+			return err
 		}
-		return err
+		h.l.ports[r.Port] = r
 	}
 	service.refs++
 	h.l.routes[data.ID] = r
-	h.l.ports[r.Port] = r
 
 	go h.l.wm.Send(&router.Event{Event: "set", ID: data.ID})
 	return nil
@@ -218,7 +310,11 @@ func (h *tcpSyncHandler) Remove(id string) error {
 	}
 
 	delete(h.l.routes, id)
-	delete(h.l.ports, r.Port)
+	if r.Domain != "" {
+		delete(h.l.sniRoutes, strings.ToLower(r.Domain))
+	} else {
+		delete(h.l.ports, r.Port)
+	}
 	go h.l.wm.Send(&router.Event{Event: "remove", ID: id})
 	return nil
 }
@@ -229,7 +325,17 @@ type tcpRoute struct {
 	l       net.Listener
 	addr    string
 	service *tcpService
+	rp      *proxy.ReverseProxy
+	metrics *routeMetrics
 	mtx     sync.RWMutex
+	conns   *connCounters
+}
+
+// connCounters count the connections of a TCP route. They are shared by each
+// version of the route so that they are not reset when the route is updated.
+type connCounters struct {
+	active   int64  // accessed atomically
+	rejected uint64 // accessed atomically
 }
 
 func (r *tcpRoute) Serve(started chan<- error) {
@@ -248,12 +354,43 @@ func (r *tcpRoute) Serve(started chan<- error) {
 			break
 		}
 		r.mtx.RLock()
-		go r.service.ServeConn(conn)
+		r.handle(conn)
 		r.mtx.RUnlock()
 	}
 }
 
+// handle serves conn in a new goroutine unless the route is at its
+// connection limit, in which case conn is closed.
+func (r *tcpRoute) handle(conn net.Conn) {
+	if r.MaxConns > 0 && atomic.LoadInt64(&r.conns.active) >= int64(r.MaxConns) {
+		atomic.AddUint64(&r.conns.rejected, 1)
+		conn.Close()
+		return
+	}
+	atomic.AddInt64(&r.conns.active, 1)
+	go func() {
+		r.ServeConn(conn)
+		atomic.AddInt64(&r.conns.active, -1)
+	}()
+}
+
+// findSNIRoute returns the TLS passthrough route for serverName, if any.
+func (l *TCPListener) findSNIRoute(serverName string) *tcpRoute {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	for _, domain := range lookupDomains(strings.ToLower(serverName)) {
+		if r, ok := l.sniRoutes[domain]; ok {
+			return r
+		}
+	}
+	return nil
+}
+
 func (r *tcpRoute) Close() {
+	if r.l == nil {
+		// TLS passthrough routes have no listener
+		return
+	}
 	if r.Port >= r.parent.startPort && r.Port <= r.parent.endPort {
 		// make a copy of the fd and create a new listener with it
 		fd, err := r.l.(*net.TCPListener).File()
@@ -271,14 +408,29 @@ func (r *tcpRoute) Close() {
 	r.l.Close()
 }
 
+func (r *tcpRoute) ServeConn(conn net.Conn) {
+	start := time.Now()
+	lc := &accessLogConn{Conn: proxy.CloseNotifyConn(conn)}
+	r.rp.ServeConn(context.Background(), lc)
+
+	duration := time.Since(start)
+	r.metrics.Observe("", duration)
+	logger.Info(
+		"connection",
+		"route", r.metrics.route,
+		"service", r.Service,
+		"backend", lc.backend,
+		"client", conn.RemoteAddr().String(),
+		"bytes_in", atomic.LoadInt64(&lc.bytesIn),
+		"bytes_out", atomic.LoadInt64(&lc.bytesOut),
+		"duration", duration,
+	)
+}
+
 type tcpService struct {
 	name string
 	sc   DiscoverdServiceCache
 	refs int
 
-	rp *proxy.ReverseProxy
-}
-
-func (s *tcpService) ServeConn(conn net.Conn) {
-	s.rp.ServeConn(context.Background(), proxy.CloseNotifyConn(conn))
+	outliers *proxy.OutlierDetector
 }
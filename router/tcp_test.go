@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net"
 	"strconv"
+	"time"
 
 	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
 	"github.com/flynn/flynn/discoverd/testutil/etcdrunner"
@@ -109,6 +110,65 @@ func (s *S) TestAddTCPRoute(c *C) {
 	c.Assert(err, Not(IsNil))
 }
 
+func (s *S) TestTCPMaxConns(c *C) {
+	const addr, portInt = "127.0.0.1:45001", 45001
+	srv := NewTCPTestServer("1")
+	defer srv.Close()
+
+	l := s.newTCPListener(c)
+	defer l.Close()
+
+	wait := waitForEvent(c, l, "set", "")
+	r := (&router.TCPRoute{
+		Service:  "test",
+		Port:     portInt,
+		MaxConns: 1,
+	}).ToRoute()
+	c.Assert(l.AddRoute(r), IsNil)
+	wait()
+	discoverdRegisterTCP(c, l, srv.Addr)
+
+	conn, err := net.Dial("tcp", addr)
+	c.Assert(err, IsNil)
+	prefix := make([]byte, 1)
+	_, err = io.ReadFull(conn, prefix)
+	c.Assert(err, IsNil)
+	c.Assert(string(prefix), Equals, "1")
+
+	// connections over the limit are closed immediately
+	rejected, err := net.Dial("tcp", addr)
+	c.Assert(err, IsNil)
+	res, _ := ioutil.ReadAll(rejected)
+	rejected.Close()
+	c.Assert(res, HasLen, 0)
+
+	stats, err := l.Stats(r.ID)
+	c.Assert(err, IsNil)
+	c.Assert(stats.ActiveConns, Equals, int64(1))
+	c.Assert(stats.RejectedConns, Equals, uint64(1))
+
+	// updating the route keeps the counters
+	wait = waitForEvent(c, l, "set", "")
+	updated := r.TCPRoute()
+	updated.MaxConns = 2
+	c.Assert(l.SetRoute(updated.ToRoute()), IsNil)
+	wait()
+	stats, err = l.Stats(r.ID)
+	c.Assert(err, IsNil)
+	c.Assert(stats.ActiveConns, Equals, int64(1))
+	c.Assert(stats.RejectedConns, Equals, uint64(1))
+
+	// closing the connection frees up the slot
+	conn.Close()
+	for start := time.Now(); time.Since(start) < waitTimeout; time.Sleep(10 * time.Millisecond) {
+		if stats, _ = l.Stats(r.ID); stats.ActiveConns == 0 {
+			break
+		}
+	}
+	c.Assert(stats.ActiveConns, Equals, int64(0))
+	assertTCPConn(c, addr, "1")
+}
+
 func addTCPRoute(c *C, l *TCPListener, port int) *router.TCPRoute {
 	wait := waitForEvent(c, l, "set", "")
 	r := (&router.TCPRoute{
@@ -44,13 +44,51 @@ func (r *Route) TCPRoute() *TCPRoute {
 	return route
 }
 
+// Load balancing policies which can be configured on HTTP and TCP routes.
+const (
+	// LoadBalancerRandom tries backends in a random order, it is the default.
+	LoadBalancerRandom = "random"
+	// LoadBalancerRoundRobin rotates through backends in turn.
+	LoadBalancerRoundRobin = "round-robin"
+	// LoadBalancerLeastRequests prefers the backends with the fewest
+	// outstanding requests or connections.
+	LoadBalancerLeastRequests = "least-requests"
+	// LoadBalancerHeaderHash consistently maps the value of a request header
+	// to a backend (HTTP routes only).
+	LoadBalancerHeaderHash = "header-hash"
+)
+
 type HTTPRoute struct {
-	*Route  `json:"-"`
-	Domain  string `json:"domain,omitempty"`
-	Service string `json:"service,omitempty"`
-	TLSCert string `json:"tls_cert,omitempty"`
-	TLSKey  string `json:"tls_key,omitempty"`
-	Sticky  bool   `json:"sticky,omitempty"`
+	*Route       `json:"-"`
+	Domain       string     `json:"domain,omitempty"`
+	Path         string     `json:"path,omitempty"`
+	Service      string     `json:"service,omitempty"`
+	TLSCert      string     `json:"tls_cert,omitempty"`
+	TLSKey       string     `json:"tls_key,omitempty"`
+	Sticky       bool       `json:"sticky,omitempty"`
+	LoadBalancer string     `json:"load_balancer,omitempty"`
+	HashHeader   string     `json:"hash_header,omitempty"`
+	RateLimit    *RateLimit `json:"rate_limit,omitempty"`
+
+	// ACME enables obtaining and renewing a certificate for Domain from the
+	// router's ACME server, which replaces TLSCert and TLSKey.
+	ACME bool `json:"acme,omitempty"`
+}
+
+// RateLimit configures token bucket rate limiting of the requests to an HTTP
+// route from each client. Requests which exceed the limit receive a 429
+// response.
+type RateLimit struct {
+	// Rate is the number of requests per second allowed from each client.
+	Rate float64 `json:"rate"`
+
+	// Burst is the number of requests a client may make at once, it defaults
+	// to Rate rounded up.
+	Burst int `json:"burst,omitempty"`
+
+	// Header is the request header which identifies a client, if empty or
+	// missing from the request then the client IP is used.
+	Header string `json:"header,omitempty"`
 }
 
 func (r *HTTPRoute) ToRoute() *Route {
@@ -67,9 +105,20 @@ func (r *HTTPRoute) ToRoute() *Route {
 }
 
 type TCPRoute struct {
-	*Route  `json:"-"`
-	Port    int    `json:"port"`
-	Service string `json:"service"`
+	*Route       `json:"-"`
+	Port         int    `json:"port"`
+	Service      string `json:"service"`
+	LoadBalancer string `json:"load_balancer,omitempty"`
+
+	// MaxConns is the maximum number of concurrent connections to the route,
+	// further connections are refused. Zero means unlimited.
+	MaxConns int `json:"max_conns,omitempty"`
+
+	// Domain makes the route a TLS passthrough route. TLS connections to the
+	// router's HTTPS port with a matching SNI server name are forwarded to
+	// the service without being terminated, instead of using Port. It takes
+	// precedence over HTTP routes for the same domain.
+	Domain string `json:"domain,omitempty"`
 }
 
 func (r *TCPRoute) ToRoute() *Route {
@@ -85,6 +134,40 @@ func (r *TCPRoute) ToRoute() *Route {
 	return &route
 }
 
+// Backend is the outlier detection state of one of the backends of a route's
+// service.
+type Backend struct {
+	Addr string `json:"addr"`
+
+	// Ejected is true if the backend is not being sent traffic because it has
+	// failed too many requests, until EjectedUntil.
+	Ejected      bool       `json:"ejected"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+
+	// ConsecutiveFailures is the number of failed requests since the last
+	// successful request or ejection.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+
+	// Ejections is the number of consecutive times the backend has been
+	// ejected.
+	Ejections int `json:"ejections"`
+
+	LastError string `json:"last_error,omitempty"`
+}
+
+// RouteStats are the counters for the limits configured on a route.
+type RouteStats struct {
+	// RateLimited is the number of HTTP requests rejected by the rate limit.
+	RateLimited uint64 `json:"rate_limited"`
+
+	// ActiveConns is the number of open TCP connections.
+	ActiveConns int64 `json:"active_conns"`
+
+	// RejectedConns is the number of TCP connections refused because the
+	// route was at its connection limit.
+	RejectedConns uint64 `json:"rejected_conns"`
+}
+
 type Event struct {
 	Event string
 	ID    string
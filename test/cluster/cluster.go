@@ -235,7 +235,7 @@ loop:
 	for {
 		select {
 		case event := <-events:
-			if event.Kind == discoverd.EventKindDown {
+			if event.Kind.Any(discoverd.EventKindDown, discoverd.EventKindExpired) {
 				break loop
 			}
 		case <-time.After(20 * time.Second):
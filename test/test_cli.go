@@ -312,6 +312,21 @@ func (s *CLISuite) TestKill(t *c.C) {
 	t.Assert(stoppedID, c.Equals, jobID)
 }
 
+func (s *CLISuite) TestExec(t *c.C) {
+	app := s.newCliTestApp(t)
+	t.Assert(app.flynn("scale", "--no-wait", "echoer=1"), Succeeds)
+	_, jobID := app.waitFor(jobEvents{"echoer": {"up": 1}})
+
+	t.Assert(app.flynn("exec", jobID, "echo", "hello"), OutputContains, "hello")
+	res := app.flynn("exec", jobID, "sh", "-c", "exit 3")
+	t.Assert(res.Err, c.NotNil)
+	t.Assert(res.Err.(*exec.ExitError).Sys().(syscall.WaitStatus).ExitStatus(), c.Equals, 3)
+
+	// the job is still running after the command exits
+	t.Assert(app.flynn("ps"), OutputContains, jobID)
+	t.Assert(app.flynn("scale", "echoer=0"), Succeeds)
+}
+
 func (s *CLISuite) TestRoute(t *c.C) {
 	app := s.newCliTestApp(t)
 
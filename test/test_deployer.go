@@ -14,8 +14,13 @@ type DeployerSuite struct {
 var _ = c.Suite(&DeployerSuite{})
 
 func (s *DeployerSuite) createDeployment(t *c.C, process, strategy string) *ct.Deployment {
+	return s.createDeploymentWithMeta(t, process, strategy, nil)
+}
+
+func (s *DeployerSuite) createDeploymentWithMeta(t *c.C, process, strategy string, meta map[string]string) *ct.Deployment {
 	app, release := s.createApp(t)
 	app.Strategy = strategy
+	app.Meta = meta
 	s.controllerClient(t).UpdateApp(app)
 
 	jobStream := make(chan *ct.JobEvent)
@@ -49,7 +54,7 @@ loop:
 		case e := <-stream:
 			debugf(t, "got deployment event: %s %s", e.JobType, e.JobState)
 			actual = append(actual, e)
-			if e.Status == "complete" || e.Status == "failed" {
+			if e.Status == "complete" || e.Status == "rolled_back" {
 				break loop
 			}
 		case <-time.After(5 * time.Second):
@@ -114,6 +119,34 @@ func (s *DeployerSuite) TestAllAtOnceStrategy(t *c.C) {
 	waitForDeploymentEvents(t, events, expected)
 }
 
+func (s *DeployerSuite) TestCanaryStrategy(t *c.C) {
+	deployment := s.createDeploymentWithMeta(t, "printer", "canary", map[string]string{
+		"canary_count":       "1",
+		"canary_soak_period": "1s",
+	})
+	events := make(chan *ct.DeploymentEvent)
+	stream, err := s.controllerClient(t).StreamDeployment(deployment.ID, events)
+	t.Assert(err, c.IsNil)
+	defer stream.Close()
+	releaseID := deployment.NewReleaseID
+	oldReleaseID := deployment.OldReleaseID
+
+	expected := []*ct.DeploymentEvent{
+		{ReleaseID: releaseID, JobType: "printer", JobState: "starting", Status: "running"},
+		{ReleaseID: releaseID, JobType: "printer", JobState: "up", Status: "running"},
+		{ReleaseID: releaseID, JobType: "", JobState: "soaking", Status: "running"},
+		{ReleaseID: releaseID, JobType: "", JobState: "promoting", Status: "running"},
+		{ReleaseID: releaseID, JobType: "printer", JobState: "starting", Status: "running"},
+		{ReleaseID: releaseID, JobType: "printer", JobState: "up", Status: "running"},
+		{ReleaseID: oldReleaseID, JobType: "printer", JobState: "stopping", Status: "running"},
+		{ReleaseID: oldReleaseID, JobType: "printer", JobState: "stopping", Status: "running"},
+		{ReleaseID: oldReleaseID, JobType: "printer", JobState: "down", Status: "running"},
+		{ReleaseID: oldReleaseID, JobType: "printer", JobState: "down", Status: "running"},
+		{ReleaseID: releaseID, JobType: "", JobState: "", Status: "complete"},
+	}
+	waitForDeploymentEvents(t, events, expected)
+}
+
 func (s *DeployerSuite) TestRollback(t *c.C) {
 	deployment := s.createDeployment(t, "crasher", "all-at-once")
 	events := make(chan *ct.DeploymentEvent)
@@ -132,6 +165,7 @@ func (s *DeployerSuite) TestRollback(t *c.C) {
 		{ReleaseID: oldReleaseID, JobType: "crasher", JobState: "stopping", Status: "running"},
 		{ReleaseID: oldReleaseID, JobType: "crasher", JobState: "crashed", Status: "running"},
 		{ReleaseID: releaseID, JobType: "", JobState: "", Status: "failed"},
+		{ReleaseID: oldReleaseID, JobType: "", JobState: "", Status: "rolled_back"},
 	}
 	waitForDeploymentEvents(t, events, expected)
 
@@ -146,4 +180,9 @@ func (s *DeployerSuite) TestRollback(t *c.C) {
 	t.Assert(f.Processes, c.DeepEquals, map[string]int{"crasher": 2})
 	_, err = s.controllerClient(t).GetFormation(deployment.AppID, releaseID)
 	t.Assert(err, c.NotNil)
+
+	// check that the deployment was marked as finished
+	d, err := s.controllerClient(t).GetDeployment(deployment.ID)
+	t.Assert(err, c.IsNil)
+	t.Assert(d.FinishedAt, c.NotNil)
 }
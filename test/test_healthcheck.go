@@ -65,7 +65,7 @@ outer:
 	for {
 		select {
 		case e := <-events:
-			if e.Kind != discoverd.EventKindDown {
+			if !e.Kind.Any(discoverd.EventKindDown, discoverd.EventKindExpired) {
 				continue
 			}
 			break outer
@@ -10,8 +10,10 @@ import (
 	c "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
 	"github.com/flynn/flynn/discoverd/client"
 	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/host/volume"
 	"github.com/flynn/flynn/pkg/cluster"
 	"github.com/flynn/flynn/pkg/exec"
+	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/pkg/random"
 )
 
@@ -146,21 +148,121 @@ func (s *HostSuite) TestNetworkedPersistentJob(t *c.C) {
 	t.Assert(resp, c.Equals, "echocococo\n")
 }
 
+func (s *HostSuite) TestJobStats(t *c.C) {
+	h := s.anyHostClient(t)
+	cmd, _, err := makeIshApp(s.clusterClient(t), h, s.discoverdClient(t), host.ContainerConfig{})
+	t.Assert(err, c.IsNil)
+	defer cmd.Kill()
+
+	stats, err := h.GetJobStats(cmd.Job.ID)
+	t.Assert(err, c.IsNil)
+	t.Assert(stats.JobID, c.Equals, cmd.Job.ID)
+	t.Assert(stats.MemoryUsage > 0, c.Equals, true)
+	t.Assert(stats.Processes > 0, c.Equals, true)
+
+	ch := make(chan *host.JobStats)
+	stream, err := h.StreamJobStats(cmd.Job.ID, 100*time.Millisecond, ch)
+	t.Assert(err, c.IsNil)
+	defer stream.Close()
+	var last *host.JobStats
+	for i := 0; i < 2; i++ {
+		select {
+		case sample, ok := <-ch:
+			if !ok {
+				t.Fatalf("stats stream closed unexpectedly: %s", stream.Err())
+			}
+			if last != nil {
+				t.Assert(sample.Time.After(last.Time), c.Equals, true)
+				t.Assert(sample.CPUTime >= last.CPUTime, c.Equals, true)
+			}
+			last = sample
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for job stats")
+		}
+	}
+}
+
 func (s *HostSuite) TestVolumeCreation(t *c.C) {
 	h := s.anyHostClient(t)
 
-	vol, err := h.CreateVolume("default")
+	vol, err := h.CreateVolume("default", 0)
 	t.Assert(err, c.IsNil)
 	t.Assert(vol.ID, c.Not(c.Equals), "")
 }
 
+func (s *HostSuite) TestVolumeSizeLimit(t *c.C) {
+	h := s.anyHostClient(t)
+
+	size := int64(16 * 1024 * 1024)
+	vol, err := h.CreateVolume("default", size)
+	t.Assert(err, c.IsNil)
+	defer h.DestroyVolume(vol.ID)
+	t.Assert(vol.Size, c.Equals, size)
+
+	vols, err := h.ListVolumes()
+	t.Assert(err, c.IsNil)
+	for _, v := range vols {
+		if v.ID == vol.ID {
+			t.Assert(v.Size, c.Equals, size)
+			t.Assert(v.Available <= size, c.Equals, true)
+			return
+		}
+	}
+	t.Fatalf("volume %s not listed", vol.ID)
+}
+
 func (s *HostSuite) TestVolumeCreationFailsForNonexistentProvider(t *c.C) {
 	h := s.anyHostClient(t)
 
-	_, err := h.CreateVolume("non-existent")
+	_, err := h.CreateVolume("non-existent", 0)
 	t.Assert(err, c.NotNil)
 }
 
+func (s *HostSuite) TestVolumeDeletion(t *c.C) {
+	h := s.anyHostClient(t)
+
+	vol, err := h.CreateVolume("default", 0)
+	t.Assert(err, c.IsNil)
+	snap, err := h.CreateSnapshot(vol.ID)
+	t.Assert(err, c.IsNil)
+	t.Assert(snap.ParentID, c.Equals, vol.ID)
+
+	snapshots, err := h.ListSnapshots(vol.ID)
+	t.Assert(err, c.IsNil)
+	t.Assert(snapshots, c.HasLen, 1)
+	t.Assert(snapshots[0].ID, c.Equals, snap.ID)
+
+	// a volume cannot be destroyed while it has snapshots
+	err = h.DestroyVolume(vol.ID)
+	t.Assert(err, c.NotNil)
+
+	t.Assert(h.DestroyVolume(snap.ID), c.IsNil)
+	t.Assert(h.DestroyVolume(vol.ID), c.IsNil)
+	err = h.DestroyVolume(vol.ID)
+	t.Assert(err, c.NotNil)
+	t.Assert(err.(httphelper.JSONError).Code, c.Equals, httphelper.ObjectNotFoundError)
+}
+
+func (s *HostSuite) TestVolumeSendReceive(t *c.C) {
+	h := s.anyHostClient(t)
+
+	vol, err := h.CreateVolume("default", 64*1024*1024)
+	t.Assert(err, c.IsNil)
+	defer h.DestroyVolume(vol.ID)
+
+	stream, info, err := h.SendVolume(vol.ID)
+	t.Assert(err, c.IsNil)
+	defer stream.Close()
+	t.Assert(*info, c.Equals, volume.StreamInfo{Kind: "zfs", Size: 64 * 1024 * 1024})
+
+	// the received volume has the same size limit
+	received, err := h.ReceiveVolume("default", info, stream)
+	t.Assert(err, c.IsNil)
+	t.Assert(received.ID, c.Not(c.Equals), vol.ID)
+	t.Assert(received.Size, c.Equals, vol.Size)
+	t.Assert(h.DestroyVolume(received.ID), c.IsNil)
+}
+
 func (s *HostSuite) TestVolumePersistence(t *c.C) {
 	// most of the volume tests (snapshotting, quotas, etc) are unit tests under their own package.
 	// these tests exist to cover the last mile where volumes are bind-mounted into containers.
@@ -169,7 +271,7 @@ func (s *HostSuite) TestVolumePersistence(t *c.C) {
 	h := s.anyHostClient(t)
 
 	// create a volume!
-	vol, err := h.CreateVolume("default")
+	vol, err := h.CreateVolume("default", 0)
 	t.Assert(err, c.IsNil)
 
 	// create first job
@@ -9,6 +9,7 @@ import (
 	c "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
 	"github.com/flynn/flynn/controller/client"
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/attempt"
 	"github.com/flynn/flynn/pkg/cluster"
 	"github.com/flynn/flynn/pkg/stream"
@@ -64,6 +65,8 @@ func waitForJobEvents(t *c.C, stream stream.Stream, events chan *ct.JobEvent, ex
 				actual[event.Type]["up"] += 1
 			case "down", "crashed":
 				actual[event.Type]["down"] += 1
+			case "failed":
+				actual[event.Type]["failed"] += 1
 			default:
 				break inner
 			}
@@ -373,6 +376,150 @@ func (s *SchedulerSuite) TestOmniJobs(t *c.C) {
 	waitForJobEvents(t, stream, events, jobEvents{"omni": {"up": 2}})
 }
 
+func (s *SchedulerSuite) TestPlacementConstraints(t *c.C) {
+	hosts, err := s.clusterClient(t).ListHosts()
+	t.Assert(err, c.IsNil)
+	t.Assert(len(hosts) > 0, c.Equals, true)
+	pinnedHost := hosts[0].ID
+
+	app, release := s.createApp(t)
+	cmd := []string{"sh", "-c", "while true; do echo I am placed; sleep 1; done"}
+	release.ID = ""
+	release.Processes = map[string]ct.ProcessType{
+		"pinned": {
+			Cmd:         cmd,
+			Constraints: &ct.PlacementConstraints{Require: map[string]string{ct.HostIDTag: pinnedHost}},
+		},
+		"spread": {
+			Cmd:         cmd,
+			Constraints: &ct.PlacementConstraints{Spread: ct.HostIDTag},
+		},
+		"avoider": {
+			Cmd:         cmd,
+			Constraints: &ct.PlacementConstraints{Avoid: []string{"pinned"}},
+		},
+		"unplaceable": {
+			Cmd:         cmd,
+			Constraints: &ct.PlacementConstraints{Require: map[string]string{"zone": "nonexistent"}},
+		},
+	}
+	client := s.controllerClient(t)
+	t.Assert(client.CreateRelease(release), c.IsNil)
+	t.Assert(client.SetAppRelease(app.ID, release.ID), c.IsNil)
+
+	events := make(chan *ct.JobEvent)
+	stream, err := client.StreamJobEvents(app.ID, 0, events)
+	t.Assert(err, c.IsNil)
+	defer stream.Close()
+
+	t.Assert(client.PutFormation(&ct.Formation{
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		Processes: map[string]int{"pinned": 2, "spread": len(hosts), "avoider": 1, "unplaceable": 1},
+	}), c.IsNil)
+	waitForJobEvents(t, stream, events, jobEvents{
+		"pinned":      {"up": 2},
+		"spread":      {"up": len(hosts)},
+		"avoider":     {"up": 1},
+		"unplaceable": {"failed": 1},
+	})
+
+	list, err := client.JobList(app.ID)
+	t.Assert(err, c.IsNil)
+	jobHosts := make(map[string][]string)
+	for _, job := range list {
+		if job.State != "up" {
+			continue
+		}
+		hostID, _, _ := cluster.ParseJobID(job.ID)
+		jobHosts[job.Type] = append(jobHosts[job.Type], hostID)
+	}
+
+	// check required tags are enforced
+	t.Assert(jobHosts["pinned"], c.DeepEquals, []string{pinnedHost, pinnedHost})
+	t.Assert(jobHosts["unplaceable"], c.HasLen, 0)
+
+	// check jobs are spread across hosts
+	spread := make(map[string]struct{})
+	for _, hostID := range jobHosts["spread"] {
+		spread[hostID] = struct{}{}
+	}
+	t.Assert(spread, c.HasLen, len(hosts))
+
+	// check avoided process types are not co-located when there is a choice
+	if len(hosts) > 1 {
+		t.Assert(jobHosts["avoider"], c.HasLen, 1)
+		t.Assert(jobHosts["avoider"][0], c.Not(c.Equals), pinnedHost)
+	}
+}
+
+func (s *SchedulerSuite) TestResourcePlacement(t *c.C) {
+	hosts, err := s.clusterClient(t).ListHosts()
+	t.Assert(err, c.IsNil)
+	var maxMemory int
+	for _, h := range hosts {
+		t.Assert(h.Resources, c.NotNil)
+		t.Assert(h.Resources.Memory > 0, c.Equals, true)
+		t.Assert(h.Resources.CPU > 0, c.Equals, true)
+		if h.Resources.AllocatableMemory > maxMemory {
+			maxMemory = h.Resources.AllocatableMemory
+		}
+	}
+
+	app, release := s.createApp(t)
+	release.ID = ""
+	release.Processes["oversized"] = ct.ProcessType{
+		Cmd:       []string{"sh", "-c", "while true; do echo I am too big; sleep 1; done"},
+		Resources: host.JobResources{Memory: maxMemory + 1},
+	}
+	client := s.controllerClient(t)
+	t.Assert(client.CreateRelease(release), c.IsNil)
+	t.Assert(client.SetAppRelease(app.ID, release.ID), c.IsNil)
+
+	events := make(chan *ct.JobEvent)
+	stream, err := client.StreamJobEvents(app.ID, 0, events)
+	t.Assert(err, c.IsNil)
+	defer stream.Close()
+
+	// check the job which fits is started and the oversized one is refused
+	t.Assert(client.PutFormation(&ct.Formation{
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		Processes: map[string]int{"printer": 1, "oversized": 1},
+	}), c.IsNil)
+	waitForJobEvents(t, stream, events, jobEvents{"printer": {"up": 1}, "oversized": {"failed": 1}})
+
+	list, err := client.JobList(app.ID)
+	t.Assert(err, c.IsNil)
+	var failed int
+	for _, job := range list {
+		if job.Type != "oversized" {
+			continue
+		}
+		t.Assert(job.State, c.Equals, "failed")
+		t.Assert(job.Error, Matches, "no hosts have the capacity for oversized")
+		failed++
+	}
+	t.Assert(failed, c.Equals, 1)
+
+	// check the failure is reported once rather than on every rectify
+	t.Assert(client.PutFormation(&ct.Formation{
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		Processes: map[string]int{"printer": 2, "oversized": 1},
+	}), c.IsNil)
+	waitForJobEvents(t, stream, events, jobEvents{"printer": {"up": 1}})
+	list, err = client.JobList(app.ID)
+	t.Assert(err, c.IsNil)
+	failed = 0
+	for _, job := range list {
+		if job.State == "failed" {
+			failed++
+		}
+	}
+	t.Assert(failed, c.Equals, 1)
+}
+
 func (s *SchedulerSuite) TestJobRestartBackoffPolicy(t *c.C) {
 	if testCluster == nil {
 		t.Skip("cannot determine scheduler backoff period")